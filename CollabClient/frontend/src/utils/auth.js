@@ -1,4 +1,13 @@
+import { serverConfig } from '../store'
+
 const TOKEN_KEY = 'jwt_token'
+const REFRESH_KEY = 'refresh_token'
+const EXPIRES_KEY = 'jwt_expires_at'
+
+// 访问令牌只有十几分钟有效期，在过期前一分钟用刷新令牌换新
+let refreshTimer = null
+// 正在进行的刷新；刷新令牌只能用一次，定时刷新与 401 重试必须共用同一个请求
+let refreshing = null
 
 export function migrateLegacyAuthToken() {
     const legacyToken = localStorage.getItem(TOKEN_KEY)
@@ -12,7 +21,7 @@ export function migrateLegacyAuthToken() {
     localStorage.removeItem(TOKEN_KEY)
 }
 
-export function setAuthToken(token) {
+export function setAuthToken(token, refreshToken, expiresIn) {
     if (!token) {
         clearAuthToken()
         return
@@ -20,6 +29,111 @@ export function setAuthToken(token) {
 
     sessionStorage.setItem(TOKEN_KEY, token)
     localStorage.removeItem(TOKEN_KEY)
+    if (refreshToken) {
+        sessionStorage.setItem(REFRESH_KEY, refreshToken)
+        if (expiresIn) {
+            sessionStorage.setItem(EXPIRES_KEY, String(Date.now() + expiresIn * 1000))
+        }
+        scheduleTokenRefresh(expiresIn)
+    }
+}
+
+// resumeTokenRefresh 在页面重新加载后按保存的过期时间恢复定时刷新，已过期时立即刷新
+export function resumeTokenRefresh() {
+    if (!sessionStorage.getItem(REFRESH_KEY)) {
+        return
+    }
+    const expiresAt = Number(sessionStorage.getItem(EXPIRES_KEY)) || tokenExpiry(getAuthToken())
+    if (!expiresAt) {
+        return
+    }
+    const remaining = Math.floor((expiresAt - Date.now()) / 1000)
+    if (remaining <= 60) {
+        refreshAuthToken()
+        return
+    }
+    scheduleTokenRefresh(remaining)
+}
+
+// tokenExpiry 读取 JWT 中的 exp（毫秒），用于没有保存过期时间的旧令牌
+function tokenExpiry(token) {
+    try {
+        const payload = token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')
+        return JSON.parse(atob(payload)).exp * 1000
+    } catch (e) {
+        return 0
+    }
+}
+
+function scheduleTokenRefresh(expiresIn) {
+    clearTimeout(refreshTimer)
+    if (!expiresIn) {
+        return
+    }
+    const delay = Math.max(expiresIn - 60, 10) * 1000
+    refreshTimer = setTimeout(refreshAuthToken, delay)
+}
+
+export function refreshAuthToken() {
+    if (!refreshing) {
+        refreshing = doRefreshAuthToken().finally(() => { refreshing = null })
+    }
+    return refreshing
+}
+
+async function doRefreshAuthToken() {
+    const refreshToken = sessionStorage.getItem(REFRESH_KEY)
+    if (!refreshToken) {
+        return false
+    }
+    try {
+        const response = await fetch(`${serverConfig.getHttpUrl()}/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken })
+        })
+        if (!response.ok) {
+            return false
+        }
+        const data = await response.json()
+        setAuthToken(data.token, data.refresh_token, data.expires_in)
+        return true
+    } catch (e) {
+        console.error('[auth] refresh failed', e)
+        // 网络异常时稍后重试
+        scheduleTokenRefresh(70)
+        return false
+    }
+}
+
+// authFetch 带上访问令牌发起请求；遇到 401 时刷新一次令牌再重试
+export async function authFetch(url, options = {}) {
+    const send = () => fetch(url, {
+        ...options,
+        headers: { ...options.headers, 'Authorization': `Bearer ${getAuthToken()}` }
+    })
+    const response = await send()
+    if (response.status !== 401 || !(await refreshAuthToken())) {
+        return response
+    }
+    return send()
+}
+
+// logout 通知服务端吊销当前会话，all 为 true 时退出所有设备
+export async function logout(all = false) {
+    const token = getAuthToken()
+    clearAuthToken()
+    if (!token) {
+        return
+    }
+    try {
+        await fetch(`${serverConfig.getHttpUrl()}/logout${all ? '/all' : ''}`, {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${token}` }
+        })
+    } catch (e) {
+        console.error('[auth] logout failed', e)
+    }
 }
 
 export function getAuthToken() {
@@ -27,6 +141,9 @@ export function getAuthToken() {
 }
 
 export function clearAuthToken() {
+    clearTimeout(refreshTimer)
     sessionStorage.removeItem(TOKEN_KEY)
+    sessionStorage.removeItem(REFRESH_KEY)
+    sessionStorage.removeItem(EXPIRES_KEY)
     localStorage.removeItem(TOKEN_KEY)
 }
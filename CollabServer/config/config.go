@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/joho/godotenv"
@@ -39,6 +40,20 @@ func GetEnv(key, fallback string) string {
 	return fallback
 }
 
+// GetEnvInt 获取整数配置项，缺失或格式错误时使用默认值
+func GetEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		fmt.Printf("⚠️ [Config] %s=%q 不是整数，使用默认值 %d\n", key, value, fallback)
+		return fallback
+	}
+	return n
+}
+
 // =============================================================================
 // findOrCreateEnvFile 查找或自动创建 .env 文件
 // =============================================================================
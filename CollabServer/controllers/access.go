@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+
+	"gorm.io/gorm"
+)
+
+// canAccessRoom 判断用户是否可以通过 REST 接口读取房间数据
+// 房间没有独立的成员表，进入过房间（存在访问记录）即视为有权限
+func canAccessRoom(username, roomID string) bool {
+	if username == "" || roomID == "" {
+		return false
+	}
+	var count int64
+	database.DB.Model(&models.History{}).Where("username = ? AND room_id = ?", username, roomID).Count(&count)
+	return count > 0 && !isRoomTrashed(roomID)
+}
+
+// accessibleRoomIDs 返回用户可访问房间 ID 的子查询，用于 room_id IN (?) 过滤
+func accessibleRoomIDs(username string) *gorm.DB {
+	return database.DB.Model(&models.History{}).Select("room_id").
+		Where("username = ? AND room_id NOT IN (?)", username, trashedRoomIDs())
+}
+
+// trashedRoomIDs 返回回收站中房间 ID 的子查询
+func trashedRoomIDs() *gorm.DB {
+	return database.DB.Unscoped().Model(&models.Room{}).Select("room_id").Where("deleted_at IS NOT NULL")
+}
+
+func isRoomTrashed(roomID string) bool {
+	var count int64
+	database.DB.Unscoped().Model(&models.Room{}).Where("room_id = ? AND deleted_at IS NOT NULL", roomID).Count(&count)
+	return count > 0
+}
+
+// isAdmin 判断用户是否为管理员
+func isAdmin(username string) bool {
+	var user models.User
+	if err := database.DB.Select("role").Where("username = ?", username).First(&user).Error; err != nil {
+		return false
+	}
+	return user.Role == "admin"
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/storage"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// useTestDB 将 database.DB 替换为只在本测试内存在的内存数据库，并建好全部表
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// 内存数据库每个连接各自独立，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	err = db.AutoMigrate(&models.User{}, &models.Document{}, &models.Message{}, &models.History{}, &models.Notification{}, &models.MessageReaction{}, &models.MessageAudit{},
+		&models.Conversation{}, &models.ConversationMember{}, &models.DirectMessage{},
+		&models.StoredFile{}, &models.Attachment{}, &models.Upload{}, &models.ResumableUpload{}, &models.StorageUsage{}, &models.OrphanedUpload{}, &models.DocumentVersion{}, &models.Template{}, &models.Room{}, &models.RoomTag{}, &models.Folder{}, &models.FolderRoom{}, &models.Session{}, &models.LoginThrottle{}, &models.AuthAudit{})
+	if err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		sqlDB.Close()
+	})
+}
+
+// useTestStorage 将 storage.Default 替换为临时目录中的本地存储
+func useTestStorage(t *testing.T) storage.Storage {
+	t.Helper()
+
+	s, err := storage.NewLocalStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := storage.Default
+	storage.Default = s
+	t.Cleanup(func() { storage.Default = prev })
+	return s
+}
+
+// performRequest 以 username 的身份调用挂在 route 上的处理器；username 为空时不带认证信息
+func performRequest(handler gin.HandlerFunc, method, route, target, body, username string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(method, route, func(c *gin.Context) {
+		if username != "" {
+			c.Set("username", username)
+		}
+		c.Next()
+	}, handler)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func putTestObject(t *testing.T, s storage.Storage, key string) {
+	t.Helper()
+	if err := s.Put(context.Background(), key, strings.NewReader("data"), 4, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCanAccessUploadDeniesUnknownKeys(t *testing.T) {
+	useTestDB(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.User{Username: "carol", Password: "x", Avatar: "/uploads/avatar.png"})
+
+	cases := []struct {
+		name     string
+		username string
+		upload   models.Upload
+		found    bool
+		want     bool
+	}{
+		{"unknown key", "alice", models.Upload{}, false, false},
+		{"anonymous", "", models.Upload{StorageKey: "a.png", RoomID: "room-1"}, true, false},
+		{"room member", "alice", models.Upload{StorageKey: "a.png", RoomID: "room-1"}, true, true},
+		{"other room", "alice", models.Upload{StorageKey: "b.png", RoomID: "room-2"}, true, false},
+		{"own personal", "alice", models.Upload{StorageKey: "c.png", Uploader: "alice"}, true, true},
+		{"other personal", "alice", models.Upload{StorageKey: "d.png", Uploader: "carol"}, true, false},
+		{"avatar", "alice", models.Upload{StorageKey: "avatar.png", Uploader: "carol"}, true, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := canAccessUpload(tc.username, tc.upload, tc.found); got != tc.want {
+				t.Fatalf("canAccessUpload = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestBackfillUploadRecordsAssignsLegacyFiles(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	for _, key := range []string{"avatar.png", "doc.png", "chat.png", "dm.png", "known.png"} {
+		putTestObject(t, s, key)
+	}
+	database.DB.Create(&models.User{Username: "carol", Password: "x", Avatar: "/uploads/avatar.png"})
+	database.DB.Create(&models.Document{RoomID: "room-1", Content: `<img src="/uploads/doc.png"><img src="/uploads/missing.png">`})
+	database.DB.Create(&models.Message{RoomID: "room-2", Sender: "bob", Content: `/uploads/chat.png /uploads/doc.png`})
+	database.DB.Create(&models.DirectMessage{ConversationID: 1, Sender: "bob", Content: `/uploads/dm.png`})
+	database.DB.Create(&models.Upload{StorageKey: "known.png", RoomID: "room-9", Uploader: "dave"})
+	database.DB.Create(&models.Message{RoomID: "room-2", Sender: "bob", Content: `/uploads/known.png`})
+
+	created, err := BackfillUploadRecords(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 4 {
+		t.Fatalf("expected 4 records, got %d", created)
+	}
+
+	want := map[string][2]string{
+		"avatar.png": {"", "carol"},
+		"doc.png":    {"room-1", ""},
+		"chat.png":   {"room-2", ""},
+		"dm.png":     {"", "bob"},
+		"known.png":  {"room-9", "dave"},
+	}
+	var rows []models.Upload
+	database.DB.Find(&rows)
+	if len(rows) != len(want) {
+		t.Fatalf("expected %d upload rows, got %+v", len(want), rows)
+	}
+	for _, row := range rows {
+		if got := [2]string{row.RoomID, row.Uploader}; got != want[row.StorageKey] {
+			t.Fatalf("%s: expected room/uploader %v, got %v", row.StorageKey, want[row.StorageKey], got)
+		}
+	}
+
+	// 再次执行不会重复补录
+	if created, err := BackfillUploadRecords(context.Background()); err != nil || created != 0 {
+		t.Fatalf("expected idempotent backfill, got %d, %v", created, err)
+	}
+}
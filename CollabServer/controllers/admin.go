@@ -0,0 +1,285 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// 管理接口：用户与在线房间
+// =============================================================================
+// 挂在 /api/admin 下，由 middleware.RequireAdmin 按数据库中的角色放行。
+// 管理员不能禁用、删除自己或修改自己的角色，因此站点上始终至少保留一个管理员。
+// 第一个管理员由 ADMIN_USERNAME / ADMIN_PASSWORD 或 -create-admin 命令行参数创建，见 EnsureAdmin。
+// =============================================================================
+
+// AdminPasswordInput 管理员重置密码的请求体
+type AdminPasswordInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AdminRoleInput 修改角色的请求体
+type AdminRoleInput struct {
+	Role string `json:"role" binding:"required"` // user 或 admin
+}
+
+// AdminCloseRoomInput 强制关闭房间的请求体，reason 会展示给在线成员
+type AdminCloseRoomInput struct {
+	Reason string `json:"reason"`
+}
+
+// AdminListUsers 分页列出用户，q 匹配用户名或显示名，可按 role、disabled 过滤
+// GET /api/admin/users?q=&role=admin&disabled=true&limit=20&offset=0
+func AdminListUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := database.DB.Model(&models.User{})
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := likePattern(q)
+		query = query.Where("(username LIKE ? ESCAPE '\\' OR display_name LIKE ? ESCAPE '\\')", like, like)
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	if disabled := c.Query("disabled"); disabled != "" {
+		query = query.Where("disabled = ?", disabled == "true" || disabled == "1")
+	}
+
+	var total int64
+	query.Count(&total)
+	var users []models.User
+	query.Order("id").Limit(limit).Offset(offset).Find(&users)
+
+	items := make([]profileResponse, 0, len(users))
+	for _, u := range users {
+		items = append(items, newProfileResponse(u))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": items, "total": total, "limit": limit, "offset": offset})
+}
+
+// AdminDisableUser 禁用用户并断开其全部在线连接
+// POST /api/admin/users/:id/disable
+func AdminDisableUser(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findManagedUser(c)
+		if !ok {
+			return
+		}
+		if err := database.DB.Model(&user).Update("disabled", true).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		revokeUserSessions(hub, user.Username, 0, "账号已被管理员禁用")
+		c.JSON(http.StatusOK, gin.H{"user": newProfileResponse(user)})
+	}
+}
+
+// AdminEnableUser 重新启用被禁用的用户
+// POST /api/admin/users/:id/enable
+func AdminEnableUser(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Model(&user).Update("disabled", false).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newProfileResponse(user)})
+}
+
+// AdminDeleteUser 删除用户并断开其在线连接。
+// 用户记录为软删除，用户名保持占用，避免他人注册同名账号冒充其历史消息
+// DELETE /api/admin/users/:id
+func AdminDeleteUser(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findManagedUser(c)
+		if !ok {
+			return
+		}
+		if err := database.DB.Delete(&user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		revokeUserSessions(hub, user.Username, 0, "账号已被管理员删除")
+		c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+	}
+}
+
+// AdminResetPassword 为用户设置新密码，无需原密码；该用户已登录的设备全部需要重新登录
+// POST /api/admin/users/:id/password
+func AdminResetPassword(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := findUserParam(c)
+		if !ok {
+			return
+		}
+		var input AdminPasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.Password) < minPasswordLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "新密码至少 6 位"})
+			return
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+			return
+		}
+		if err := database.DB.Model(&user).Update("password", string(hashed)).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		// 管理员重置自己的密码时保留当前会话
+		var keep uint
+		if username, _ := getAuthUsername(c); username == user.Username {
+			keep, _ = getAuthSessionID(c)
+		}
+		revokeUserSessions(hub, user.Username, keep, "密码已被管理员重置，请重新登录")
+		c.JSON(http.StatusOK, gin.H{"message": "密码已重置"})
+	}
+}
+
+// AdminSetUserRole 修改用户角色，立即生效（管理员权限以数据库为准，不依赖 Token 中的 role）
+// PUT /api/admin/users/:id/role
+func AdminSetUserRole(c *gin.Context) {
+	user, ok := findManagedUser(c)
+	if !ok {
+		return
+	}
+	var input AdminRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Role != "user" && input.Role != "admin" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色只能是 user 或 admin"})
+		return
+	}
+	if err := database.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newProfileResponse(user)})
+}
+
+// AdminCloseRoom 保存文档后强制关闭在线房间，所有成员收到 room_closed
+// POST /api/admin/rooms/:id/close
+func AdminCloseRoom(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input AdminCloseRoomInput
+		// 请求体可省略
+		_ = c.ShouldBindJSON(&input)
+		reason := strings.TrimSpace(input.Reason)
+		if reason == "" {
+			reason = "房间已被管理员关闭"
+		}
+		if !hub.CloseRoom(c.Param("id"), reason) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "房间当前不在线"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "房间已关闭"})
+	}
+}
+
+// findUserParam 按路径参数 :id 查找用户，找不到时已写入 404
+func findUserParam(c *gin.Context) (models.User, bool) {
+	var user models.User
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || database.DB.First(&user, id).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return user, false
+	}
+	return user, true
+}
+
+// findManagedUser 在 findUserParam 的基础上拒绝管理员操作自己的账号
+func findManagedUser(c *gin.Context) (models.User, bool) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return user, false
+	}
+	if username, _ := getAuthUsername(c); user.Username == username {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能对自己的账号执行该操作"})
+		return user, false
+	}
+	return user, true
+}
+
+// EnsureAdmin 创建管理员账号；用户已存在时提升为管理员，password 非空时同时重置密码。
+// 返回是否新建了账号
+func EnsureAdmin(username, password string) (created bool, err error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return false, errors.New("用户名不能为空")
+	}
+	updates := map[string]interface{}{"role": "admin", "disabled": false}
+	if password != "" {
+		if len(password) < minPasswordLength {
+			return false, errors.New("密码至少 6 位")
+		}
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return false, err
+		}
+		updates["password"] = string(hashed)
+	}
+
+	var user models.User
+	err = database.DB.Where("username = ?", username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if password == "" {
+			return false, errors.New("新建管理员需要提供密码")
+		}
+		user = models.User{Username: username, Password: updates["password"].(string), Role: "admin"}
+		return true, database.DB.Create(&user).Error
+	}
+	if err != nil {
+		return false, err
+	}
+	return false, database.DB.Model(&user).Updates(updates).Error
+}
+
+// BootstrapAdmin 在站点还没有任何管理员时，用 ADMIN_USERNAME / ADMIN_PASSWORD 创建第一个管理员。
+// 已有管理员时不做任何事，避免每次启动都用环境变量覆盖账号。
+// 只会新建账号，不提升已注册的同名用户：开放注册时任何人都可能抢先注册这个用户名。
+// 返回是否新建了账号
+func BootstrapAdmin(username, password string) (bool, error) {
+	username = strings.TrimSpace(username)
+	if username == "" {
+		return false, nil
+	}
+	var admins int64
+	database.DB.Model(&models.User{}).Where("role = ?", "admin").Count(&admins)
+	if admins > 0 {
+		return false, nil
+	}
+	if password == "" {
+		return false, errors.New("设置了 ADMIN_USERNAME 时必须同时设置 ADMIN_PASSWORD")
+	}
+	var existing int64
+	database.DB.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&existing)
+	if existing > 0 {
+		return false, fmt.Errorf("用户 %s 已存在，不会自动提升为管理员；确认该账号属于你后请运行 -create-admin %s", username, username)
+	}
+	return EnsureAdmin(username, password)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestBootstrapAdmin(t *testing.T) {
+	cases := []struct {
+		name        string
+		setup       func()
+		username    string
+		password    string
+		wantCreated bool
+		wantErr     bool
+	}{
+		{"not configured", func() {}, "", "", false, false},
+		{"creates first admin", func() {}, "root", "secret123", true, false},
+		{"password required", func() {}, "root", "", false, true},
+		{"password too short", func() {}, "root", "short", false, true},
+		{"refuses to promote registered user", func() { createTestUser(t, "root", "attacker1") }, "root", "secret123", false, true},
+		{"admin already exists", func() {
+			database.DB.Create(&models.User{Username: "boss", Password: "x", Role: "admin"})
+			createTestUser(t, "root", "attacker1")
+		}, "root", "secret123", false, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			useTestDB(t)
+			tc.setup()
+			created, err := BootstrapAdmin(tc.username, tc.password)
+			if created != tc.wantCreated || (err != nil) != tc.wantErr {
+				t.Fatalf("expected created=%v err=%v, got %v %v", tc.wantCreated, tc.wantErr, created, err)
+			}
+
+			var user models.User
+			if database.DB.Where("username = ?", "root").First(&user).Error != nil {
+				return
+			}
+			if tc.wantCreated {
+				if user.Role != "admin" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(tc.password)) != nil {
+					t.Fatalf("expected admin with the configured password, got %+v", user)
+				}
+				return
+			}
+			// 已注册的同名账号既不会被提升，也不会被改密码
+			if user.Role == "admin" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("attacker1")) != nil {
+				t.Fatalf("expected existing account to be left alone, got %+v", user)
+			}
+		})
+	}
+}
@@ -1,14 +1,11 @@
 package controllers
 
 import (
-	"collab-server/config"
 	"collab-server/database"
 	"collab-server/models"
 	"net/http"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -68,54 +65,57 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// 1. 查找用户
-	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在"})
+	// 1. 失败次数过多的用户名或 IP 暂时不能登录，锁定期间不再校验密码（见 login_guard.go）
+	ip := c.ClientIP()
+	if wait := loginLockRemaining(userSubject(input.Username), ipSubject(ip)); wait > 0 {
+		writeLoginLocked(c, wait)
 		return
 	}
+	// 校验密码前先计入本次尝试，并发请求同时通过上面的检查时，超出阈值的在这里被拒绝
+	attempt, wait := beginLoginAttempt(input.Username, ip)
+	if wait > 0 {
+		writeLoginLocked(c, wait)
+		return
+	}
+
+	// 2. 查找用户并比对密码。用户不存在时同样做一次比对，两种失败的提示和耗时都一致，避免枚举用户名
+	findErr := database.DB.Where("username = ?", input.Username).First(&user).Error
+	hash := dummyPasswordHash()
+	if findErr == nil {
+		hash = []byte(user.Password)
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(input.Password)); err != nil || findErr != nil {
+		attempt.fail()
+		c.JSON(http.StatusUnauthorized, gin.H{"error": loginFailedMessage})
+		return
+	}
+	attempt.succeed()
 
-	// 2. 比对密码
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+	if user.Disabled {
+		c.JSON(http.StatusForbidden, gin.H{"error": "账号已被禁用，请联系管理员"})
 		return
 	}
 
-	// 3. 生成 JWT Token
+	// 3. 创建会话并签发 JWT Token
 	// ==========================================================================
 	// JWT (JSON Web Token) 是一种无状态的身份验证方案。
 	// 它由三部分组成：Header.Payload.Signature
 	// - Header: 声明算法 (HS256)
-	// - Payload: 存放用户信息 (userId, username, role, exp)
+	// - Payload: 存放用户信息 (userId, username, role, sid, exp)
 	// - Signature: 用 JWT_SECRET 对前两部分签名，防止篡改
 	//
 	// 🔐 安全要点：
 	// 1. JWT_SECRET 必须足够复杂（至少32字符）
 	// 2. 绝对不能硬编码在代码中
 	// 3. 生产环境需要定期轮换
+	//
+	// 访问令牌默认只有 15 分钟有效期，并通过 sid 关联服务端会话（见 session.go），
+	// 过期后用 refresh_token 调用 /refresh 换取新令牌
 	// ==========================================================================
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"userId":   user.ID,
-		"username": user.Username,
-		"role":     user.Role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(), // 24小时过期
-	})
-
-	// 🔐 核心安全点：JWT_SECRET 不再有默认值
-	// 这强制运维人员必须配置 .env 文件，否则 main.go 会拒绝启动
-	jwtSecret := config.GetEnv("JWT_SECRET", "")
-	if jwtSecret == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "服务器未配置密钥，无法签发 Token"})
-		return
-	}
-	tokenString, err := token.SignedString([]byte(jwtSecret))
+	response, err := startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Token 生成失败"})
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"token":    tokenString,
-		"username": user.Username,
-		"userId":   user.ID,
-	})
+	c.JSON(http.StatusOK, response)
 }
@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 私信群聊的人数上限（包含创建者）
+const maxConversationMembers = 20
+
+// ConversationInput 创建私信会话的请求体
+type ConversationInput struct {
+	Members []string `json:"members" binding:"required"` // 除自己以外的成员
+	Title   string   `json:"title"`
+}
+
+// DirectMessageInput 发送私信的请求体
+type DirectMessageInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// ConversationSummary 是会话列表中的一项
+type ConversationSummary struct {
+	models.Conversation
+	LastMessage *models.DirectMessage `json:"last_message,omitempty"`
+	Unread      int64                 `json:"unread"`
+}
+
+func parseConversationID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "会话 ID 非法"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// loadMembership 读取当前用户在会话中的成员记录，不是成员时返回 false
+func loadMembership(conversationID uint, username string) (models.ConversationMember, bool) {
+	var member models.ConversationMember
+	err := database.DB.Where("conversation_id = ? AND username = ?", conversationID, username).First(&member).Error
+	return member, err == nil
+}
+
+// ListConversations 列出当前用户的私信会话，按最近消息时间倒序，附带未读数
+func ListConversations(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	var memberships []models.ConversationMember
+	database.DB.Where("username = ?", username).Find(&memberships)
+	lastRead := make(map[uint]uint, len(memberships))
+	ids := make([]uint, 0, len(memberships))
+	for _, m := range memberships {
+		lastRead[m.ConversationID] = m.LastReadMessageID
+		ids = append(ids, m.ConversationID)
+	}
+
+	var conversations []models.Conversation
+	if len(ids) > 0 {
+		database.DB.Preload("Members").Where("id IN ?", ids).Order("last_message_at desc").Find(&conversations)
+	}
+
+	var totalUnread int64
+	summaries := make([]ConversationSummary, 0, len(conversations))
+	for _, conv := range conversations {
+		summary := ConversationSummary{Conversation: conv}
+
+		var last models.DirectMessage
+		if err := database.DB.Where("conversation_id = ?", conv.ID).Order("id desc").First(&last).Error; err == nil {
+			summary.LastMessage = &last
+		}
+		database.DB.Model(&models.DirectMessage{}).
+			Where("conversation_id = ? AND id > ? AND sender <> ?", conv.ID, lastRead[conv.ID], username).
+			Count(&summary.Unread)
+		totalUnread += summary.Unread
+
+		summaries = append(summaries, summary)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": summaries, "unread": totalUnread})
+}
+
+// CreateConversation 创建一对一或群聊会话；一对一会话已存在时直接返回
+func CreateConversation(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	var input ConversationInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	memberSet := map[string]bool{username: true}
+	for _, m := range input.Members {
+		if m = strings.TrimSpace(m); m != "" {
+			memberSet[m] = true
+		}
+	}
+	if len(memberSet) < 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "至少需要一位其他成员"})
+		return
+	}
+	if len(memberSet) > maxConversationMembers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "群聊人数超过上限"})
+		return
+	}
+
+	members := make([]string, 0, len(memberSet))
+	for m := range memberSet {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+
+	var existingCount int64
+	database.DB.Model(&models.User{}).Where("username IN ?", members).Count(&existingCount)
+	if int(existingCount) != len(members) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "部分成员不存在"})
+		return
+	}
+
+	isGroup := len(members) > 2
+	var directKey *string
+	if !isGroup {
+		key := strings.Join(members, "|")
+		directKey = &key
+
+		var existing models.Conversation
+		if err := database.DB.Preload("Members").Where("direct_key = ?", key).First(&existing).Error; err == nil {
+			c.JSON(http.StatusOK, gin.H{"conversation": existing})
+			return
+		}
+	}
+
+	now := time.Now()
+	conv := models.Conversation{
+		DirectKey:     directKey,
+		IsGroup:       isGroup,
+		Title:         strings.TrimSpace(input.Title),
+		CreatedBy:     username,
+		LastMessageAt: now,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&conv).Error; err != nil {
+			return err
+		}
+		for _, m := range members {
+			member := models.ConversationMember{ConversationID: conv.ID, Username: m, JoinedAt: now}
+			if err := tx.Create(&member).Error; err != nil {
+				return err
+			}
+			conv.Members = append(conv.Members, member)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建会话失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversation": conv})
+}
+
+// GetConversationMessages 按消息 ID 向前分页读取私信
+func GetConversationMessages(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	conversationID, ok := parseConversationID(c)
+	if !ok {
+		return
+	}
+	if _, ok := loadMembership(conversationID, username); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": websocket.ErrConversationNotFound.Error()})
+		return
+	}
+
+	limit := websocket.ChatHistoryPageSize(0)
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数非法"})
+			return
+		}
+		limit = websocket.ChatHistoryPageSize(n)
+	}
+
+	query := database.DB.Where("conversation_id = ?", conversationID)
+	if before, err := strconv.ParseUint(c.Query("before"), 10, 64); err == nil && before > 0 {
+		query = query.Where("id < ?", before)
+	}
+
+	var messages []models.DirectMessage
+	query.Order("id desc").Limit(limit + 1).Find(&messages)
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+
+	response := gin.H{"messages": messages, "has_more": hasMore}
+	if hasMore && len(messages) > 0 {
+		response["next_before"] = messages[0].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SendConversationMessage 通过 REST 发送私信（与用户频道的 dm_send 等价）
+func SendConversationMessage(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		conversationID, ok := parseConversationID(c)
+		if !ok {
+			return
+		}
+
+		var input DirectMessageInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		msg, err := hub.SendDirectMessage(conversationID, username, input.Content)
+		switch {
+		case errors.Is(err, websocket.ErrConversationNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, websocket.ErrEmptyDirectMessage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "发送失败"})
+		default:
+			c.JSON(http.StatusOK, gin.H{"message": msg})
+		}
+	}
+}
+
+// MarkConversationRead 标记会话已读（请求体可带 messageId，缺省为最新一条）
+func MarkConversationRead(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		conversationID, ok := parseConversationID(c)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			MessageID uint `json:"messageId"`
+		}
+		_ = c.ShouldBindJSON(&input)
+
+		if err := hub.MarkConversationRead(conversationID, username, input.MessageID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已标记为已读"})
+	}
+}
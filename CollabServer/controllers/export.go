@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/richtext"
+	"collab-server/storage"
+	"collab-server/uploads"
+	"collab-server/websocket"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单张内嵌图片的读取上限，超过的图片保留链接
+const maxEmbeddedImageSize = 20 << 20
+
+// exportFormats 是支持的导出格式：扩展名与 Content-Type
+var exportFormats = map[string]struct{ ext, contentType string }{
+	"md":   {".md", "text/markdown; charset=utf-8"},
+	"txt":  {".txt", "text/plain; charset=utf-8"},
+	"html": {".html", "text/html; charset=utf-8"},
+	"docx": {".docx", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+}
+
+// ExportDocument 把房间文档导出为 md、txt、html（图片内联）或 docx
+// GET /api/rooms/:id/export?format=md
+func ExportDocument(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := c.Param("id")
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+		format := strings.ToLower(c.DefaultQuery("format", "md"))
+		spec, ok := exportFormats[format]
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导出格式，可选 md、txt、html、docx"})
+			return
+		}
+
+		// 房间有人在线时以内存中的内容为准
+		content, live := hub.RoomContent(roomID)
+		if !live {
+			var doc models.Document
+			if err := database.DB.Where("room_id = ?", roomID).First(&doc).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+				return
+			}
+			content = doc.Content
+		}
+
+		title := roomID
+		loader := exportImageLoader(c, username)
+		var body []byte
+		switch format {
+		case "md":
+			body = []byte(richtext.Markdown(content))
+		case "txt":
+			body = []byte(richtext.Text(content))
+		case "html":
+			body = []byte(richtext.StandaloneHTML(title, content, loader))
+		case "docx":
+			data, err := richtext.DOCX(title, content, loader)
+			if err != nil {
+				log.Printf("⚠️ 导出 DOCX 失败: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败"})
+				return
+			}
+			body = data
+		}
+
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + spec.ext}))
+		c.Data(http.StatusOK, spec.contentType, body)
+	}
+}
+
+// exportImageLoader 读取文档中的 /uploads 图片，权限与直接访问 /uploads 相同
+func exportImageLoader(c *gin.Context, username string) richtext.ImageLoader {
+	return func(src string) ([]byte, string, bool) {
+		key, ok := uploads.KeyFromURL(src)
+		if !ok {
+			return nil, "", false
+		}
+		key, err := storage.CleanKey(key)
+		if err != nil || strings.HasPrefix(key, "files/") {
+			return nil, "", false
+		}
+		upload, found := uploads.Lookup(key)
+		if !canAccessUpload(username, upload, found) {
+			return nil, "", false
+		}
+		r, obj, err := storage.Default.Get(c.Request.Context(), key)
+		if err != nil {
+			return nil, "", false
+		}
+		defer r.Close()
+		if obj.Size > maxEmbeddedImageSize {
+			return nil, "", false
+		}
+		data, err := io.ReadAll(io.LimitReader(r, maxEmbeddedImageSize))
+		if err != nil {
+			return nil, "", false
+		}
+		contentType := obj.ContentType
+		if contentType == "" {
+			contentType = http.DetectContentType(data)
+		}
+		return data, contentType, true
+	}
+}
@@ -0,0 +1,282 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/storage"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// 通用附件：/api/files
+// =============================================================================
+// 与只接受图片的 /upload 不同，这里按嗅探出的真实 MIME 类型（而非扩展名）做白名单校验，
+// 文件按 SHA-256 内容寻址存放在存储后端的 files/<前两位>/<hash>，相同内容只存一份；
+// Attachment 记录"谁在哪个房间上传了什么名字的文件"，下载时还原原始文件名。
+// =============================================================================
+
+const defaultAttachmentTypes = "application/pdf," +
+	"text/plain,text/csv,text/markdown," +
+	"application/zip,application/x-7z-compressed,application/gzip," +
+	"application/msword,application/vnd.ms-excel,application/vnd.ms-powerpoint," +
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document," +
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet," +
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation," +
+	"image/jpeg,image/png,image/gif,image/webp"
+
+// allowedAttachmentTypes 读取 ATTACHMENT_ALLOWED_TYPES，支持 "text/*" 这样的通配
+func allowedAttachmentTypes() []string {
+	raw := config.GetEnv("ATTACHMENT_ALLOWED_TYPES", defaultAttachmentTypes)
+	var types []string
+	for _, t := range strings.Split(raw, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func isAttachmentTypeAllowed(mimeType string) bool {
+	for _, allowed := range allowedAttachmentTypes() {
+		if allowed == mimeType {
+			return true
+		}
+		if strings.HasSuffix(allowed, "/*") && strings.HasPrefix(mimeType, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// baseMimeType 去掉 "; charset=utf-8" 之类的参数
+func baseMimeType(m string) string {
+	if mediaType, _, err := mime.ParseMediaType(m); err == nil {
+		return strings.ToLower(mediaType)
+	}
+	return strings.ToLower(strings.TrimSpace(strings.SplitN(m, ";", 2)[0]))
+}
+
+// fileStorageKey 返回内容寻址的相对存储路径
+func fileStorageKey(sum string) string {
+	return path.Join("files", sum[:2], sum)
+}
+
+// UploadFile 上传通用附件到指定房间（表单字段：file, room）
+func UploadFile(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	roomID := strings.TrimSpace(c.PostForm("room"))
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权向该房间上传文件"})
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "获取文件失败"})
+		return
+	}
+
+	maxMB := config.GetEnvInt("ATTACHMENT_MAX_SIZE_MB", 20)
+	if file.Size > int64(maxMB)*1024*1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件大小不能超过 %dMB", maxMB)})
+		return
+	}
+	if respondQuotaError(c, checkQuota(username, roomID, file.Size)) {
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+		return
+	}
+	defer src.Close()
+
+	// 1. 嗅探真实类型
+	detected, err := mimetype.DetectReader(src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+		return
+	}
+	mimeType := baseMimeType(detected.String())
+	if !isAttachmentTypeAllowed(mimeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件内容类型不允许: %s", mimeType)})
+		return
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+		return
+	}
+
+	// 2. 边写临时文件边计算哈希（哈希算出来之前不知道最终 Key）
+	tmp, err := os.CreateTemp("", "collab-upload-*")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), src)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+
+	// 3. 写入存储并创建附件记录
+	attachment, err := saveAttachment(c.Request.Context(), tmp, size, sum, mimeType, roomID, username, file.Filename)
+	if err != nil {
+		log.Printf("⚠️ 保存附件失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"attachment": attachment,
+		"url":        fmt.Sprintf("/api/files/%d/download", attachment.ID),
+	})
+}
+
+// saveAttachment 把已落地的临时文件按内容寻址写入存储（内容已存在则复用），并创建附件记录
+func saveAttachment(ctx context.Context, f *os.File, size int64, sum, mimeType, roomID, uploader, filename string) (models.Attachment, error) {
+	var stored models.StoredFile
+	if err := database.DB.Where("sha256 = ?", sum).First(&stored).Error; err != nil {
+		key := fileStorageKey(sum)
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return models.Attachment{}, err
+		}
+		if err := storage.Default.Put(ctx, key, f, size, mimeType); err != nil {
+			return models.Attachment{}, err
+		}
+		stored = models.StoredFile{SHA256: sum, Size: size, MimeType: mimeType, StorageKey: key}
+		if err := database.DB.Create(&stored).Error; err != nil {
+			// 并发上传同一内容时另一个请求可能已经写入记录
+			if err := database.DB.Where("sha256 = ?", sum).First(&stored).Error; err != nil {
+				return models.Attachment{}, err
+			}
+		}
+	}
+
+	attachment := models.Attachment{
+		RoomID:       roomID,
+		Uploader:     uploader,
+		FileSHA256:   sum,
+		OriginalName: filepath.Base(filename),
+		Size:         size,
+		MimeType:     mimeType,
+	}
+	if err := database.DB.Create(&attachment).Error; err != nil {
+		return models.Attachment{}, err
+	}
+	addUsage(uploader, roomID, size, 1)
+	return attachment, nil
+}
+
+// loadAccessibleAttachment 读取附件并校验当前用户对其所属房间的访问权限
+func loadAccessibleAttachment(c *gin.Context) (models.Attachment, bool) {
+	var attachment models.Attachment
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return attachment, false
+	}
+	if err := database.DB.First(&attachment, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return attachment, false
+	}
+	if !canAccessRoom(username, attachment.RoomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该文件"})
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// GetFile 返回附件元信息
+func GetFile(c *gin.Context) {
+	attachment, ok := loadAccessibleAttachment(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"attachment": attachment})
+}
+
+// DownloadFile 以原始文件名下载附件
+func DownloadFile(c *gin.Context) {
+	attachment, ok := loadAccessibleAttachment(c)
+	if !ok {
+		return
+	}
+
+	var stored models.StoredFile
+	if err := database.DB.Where("sha256 = ?", attachment.FileSHA256).First(&stored).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件内容不存在"})
+		return
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.OriginalName})
+	serveStoredObject(c, stored.StorageKey, attachment.MimeType, disposition)
+}
+
+// ListRoomFiles 列出房间内的附件
+func ListRoomFiles(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	roomID := c.Param("id")
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+		return
+	}
+
+	var attachments []models.Attachment
+	database.DB.Where("room_id = ?", roomID).Order("id desc").Find(&attachments)
+	c.JSON(http.StatusOK, gin.H{"files": attachments})
+}
+
+// DeleteFile 删除附件（仅上传者）。文件内容可能被其他附件共用，不再被引用时才一并删除
+func DeleteFile(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.Where("id = ? AND uploader = ?", c.Param("id"), username).First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在或无权删除"})
+		return
+	}
+	if database.DB.Unscoped().Delete(&attachment).RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在或无权删除"})
+		return
+	}
+	addUsage(attachment.Uploader, attachment.RoomID, -attachment.Size, -1)
+	releaseStoredFiles(c.Request.Context(), []string{attachment.FileSHA256})
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
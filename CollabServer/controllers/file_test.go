@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"bytes"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/storage"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// uploadTestFile 以 username 的身份向 roomID 上传一个附件
+func uploadTestFile(t *testing.T, username, roomID, filename string, content []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("room", roomID)
+	part, err := form.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(content)
+	form.Close()
+
+	r := gin.New()
+	r.POST("/api/files", func(c *gin.Context) {
+		c.Set("username", username)
+		c.Next()
+	}, UploadFile)
+	req := httptest.NewRequest(http.MethodPost, "/api/files", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func uploadedAttachment(t *testing.T, w *httptest.ResponseRecorder) models.Attachment {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload: %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Attachment models.Attachment `json:"attachment"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp.Attachment
+}
+
+func storedObjectExists(s storage.Storage, sum string) bool {
+	_, err := s.Stat(context.Background(), fileStorageKey(sum))
+	return err == nil
+}
+
+func TestUploadFileRejectsDisallowedContent(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+
+	cases := []struct {
+		name     string
+		username string
+		filename string
+		content  []byte
+		wantCode int
+	}{
+		{"html disguised as pdf", "alice", "report.pdf", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), http.StatusBadRequest},
+		{"executable", "alice", "tool.txt", []byte("\x7fELF\x02\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00"), http.StatusBadRequest},
+		{"plain text", "alice", "notes.txt", []byte("hello world"), http.StatusOK},
+		{"pdf", "alice", "doc.pdf", []byte("%PDF-1.4\n%âãÏÓ\n"), http.StatusOK},
+		{"non-member", "bob", "notes.txt", []byte("hello world"), http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if w := uploadTestFile(t, tc.username, "room-1", tc.filename, tc.content); w.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d %s", tc.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUploadFileDedupesIdenticalContent(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-2"})
+
+	first := uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "a.txt", []byte("same content")))
+	second := uploadedAttachment(t, uploadTestFile(t, "bob", "room-2", "b.txt", []byte("same content")))
+
+	if first.FileSHA256 != second.FileSHA256 || first.ID == second.ID {
+		t.Fatalf("expected two attachments sharing one hash, got %+v and %+v", first, second)
+	}
+	var stored int64
+	database.DB.Model(&models.StoredFile{}).Count(&stored)
+	if stored != 1 || !storedObjectExists(s, first.FileSHA256) {
+		t.Fatalf("expected one stored blob, got %d", stored)
+	}
+	objects, _ := s.List(context.Background(), "files/")
+	if len(objects) != 1 {
+		t.Fatalf("expected one object in storage, got %d", len(objects))
+	}
+}
+
+func TestDownloadFileUsesOriginalName(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	attachment := uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "季度 报告.txt", []byte("quarterly numbers")))
+
+	target := fmt.Sprintf("/api/files/%d/download", attachment.ID)
+	w := performRequest(DownloadFile, http.MethodGet, "/api/files/:id/download", target, "", "alice")
+	if w.Code != http.StatusOK || w.Body.String() != "quarterly numbers" {
+		t.Fatalf("download: %d %s", w.Code, w.Body.String())
+	}
+	_, params, err := mime.ParseMediaType(w.Header().Get("Content-Disposition"))
+	if err != nil || params["filename"] != "季度 报告.txt" {
+		t.Fatalf("expected original filename, got %q", w.Header().Get("Content-Disposition"))
+	}
+
+	if w := performRequest(DownloadFile, http.MethodGet, "/api/files/:id/download", target, "", "bob"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected non-member download to be forbidden, got %d", w.Code)
+	}
+}
+
+func TestDeleteFileReleasesUnreferencedContent(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-1"})
+	mine := uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "a.txt", []byte("shared")))
+	shared := uploadedAttachment(t, uploadTestFile(t, "bob", "room-1", "b.txt", []byte("shared")))
+
+	deleteAs := func(username string, id uint) int {
+		return performRequest(DeleteFile, http.MethodDelete, "/api/files/:id", fmt.Sprintf("/api/files/%d", id), "", username).Code
+	}
+
+	if code := deleteAs("bob", mine.ID); code != http.StatusNotFound {
+		t.Fatalf("expected other member's delete to be refused, got %d", code)
+	}
+	if code := deleteAs("alice", mine.ID); code != http.StatusOK {
+		t.Fatalf("expected uploader to delete, got %d", code)
+	}
+	if code := deleteAs("alice", mine.ID); code != http.StatusNotFound {
+		t.Fatalf("expected second delete to 404, got %d", code)
+	}
+	var remaining int64
+	database.DB.Unscoped().Model(&models.Attachment{}).Where("id = ?", mine.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Fatal("expected the attachment row to be removed")
+	}
+	if !storedObjectExists(s, mine.FileSHA256) {
+		t.Fatal("expected content still referenced by bob's attachment to be kept")
+	}
+	if used := loadUsage(usageScopeUser, "alice"); used.Bytes != 0 {
+		t.Fatalf("expected alice's usage to be released, got %d", used.Bytes)
+	}
+
+	if code := deleteAs("bob", shared.ID); code != http.StatusOK {
+		t.Fatalf("expected uploader to delete, got %d", code)
+	}
+	var stored int64
+	database.DB.Model(&models.StoredFile{}).Count(&stored)
+	if stored != 0 || storedObjectExists(s, shared.FileSHA256) {
+		t.Fatal("expected unreferenced content to be removed")
+	}
+}
+
+func TestPurgeDeletedAttachmentsKeepsTrashedRooms(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-2"})
+	legacy := uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "old.txt", []byte("legacy")))
+	trashed := uploadedAttachment(t, uploadTestFile(t, "alice", "room-2", "keep.txt", []byte("in trash")))
+
+	// 旧版本的 DeleteFile 只做软删除；room-2 整个在回收站中
+	now := time.Now()
+	database.DB.Delete(&legacy)
+	database.DB.Delete(&trashed)
+	database.DB.Create(&models.Room{RoomID: "room-2", DeletedAt: gorm.DeletedAt{Time: now, Valid: true}})
+
+	purgeDeletedAttachments(context.Background())
+
+	if storedObjectExists(s, legacy.FileSHA256) {
+		t.Fatal("expected content of the soft-deleted attachment to be removed")
+	}
+	if !storedObjectExists(s, trashed.FileSHA256) {
+		t.Fatal("expected content of a trashed room to stay restorable")
+	}
+}
@@ -0,0 +1,263 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FolderInput 创建或修改文件夹的请求体
+type FolderInput struct {
+	Name           *string `json:"name"`
+	ParentID       *uint   `json:"parent_id"`       // 0 表示移到顶层
+	ConversationID *uint   `json:"conversation_id"` // 仅创建时有效：设置后为该群聊的团队文件夹
+}
+
+// FolderRoomInput 把房间加入文件夹的请求体
+type FolderRoomInput struct {
+	RoomID string `json:"room_id" binding:"required"`
+}
+
+// visibleFolders 返回当前用户可见文件夹的查询：个人文件夹与所在群聊的团队文件夹
+func visibleFolders(username string) *gorm.DB {
+	conversations := database.DB.Model(&models.ConversationMember{}).Select("conversation_id").Where("username = ?", username)
+	return database.DB.Model(&models.Folder{}).Where("owner = ? OR conversation_id IN (?)", username, conversations)
+}
+
+// findFolder 查找当前用户可见的文件夹，找不到时已写入 404
+func findFolder(c *gin.Context, username, idParam string) (models.Folder, bool) {
+	var folder models.Folder
+	id, err := strconv.ParseUint(idParam, 10, 64)
+	if err != nil || visibleFolders(username).Where("id = ?", id).First(&folder).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件夹不存在"})
+		return folder, false
+	}
+	return folder, true
+}
+
+// ListFolders 返回当前用户可见的全部文件夹（平铺，客户端按 parent_id 组装成树）
+// GET /api/folders
+func ListFolders(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	var folders []models.Folder
+	visibleFolders(username).Order("name").Find(&folders)
+	c.JSON(http.StatusOK, gin.H{"folders": folders})
+}
+
+// CreateFolder 创建文件夹；子文件夹与父文件夹属于同一个人或同一个群聊
+// POST /api/folders
+func CreateFolder(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	var input FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Name == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件夹名称不能为空"})
+		return
+	}
+	name, ok := validFolderName(c, *input.Name)
+	if !ok {
+		return
+	}
+
+	folder := models.Folder{Name: name, Owner: username}
+	if input.ParentID != nil && *input.ParentID != 0 {
+		parent, ok := findFolder(c, username, strconv.FormatUint(uint64(*input.ParentID), 10))
+		if !ok {
+			return
+		}
+		folder.ParentID = &parent.ID
+		folder.Owner, folder.ConversationID = parent.Owner, parent.ConversationID
+	} else if input.ConversationID != nil {
+		var count int64
+		database.DB.Model(&models.ConversationMember{}).Where("conversation_id = ? AND username = ?", *input.ConversationID, username).Count(&count)
+		if count == 0 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "不是该群聊的成员"})
+			return
+		}
+		folder.Owner, folder.ConversationID = "", input.ConversationID
+	}
+
+	if err := database.DB.Create(&folder).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建文件夹失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// UpdateFolder 重命名或移动文件夹（不能移到其他人的文件夹或自己的子文件夹下）
+// PATCH /api/folders/:id
+func UpdateFolder(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	folder, ok := findFolder(c, username, c.Param("id"))
+	if !ok {
+		return
+	}
+	var input FolderInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		name, ok := validFolderName(c, *input.Name)
+		if !ok {
+			return
+		}
+		updates["name"] = name
+	}
+	if input.ParentID != nil {
+		if *input.ParentID == 0 {
+			updates["parent_id"] = nil
+		} else {
+			parent, ok := findFolder(c, username, strconv.FormatUint(uint64(*input.ParentID), 10))
+			if !ok {
+				return
+			}
+			if parent.Owner != folder.Owner || !sameConversation(parent.ConversationID, folder.ConversationID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "只能移动到同一归属的文件夹下"})
+				return
+			}
+			if isFolderDescendant(parent.ID, folder.ID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "不能移动到自身或子文件夹下"})
+				return
+			}
+			updates["parent_id"] = parent.ID
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&folder).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		database.DB.First(&folder, folder.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"folder": folder})
+}
+
+// DeleteFolder 删除文件夹，子文件夹上移一级，文件夹中的房间本身不受影响
+// DELETE /api/folders/:id
+func DeleteFolder(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	folder, ok := findFolder(c, username, c.Param("id"))
+	if !ok {
+		return
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Folder{}).Where("parent_id = ?", folder.ID).Update("parent_id", folder.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("folder_id = ?", folder.ID).Delete(&models.FolderRoom{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&folder).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// AddRoomToFolder 把自己可访问的房间加入文件夹
+// POST /api/folders/:id/rooms
+func AddRoomToFolder(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	folder, ok := findFolder(c, username, c.Param("id"))
+	if !ok {
+		return
+	}
+	var input FolderRoomInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	roomID := strings.TrimSpace(input.RoomID)
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+		return
+	}
+	database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.FolderRoom{FolderID: folder.ID, RoomID: roomID, AddedBy: username})
+	c.JSON(http.StatusOK, gin.H{"message": "已加入文件夹"})
+}
+
+// RemoveRoomFromFolder 把房间移出文件夹
+// DELETE /api/folders/:id/rooms/:room
+func RemoveRoomFromFolder(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	folder, ok := findFolder(c, username, c.Param("id"))
+	if !ok {
+		return
+	}
+	result := database.DB.Where("folder_id = ? AND room_id = ?", folder.ID, c.Param("room")).Delete(&models.FolderRoom{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "房间不在该文件夹中"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已移出文件夹"})
+}
+
+func validFolderName(c *gin.Context, raw string) (string, bool) {
+	name := strings.TrimSpace(raw)
+	if name == "" || len([]rune(name)) > 100 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件夹名称不能为空且不超过 100 字"})
+		return "", false
+	}
+	return name, true
+}
+
+func sameConversation(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// isFolderDescendant 判断 id 是否为 ancestor 本身或其子孙
+func isFolderDescendant(id, ancestor uint) bool {
+	for depth := 0; depth < 100; depth++ {
+		if id == ancestor {
+			return true
+		}
+		var folder models.Folder
+		if database.DB.Select("parent_id").First(&folder, id).Error != nil || folder.ParentID == nil {
+			return false
+		}
+		id = *folder.ParentID
+	}
+	return true
+}
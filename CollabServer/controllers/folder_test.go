@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+)
+
+func listRoomIDs(t *testing.T, username, query string) []string {
+	t.Helper()
+	w := performRequest(ListRooms, http.MethodGet, "/api/rooms", "/api/rooms"+query, "", username)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/rooms%s: %d %s", query, w.Code, w.Body.String())
+	}
+	var resp struct {
+		Rooms []roomSummary `json:"rooms"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	ids := make([]string, 0, len(resp.Rooms))
+	for _, r := range resp.Rooms {
+		ids = append(ids, r.RoomID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestListRoomsFiltersByTag(t *testing.T) {
+	useTestDB(t)
+	for _, roomID := range []string{"room-1", "room-2", "room-3"} {
+		database.DB.Create(&models.History{Username: "alice", RoomID: roomID})
+	}
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-9"})
+	hub := websocket.NewHub()
+	go hub.Run()
+	setTags := func(username, roomID, body string) {
+		w := performRequest(UpdateRoom(hub), http.MethodPatch, "/api/rooms/:id", "/api/rooms/"+roomID, body, username)
+		if w.Code != http.StatusOK {
+			t.Fatalf("PATCH %s: %d %s", roomID, w.Code, w.Body.String())
+		}
+	}
+	setTags("alice", "room-1", `{"tags":["#Design","design"," 评审 "]}`)
+	setTags("alice", "room-2", `{"tags":["design"]}`)
+	setTags("bob", "room-9", `{"tags":["design"]}`)
+
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"?tag=design", "[room-1 room-2]"},
+		{"?tag=%23DESIGN", "[room-1 room-2]"},
+		{"?tag=评审", "[room-1]"},
+		{"?tag=missing", "[]"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			if got := fmt.Sprint(listRoomIDs(t, "alice", tc.query)); got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	// 标签统计只计入可访问的房间
+	w := performRequest(ListRoomTags, http.MethodGet, "/api/rooms/tags", "/api/rooms/tags", "", "alice")
+	if want := `{"tags":[{"tag":"design","count":2},{"tag":"评审","count":1}]}`; w.Body.String() != want {
+		t.Fatalf("expected %s, got %s", want, w.Body.String())
+	}
+}
+
+func TestFolderCannotMoveIntoItself(t *testing.T) {
+	useTestDB(t)
+	root := models.Folder{Name: "root", Owner: "alice"}
+	database.DB.Create(&root)
+	child := models.Folder{Name: "child", Owner: "alice", ParentID: &root.ID}
+	database.DB.Create(&child)
+	grandchild := models.Folder{Name: "grandchild", Owner: "alice", ParentID: &child.ID}
+	database.DB.Create(&grandchild)
+	other := models.Folder{Name: "bob's", Owner: "bob"}
+	database.DB.Create(&other)
+
+	cases := []struct {
+		name     string
+		folder   uint
+		parent   uint
+		wantCode int
+	}{
+		{"onto itself", root.ID, root.ID, http.StatusBadRequest},
+		{"under its child", root.ID, child.ID, http.StatusBadRequest},
+		{"under its grandchild", root.ID, grandchild.ID, http.StatusBadRequest},
+		{"under someone else's folder", grandchild.ID, other.ID, http.StatusNotFound},
+		{"up to the top level", grandchild.ID, 0, http.StatusOK},
+		{"under a former descendant", root.ID, grandchild.ID, http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			target := fmt.Sprintf("/api/folders/%d", tc.folder)
+			w := performRequest(UpdateFolder, http.MethodPatch, "/api/folders/:id", target, fmt.Sprintf(`{"parent_id":%d}`, tc.parent), "alice")
+			if w.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d %s", tc.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTeamFolderVisibility(t *testing.T) {
+	useTestDB(t)
+	team := models.Conversation{IsGroup: true, Title: "team"}
+	database.DB.Create(&team)
+	database.DB.Create(&models.ConversationMember{ConversationID: team.ID, Username: "alice"})
+	database.DB.Create(&models.ConversationMember{ConversationID: team.ID, Username: "bob"})
+	folder := models.Folder{Name: "shared", ConversationID: &team.ID}
+	database.DB.Create(&folder)
+	database.DB.Create(&models.Folder{Name: "private", Owner: "alice"})
+
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-a"})
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-secret"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-a"})
+	database.DB.Create(&models.Room{RoomID: "room-secret", Title: "机密", Description: "不该被看到"})
+	for _, roomID := range []string{"room-a", "room-secret"} {
+		body := fmt.Sprintf(`{"room_id":%q}`, roomID)
+		w := performRequest(AddRoomToFolder, http.MethodPost, "/api/folders/:id/rooms", fmt.Sprintf("/api/folders/%d/rooms", folder.ID), body, "alice")
+		if w.Code != http.StatusOK {
+			t.Fatalf("add %s: %d %s", roomID, w.Code, w.Body.String())
+		}
+	}
+
+	folderNames := func(username string) []string {
+		w := performRequest(ListFolders, http.MethodGet, "/api/folders", "/api/folders", "", username)
+		var resp struct {
+			Folders []models.Folder `json:"folders"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		var names []string
+		for _, f := range resp.Folders {
+			names = append(names, f.Name)
+		}
+		sort.Strings(names)
+		return names
+	}
+	if got := fmt.Sprint(folderNames("alice")); got != "[private shared]" {
+		t.Fatalf("alice: unexpected folders %s", got)
+	}
+	if got := fmt.Sprint(folderNames("bob")); got != "[shared]" {
+		t.Fatalf("bob: unexpected folders %s", got)
+	}
+	if got := fmt.Sprint(folderNames("carol")); got != "[]" {
+		t.Fatalf("carol: unexpected folders %s", got)
+	}
+
+	query := fmt.Sprintf("?folder=%d", folder.ID)
+	if got := fmt.Sprint(listRoomIDs(t, "alice", query)); got != "[room-a room-secret]" {
+		t.Fatalf("alice: unexpected rooms %s", got)
+	}
+	// bob 能看到团队文件夹，但看不到自己没有权限的房间的标题和描述
+	if got := fmt.Sprint(listRoomIDs(t, "bob", query)); got != "[room-a]" {
+		t.Fatalf("bob: unexpected rooms %s", got)
+	}
+	if w := performRequest(ListRooms, http.MethodGet, "/api/rooms", "/api/rooms"+query, "", "carol"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected non-member to get 404, got %d", w.Code)
+	}
+}
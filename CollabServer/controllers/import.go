@@ -0,0 +1,173 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/imageproc"
+	"collab-server/models"
+	"collab-server/richtext"
+	"collab-server/uploads"
+	"collab-server/websocket"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// importFormats 把扩展名映射到导入格式
+var importFormats = map[string]string{
+	".md": "md", ".markdown": "md",
+	".txt":  "txt",
+	".html": "html", ".htm": "html",
+	".docx": "docx",
+}
+
+// ImportDocument 把 Markdown、纯文本、HTML 或 DOCX 文件转换为编辑器 HTML，整体替换房间文档
+// POST /api/rooms/:id/import（表单字段：file，可选 format=md|txt|html|docx，默认按扩展名判断）
+// 房间不存在时直接创建并记入导入者的历史；已有内容会先保存为一个版本快照
+func ImportDocument(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := strings.TrimSpace(c.Param("id"))
+		if roomID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "房间号不能为空"})
+			return
+		}
+		created := false
+		if !canAccessRoom(username, roomID) {
+			if roomExists(roomID) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+				return
+			}
+			created = true
+		}
+
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "获取文件失败"})
+			return
+		}
+		maxMB := config.GetEnvInt("IMPORT_MAX_SIZE_MB", 20)
+		if file.Size > int64(maxMB)*1024*1024 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件大小不能超过 %dMB", maxMB)})
+			return
+		}
+		format := strings.ToLower(strings.TrimSpace(c.PostForm("format")))
+		if format == "" {
+			format = importFormats[strings.ToLower(filepath.Ext(file.Filename))]
+		}
+
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(src, int64(maxMB)*1024*1024+1))
+		src.Close()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+			return
+		}
+
+		var content string
+		images, skipped := 0, 0
+		switch format {
+		case "md":
+			content = richtext.FromMarkdown(string(data))
+		case "txt":
+			content = richtext.FromText(string(data))
+		case "html":
+			content = richtext.Sanitize(string(data))
+		case "docx":
+			saver := func(img []byte, name string) (string, bool) {
+				src, ok := importImage(c, img, username, roomID)
+				if ok {
+					images++
+				} else {
+					skipped++
+				}
+				return src, ok
+			}
+			content, err = richtext.FromDOCX(data, saver)
+			if err != nil {
+				if errors.Is(err, richtext.ErrInvalidDOCX) {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "无法解析 DOCX 文件"})
+					return
+				}
+				log.Printf("⚠️ 导入 DOCX 失败: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "导入失败"})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的导入格式，可选 md、txt、html、docx"})
+			return
+		}
+
+		if created {
+			database.DB.Create(&models.History{Username: username, RoomID: roomID, UpdatedAt: time.Now()})
+			ensureRoom(roomID)
+		}
+
+		// 替换与取旧内容在 Hub 中一次完成，快照不会漏掉最后几秒的编辑
+		previous := hub.ReplaceDocument(roomID, content, username)
+		var versionID uint
+		if previous != "" && previous != content {
+			version := models.DocumentVersion{RoomID: roomID, Content: previous, Author: username, Reason: "import"}
+			if err := database.DB.Create(&version).Error; err != nil {
+				log.Printf("⚠️ 保存导入前版本失败: %v", err)
+			} else {
+				versionID = version.ID
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"room_id":        roomID,
+			"format":         format,
+			"created":        created,
+			"version_id":     versionID,
+			"images":         images,
+			"skipped_images": skipped,
+		})
+	}
+}
+
+// roomExists 判断房间是否已有设置、文档或访问记录
+func roomExists(roomID string) bool {
+	var rooms, docs, visits int64
+	database.DB.Unscoped().Model(&models.Room{}).Where("room_id = ?", roomID).Count(&rooms)
+	database.DB.Model(&models.Document{}).Where("room_id = ?", roomID).Count(&docs)
+	database.DB.Model(&models.History{}).Where("room_id = ?", roomID).Count(&visits)
+	return rooms > 0 || docs > 0 || visits > 0
+}
+
+// importImage 按普通图片上传的流程保存 DOCX 内嵌图片（配额、去 EXIF、缩略图），返回文档中使用的地址
+func importImage(c *gin.Context, data []byte, username, roomID string) (string, bool) {
+	switch http.DetectContentType(data) {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return "", false
+	}
+	variants, err := imageproc.Process(data, imageproc.OptionsFromEnv())
+	if err != nil {
+		return "", false
+	}
+	results, err := saveImageVariants(c.Request.Context(), variants, roomID, username, uploads.Expiry(time.Now()))
+	if err != nil {
+		var quotaErr *QuotaExceededError
+		if !errors.As(err, &quotaErr) {
+			log.Printf("⚠️ 保存导入图片失败: %v", err)
+		}
+		return "", false
+	}
+	return results[0].URL, true
+}
@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// 登录防暴力破解
+// =============================================================================
+// 按用户名和 IP 分别统计连续失败次数（统计窗口与锁定时长相同，LOGIN_LOCKOUT_MINUTES，默认 15 分钟）：
+// - 用户名：前 3 次失败不限制，之后每次失败需等待 2、4、8… 秒；达到 LOGIN_LOCKOUT_THRESHOLD（默认 10）次锁定
+// - IP：阈值为 LOGIN_IP_LOCKOUT_THRESHOLD（默认 50），超过一半后开始退避，避免同一出口的正常用户受影响
+// 锁定期间不再校验密码。每次尝试在校验密码前先原子计数，并发请求不能越过阈值；登录成功后退回计数。
+// 用户名不存在与密码错误返回同样的提示，锁定与管理员解锁写入 AuthAudit。
+// 修改密码时的旧密码校验同样计入这里的次数。
+// =============================================================================
+
+const loginFreeAttempts = 3
+
+// loginFailedMessage 是用户名不存在与密码错误共用的提示，避免枚举用户名
+const loginFailedMessage = "用户名或密码错误"
+
+// dummyPasswordHash 用于用户名不存在时照常做一次 bcrypt 比对，使两种失败的耗时一致
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("collab-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+func loginLockoutDuration() time.Duration {
+	return time.Duration(config.GetEnvInt("LOGIN_LOCKOUT_MINUTES", 15)) * time.Minute
+}
+
+func userSubject(username string) string { return "user:" + username }
+func ipSubject(ip string) string         { return "ip:" + ip }
+
+// loginLockRemaining 返回这些对象中最长的剩余锁定（含退避）时间，未锁定时为 0
+func loginLockRemaining(subjects ...string) time.Duration {
+	var throttles []models.LoginThrottle
+	database.DB.Where("subject IN ? AND locked_until > ?", subjects, time.Now()).Find(&throttles)
+	var wait time.Duration
+	for _, t := range throttles {
+		wait = max(wait, time.Until(t.LockedUntil))
+	}
+	return wait
+}
+
+func userLockoutThreshold() int { return config.GetEnvInt("LOGIN_LOCKOUT_THRESHOLD", 10) }
+func ipLockoutThreshold() int   { return config.GetEnvInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50) }
+
+// loginAttempt 是一次已计数、尚未得出结果的登录尝试
+type loginAttempt struct {
+	username, ip       string
+	userCount, ipCount int
+}
+
+// beginLoginAttempt 在校验密码之前为用户名与 IP 各计一次尝试。
+// 计数由数据库原子递增后返回，并发请求拿到的是各自的序号；超过阈值的请求即使都通过了
+// loginLockRemaining 的检查也会在这里被锁定拒绝，窗口内最多只会校验 threshold 次密码
+func beginLoginAttempt(username, ip string) (*loginAttempt, time.Duration) {
+	now := time.Now()
+	attempt := &loginAttempt{username: username, ip: ip}
+	var err error
+	if attempt.userCount, err = countAttempt(userSubject(username), now); err != nil {
+		log.Printf("⚠️ 记录登录尝试 %s 出错: %v", userSubject(username), err)
+	}
+	if attempt.ipCount, err = countAttempt(ipSubject(ip), now); err != nil {
+		log.Printf("⚠️ 记录登录尝试 %s 出错: %v", ipSubject(ip), err)
+	}
+
+	var wait time.Duration
+	if attempt.userCount > userLockoutThreshold() {
+		wait = max(wait, applyLoginLock(userSubject(username), ip, attempt.userCount, loginFreeAttempts, userLockoutThreshold()))
+	}
+	if attempt.ipCount > ipLockoutThreshold() {
+		wait = max(wait, applyLoginLock(ipSubject(ip), ip, attempt.ipCount, ipLockoutThreshold()/2, ipLockoutThreshold()))
+	}
+	return attempt, wait
+}
+
+// fail 按本次尝试的序号对用户名与 IP 施加退避或锁定
+func (a *loginAttempt) fail() {
+	applyLoginLock(userSubject(a.username), a.ip, a.userCount, loginFreeAttempts, userLockoutThreshold())
+	applyLoginLock(ipSubject(a.ip), a.ip, a.ipCount, ipLockoutThreshold()/2, ipLockoutThreshold())
+}
+
+// succeed 清除该用户名的失败记录，并退回本次占用的 IP 计数（IP 的失败记录保留到窗口过期）
+func (a *loginAttempt) succeed() {
+	database.DB.Where("subject = ?", userSubject(a.username)).Delete(&models.LoginThrottle{})
+	database.DB.Model(&models.LoginThrottle{}).Where("subject = ? AND failures > 0", ipSubject(a.ip)).
+		UpdateColumn("failures", gorm.Expr("failures - 1"))
+}
+
+// countAttempt 原子地累加 subject 的尝试次数并返回累加后的值，距上次尝试超过统计窗口时从 1 重新计数
+func countAttempt(subject string, now time.Time) (int, error) {
+	var failures int
+	err := database.DB.Raw(`INSERT INTO login_throttles (subject, failures, last_failure, locked_until)
+		VALUES (?, 1, ?, ?)
+		ON CONFLICT(subject) DO UPDATE SET
+			failures = CASE WHEN login_throttles.last_failure < ? THEN 1 ELSE login_throttles.failures + 1 END,
+			last_failure = excluded.last_failure
+		RETURNING failures`,
+		subject, now, time.Time{}, now.Add(-loginLockoutDuration())).Scan(&failures).Error
+	return failures, err
+}
+
+// applyLoginLock 根据失败序号决定锁定时长：超过 free 次后按指数退避，达到 threshold 次时锁定。
+// 只会延长已有的锁定；恰好达到阈值的那次请求写入审计。返回需要等待的时间
+func applyLoginLock(subject, ip string, failures, free, threshold int) time.Duration {
+	now := time.Now()
+	window := loginLockoutDuration()
+	var wait time.Duration
+	switch {
+	case failures >= threshold:
+		wait = window
+	case failures > free:
+		wait = min(time.Second<<min(failures-free, 20), window)
+	default:
+		return 0
+	}
+	until := now.Add(wait)
+	if err := database.DB.Model(&models.LoginThrottle{}).Where("subject = ? AND locked_until < ?", subject, until).
+		Update("locked_until", until).Error; err != nil {
+		log.Printf("⚠️ 记录登录锁定 %s 出错: %v", subject, err)
+	}
+	if failures == threshold {
+		database.DB.Create(&models.AuthAudit{
+			Action:  "lockout",
+			Subject: subject,
+			IP:      ip,
+			Detail:  fmt.Sprintf("连续登录失败 %d 次，锁定至 %s", failures, until.Format(time.DateTime)),
+		})
+		log.Printf("🔒 %s 连续登录失败 %d 次，已锁定 %v", subject, failures, window)
+	}
+	return wait
+}
+
+// writeLoginLocked 返回 429，并通过 Retry-After 告知需要等待的秒数
+func writeLoginLocked(c *gin.Context, wait time.Duration) {
+	seconds := int((wait + time.Second - 1) / time.Second)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	hint := fmt.Sprintf("%d 秒", seconds)
+	if seconds > 60 {
+		hint = fmt.Sprintf("%d 分钟", (seconds+59)/60)
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "登录尝试过于频繁，请 " + hint + "后再试", "retry_after": seconds})
+}
+
+// unlockSubject 删除锁定记录并写入审计
+func unlockSubject(subject, actor string) bool {
+	result := database.DB.Where("subject = ?", subject).Delete(&models.LoginThrottle{})
+	if result.RowsAffected == 0 {
+		return false
+	}
+	database.DB.Create(&models.AuthAudit{Action: "unlock", Subject: subject, Actor: actor, Detail: "管理员解除登录锁定"})
+	return true
+}
+
+// AdminUnlockUser 解除用户名的登录锁定与失败计数
+// POST /api/admin/users/:id/unlock
+func AdminUnlockUser(c *gin.Context) {
+	user, ok := findUserParam(c)
+	if !ok {
+		return
+	}
+	actor, _ := getAuthUsername(c)
+	if !unlockSubject(userSubject(user.Username), actor) {
+		c.JSON(http.StatusOK, gin.H{"message": "该用户没有登录失败记录"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
+// AdminListLockouts 列出当前处于锁定或退避中的用户名与 IP
+// GET /api/admin/lockouts
+func AdminListLockouts(c *gin.Context) {
+	var throttles []models.LoginThrottle
+	database.DB.Where("locked_until > ?", time.Now()).Order("locked_until desc").Find(&throttles)
+	c.JSON(http.StatusOK, gin.H{"lockouts": throttles})
+}
+
+// AdminDeleteLockout 按记录解除锁定，可用于解锁 IP
+// DELETE /api/admin/lockouts/:id
+func AdminDeleteLockout(c *gin.Context) {
+	var throttle models.LoginThrottle
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || database.DB.First(&throttle, id).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "锁定记录不存在"})
+		return
+	}
+	actor, _ := getAuthUsername(c)
+	unlockSubject(throttle.Subject, actor)
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
+// AdminListAuthAudit 分页查看登录锁定与解锁记录，可按 subject 过滤（如 user:alice、ip:1.2.3.4）
+// GET /api/admin/auth-audit?subject=&limit=50&offset=0
+func AdminListAuthAudit(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := database.DB.Model(&models.AuthAudit{})
+	if subject := c.Query("subject"); subject != "" {
+		query = query.Where("subject = ?", subject)
+	}
+	var total int64
+	query.Count(&total)
+	var entries []models.AuthAudit
+	query.Order("id desc").Limit(limit).Offset(offset).Find(&entries)
+	c.JSON(http.StatusOK, gin.H{"entries": entries, "total": total, "limit": limit, "offset": offset})
+}
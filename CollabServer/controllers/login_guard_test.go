@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func loginStatus(r *gin.Engine, username, password string) (int, string, string) {
+	w := doJSON(r, http.MethodPost, "/login", fmt.Sprintf(`{"username":%q,"password":%q}`, username, password), "")
+	return w.Code, w.Header().Get("Retry-After"), w.Body.String()
+}
+
+func TestLoginFailureMessageIsUniform(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+
+	wrongCode, _, wrongBody := loginStatus(r, "alice", "wrong")
+	unknownCode, _, unknownBody := loginStatus(r, "nobody", "wrong")
+	if wrongCode != http.StatusUnauthorized || unknownCode != http.StatusUnauthorized || wrongBody != unknownBody {
+		t.Fatalf("expected identical 401 responses, got %d %s / %d %s", wrongCode, wrongBody, unknownCode, unknownBody)
+	}
+}
+
+func TestLoginBackoffAfterFreeAttempts(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+
+	for i := 1; i <= loginFreeAttempts+1; i++ {
+		if code, _, _ := loginStatus(r, "alice", "wrong"); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %d", i, code)
+		}
+	}
+	// 第 4 次失败后需等待 2 秒，期间连正确密码也不再校验
+	code, retryAfter, _ := loginStatus(r, "alice", "secret123")
+	if code != http.StatusTooManyRequests || retryAfter != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %d %q", code, retryAfter)
+	}
+}
+
+func TestLoginLockoutAndAdminUnlock(t *testing.T) {
+	r := sessionRouter(t)
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "4")
+	t.Setenv("LOGIN_LOCKOUT_MINUTES", "15")
+	createTestUser(t, "alice", "secret123")
+
+	for i := 1; i <= 4; i++ {
+		loginStatus(r, "alice", "wrong")
+	}
+	code, retryAfter, _ := loginStatus(r, "alice", "secret123")
+	if code != http.StatusTooManyRequests || retryAfter != "900" {
+		t.Fatalf("expected 429 with Retry-After 900, got %d %q", code, retryAfter)
+	}
+	var audits int64
+	database.DB.Model(&models.AuthAudit{}).Where("action = ? AND subject = ?", "lockout", "user:alice").Count(&audits)
+	if audits != 1 {
+		t.Fatalf("expected one lockout audit entry, got %d", audits)
+	}
+
+	var alice models.User
+	database.DB.Where("username = ?", "alice").First(&alice)
+	w := performRequest(AdminUnlockUser, http.MethodPost, "/api/admin/users/:id/unlock", fmt.Sprintf("/api/admin/users/%d/unlock", alice.ID), "", "admin")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unlock: %d %s", w.Code, w.Body.String())
+	}
+	database.DB.Model(&models.AuthAudit{}).Where("action = ? AND subject = ? AND actor = ?", "unlock", "user:alice", "admin").Count(&audits)
+	if audits != 1 {
+		t.Fatalf("expected one unlock audit entry, got %d", audits)
+	}
+	if code, _, body := loginStatus(r, "alice", "secret123"); code != http.StatusOK {
+		t.Fatalf("expected login after unlock to succeed, got %d %s", code, body)
+	}
+}
+
+func TestConcurrentLoginFailuresCannotExceedThreshold(t *testing.T) {
+	r := sessionRouter(t)
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "5")
+	createTestUser(t, "alice", "secret123")
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		checked int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code, _, _ := loginStatus(r, "alice", "wrong"); code == http.StatusUnauthorized {
+				mu.Lock()
+				checked++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if checked > 5 {
+		t.Fatalf("expected at most 5 password checks, got %d", checked)
+	}
+	var throttle models.LoginThrottle
+	database.DB.Where("subject = ?", "user:alice").First(&throttle)
+	if throttle.LockedUntil.IsZero() {
+		t.Fatal("expected alice to be locked")
+	}
+}
+
+func TestSuccessfulLoginDoesNotCountAgainstIP(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+
+	loginStatus(r, "nobody", "wrong")
+	for i := 0; i < 3; i++ {
+		loginAs(t, r, "alice", "secret123")
+	}
+	var throttles []models.LoginThrottle
+	database.DB.Find(&throttles)
+	if len(throttles) != 2 {
+		t.Fatalf("expected throttle rows for the unknown user and the IP, got %+v", throttles)
+	}
+	for _, throttle := range throttles {
+		if throttle.Failures != 1 {
+			t.Fatalf("%s: expected 1 failure, got %d", throttle.Subject, throttle.Failures)
+		}
+	}
+}
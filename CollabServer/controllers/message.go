@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"collab-server/websocket"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseTimeParam 支持 RFC3339 和 2006-01-02 两种格式
+// endOfDay 为 true 时，纯日期会被解释为当天结束（用作区间右端点）
+func parseTimeParam(raw string, endOfDay bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", raw, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// GetRoomMessages 按游标向前分页获取房间聊天记录
+// GET /api/rooms/:id/messages?before=<messageId>&limit=50&from=2026-01-01&to=2026-01-31
+func GetRoomMessages(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	roomID := c.Param("id")
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+		return
+	}
+
+	query := websocket.ChatHistoryQuery{RoomID: roomID}
+	if raw := c.Query("before"); raw != "" {
+		before, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "before 参数非法"})
+			return
+		}
+		query.Before = uint(before)
+	}
+	if raw := c.Query("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit 参数非法"})
+			return
+		}
+		query.Limit = limit
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 参数非法，应为 RFC3339 或 YYYY-MM-DD"})
+		return
+	}
+	if query.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to 参数非法，应为 RFC3339 或 YYYY-MM-DD"})
+		return
+	}
+
+	page, err := websocket.QueryChatHistory(query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询聊天记录失败"})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,55 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestGetRoomMessagesAccess(t *testing.T) {
+	useTestDB(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "dave", RoomID: "room-2"})
+	database.DB.Create(&models.Room{RoomID: "room-2", DeletedAt: gorm.DeletedAt{Time: time.Now(), Valid: true}})
+	for i := 0; i < 3; i++ {
+		database.DB.Create(&models.Message{RoomID: "room-1", Sender: "alice", Content: "hi"})
+	}
+
+	cases := []struct {
+		name     string
+		username string
+		target   string
+		wantCode int
+	}{
+		{"member", "alice", "/api/rooms/room-1/messages?limit=2", http.StatusOK},
+		{"non-member", "bob", "/api/rooms/room-1/messages", http.StatusForbidden},
+		{"anonymous", "", "/api/rooms/room-1/messages", http.StatusUnauthorized},
+		{"trashed room", "dave", "/api/rooms/room-2/messages", http.StatusForbidden},
+		{"bad cursor", "alice", "/api/rooms/room-1/messages?before=abc", http.StatusBadRequest},
+		{"bad date", "alice", "/api/rooms/room-1/messages?from=yesterday", http.StatusBadRequest},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := performRequest(GetRoomMessages, http.MethodGet, "/api/rooms/:id/messages", tc.target, "", tc.username)
+			if w.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d %s", tc.wantCode, w.Code, w.Body.String())
+			}
+			if tc.wantCode != http.StatusOK {
+				return
+			}
+			var page struct {
+				Messages []models.Message `json:"messages"`
+				HasMore  bool             `json:"has_more"`
+			}
+			json.Unmarshal(w.Body.Bytes(), &page)
+			if len(page.Messages) != 2 || !page.HasMore {
+				t.Fatalf("expected a 2-message page with more, got %s", w.Body.String())
+			}
+		})
+	}
+}
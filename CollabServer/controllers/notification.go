@@ -0,0 +1,101 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListNotifications 获取当前用户的通知收件箱（?unread=true 只看未读）
+func ListNotifications(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	query := database.DB.Where("username = ?", username)
+	if c.Query("unread") == "true" {
+		query = query.Where("read = ?", false)
+	}
+
+	var notifications []models.Notification
+	query.Order("id desc").Limit(limit).Find(&notifications)
+
+	var unread int64
+	database.DB.Model(&models.Notification{}).Where("username = ? AND read = ?", username, false).Count(&unread)
+
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "unread": unread})
+}
+
+// MarkNotificationRead 把一条通知标记为已读
+func MarkNotificationRead(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("id = ? AND username = ?", c.Param("id"), username).
+		Update("read", true)
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已标记为已读"})
+}
+
+// MarkAllNotificationsRead 把当前用户的全部通知标记为已读
+func MarkAllNotificationsRead(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	result := database.DB.Model(&models.Notification{}).
+		Where("username = ? AND read = ?", username, false).
+		Update("read", true)
+	c.JSON(http.StatusOK, gin.H{"message": "已全部标记为已读", "updated": result.RowsAffected})
+}
+
+// DeleteNotification 删除一条通知
+func DeleteNotification(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	result := database.DB.Where("id = ? AND username = ?", c.Param("id"), username).Delete(&models.Notification{})
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "通知不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// ClearNotifications 清空当前用户的通知（?read=true 只清理已读）
+func ClearNotifications(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	query := database.DB.Where("username = ?", username)
+	if c.Query("read") == "true" {
+		query = query.Where("read = ?", true)
+	}
+	result := query.Delete(&models.Notification{})
+	c.JSON(http.StatusOK, gin.H{"message": "已清空", "deleted": result.RowsAffected})
+}
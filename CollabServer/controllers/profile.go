@@ -0,0 +1,184 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/uploads"
+	"collab-server/websocket"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 新密码的最短长度
+const minPasswordLength = 6
+
+// profileResponse 是 /api/me 返回的个人资料，avatar_url 是可直接展示的签名地址
+type profileResponse struct {
+	models.User
+	AvatarURL string `json:"avatar_url"`
+}
+
+func newProfileResponse(user models.User) profileResponse {
+	resp := profileResponse{User: user}
+	if user.Avatar != "" {
+		resp.AvatarURL = uploads.SignLinks(user.Avatar, "", user.Username)
+	}
+	return resp
+}
+
+// GetMe 返回当前用户的个人资料
+// GET /api/me
+func GetMe(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newProfileResponse(user)})
+}
+
+// ProfileInput 修改个人资料的请求体，未提供的字段保持不变
+type ProfileInput struct {
+	DisplayName *string `json:"display_name"`
+	// 先用 /upload（不带 room）上传图片，再把返回的 url 填在这里；空字符串表示移除头像
+	Avatar *string `json:"avatar"`
+}
+
+// UpdateMe 修改显示名与头像，在线房间中的成员列表会随之更新
+// PATCH /api/me
+func UpdateMe(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		var input ProfileInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		updates := map[string]interface{}{}
+		if input.DisplayName != nil {
+			name := strings.TrimSpace(*input.DisplayName)
+			if len([]rune(name)) > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "显示名不能超过 50 字"})
+				return
+			}
+			updates["display_name"] = name
+		}
+		if input.Avatar != nil {
+			avatar, ok := avatarURL(c, username, strings.TrimSpace(*input.Avatar))
+			if !ok {
+				return
+			}
+			updates["avatar"] = avatar
+		}
+
+		var user models.User
+		if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		if len(updates) > 0 {
+			if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+				return
+			}
+			hub.UpdateProfile(username, user.DisplayName, user.Avatar)
+		}
+		c.JSON(http.StatusOK, gin.H{"user": newProfileResponse(user)})
+	}
+}
+
+// avatarURL 校验头像地址必须是本人上传的个人图片，返回原图的规范地址；校验失败时已写入 400
+func avatarURL(c *gin.Context, username, raw string) (string, bool) {
+	if raw == "" {
+		return "", true
+	}
+	key, ok := uploads.KeyFromURL(raw)
+	if ok {
+		upload, found := uploads.Lookup(key)
+		if found && upload.Uploader == username && upload.RoomID == "" {
+			// 选中的是缩略图或 WebP 变体时，记录原图
+			if upload.OriginalKey != "" {
+				key = upload.OriginalKey
+			}
+			return "/uploads/" + key, true
+		}
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": "头像必须是本人上传的图片（上传时不要指定房间）"})
+	return "", false
+}
+
+// PasswordInput 修改密码的请求体
+type PasswordInput struct {
+	OldPassword string `json:"old_password" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword 校验旧密码后设置新密码，并让其他设备上的登录全部失效。
+// 旧密码校验与登录一样计入失败次数，锁定期间直接返回 429
+// POST /api/me/password
+func ChangePassword(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		var input PasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if len(input.NewPassword) < minPasswordLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "新密码至少 6 位"})
+			return
+		}
+
+		var user models.User
+		if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		// 与登录共用失败计数，防止拿到访问令牌后借此暴力猜测密码
+		ip := c.ClientIP()
+		if wait := loginLockRemaining(userSubject(username), ipSubject(ip)); wait > 0 {
+			writeLoginLocked(c, wait)
+			return
+		}
+		attempt, wait := beginLoginAttempt(username, ip)
+		if wait > 0 {
+			writeLoginLocked(c, wait)
+			return
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.OldPassword)); err != nil {
+			attempt.fail()
+			c.JSON(http.StatusBadRequest, gin.H{"error": "原密码错误"})
+			return
+		}
+		attempt.succeed()
+		hashed, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "密码加密失败"})
+			return
+		}
+		if err := database.DB.Model(&user).Update("password", string(hashed)).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		current, _ := getAuthSessionID(c)
+		revokeUserSessions(hub, username, current, "密码已修改，请重新登录")
+		c.JSON(http.StatusOK, gin.H{"message": "密码已修改"})
+	}
+}
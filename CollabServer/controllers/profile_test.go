@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestUpdateMeAvatarMustBeOwnPersonalUpload(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	tokens := loginAs(t, r, "alice", "secret123")
+	database.DB.Create(&models.Upload{StorageKey: "own.png", Uploader: "alice"})
+	database.DB.Create(&models.Upload{StorageKey: "own_thumb.webp", Uploader: "alice", OriginalKey: "own.png"})
+	database.DB.Create(&models.Upload{StorageKey: "room.png", Uploader: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.Upload{StorageKey: "bob.png", Uploader: "bob"})
+
+	cases := []struct {
+		name     string
+		avatar   string
+		wantCode int
+		want     string
+	}{
+		{"own upload", "/uploads/own.png", http.StatusOK, "/uploads/own.png"},
+		{"signed absolute link", "https://collab.example.com/uploads/own.png?v=1&exp=1&sig=x", http.StatusOK, "/uploads/own.png"},
+		{"variant records original", "/uploads/own_thumb.webp", http.StatusOK, "/uploads/own.png"},
+		{"room upload", "/uploads/room.png", http.StatusBadRequest, ""},
+		{"someone else's upload", "/uploads/bob.png", http.StatusBadRequest, ""},
+		{"unknown key", "/uploads/missing.png", http.StatusBadRequest, ""},
+		{"external url", "https://example.com/a.png", http.StatusBadRequest, ""},
+		{"remove", "", http.StatusOK, ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("avatar", "/uploads/previous.png")
+			w := doJSON(r, http.MethodPatch, "/api/me", fmt.Sprintf(`{"avatar":%q}`, tc.avatar), tokens.Token)
+			if w.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d %s", tc.wantCode, w.Code, w.Body.String())
+			}
+			var user models.User
+			database.DB.Where("username = ?", "alice").First(&user)
+			want := tc.want
+			if tc.wantCode != http.StatusOK {
+				want = "/uploads/previous.png"
+			}
+			if user.Avatar != want {
+				t.Fatalf("expected avatar %q, got %q", want, user.Avatar)
+			}
+		})
+	}
+
+	// 只修改显示名时保留头像
+	database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("avatar", "/uploads/own.png")
+	w := doJSON(r, http.MethodPatch, "/api/me", `{"display_name":"  Alice  "}`, tokens.Token)
+	var resp struct {
+		User profileResponse `json:"user"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusOK || resp.User.DisplayName != "Alice" || resp.User.Avatar != "/uploads/own.png" || resp.User.AvatarURL == "" {
+		t.Fatalf("unexpected profile %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	laptop := loginAs(t, r, "alice", "secret123")
+	phone := loginAs(t, r, "alice", "secret123")
+
+	if w := doJSON(r, http.MethodPost, "/api/me/password", `{"old_password":"secret123","new_password":"short"}`, laptop.Token); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected short password to be rejected, got %d", w.Code)
+	}
+	w := doJSON(r, http.MethodPost, "/api/me/password", `{"old_password":"secret123","new_password":"changed456"}`, laptop.Token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("change password: %d %s", w.Code, w.Body.String())
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/me", "", laptop.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected the current session to stay signed in, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/me", "", phone.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected other sessions to be revoked, got %d", w.Code)
+	}
+	if _, code := refresh(r, phone.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("expected other refresh tokens to be revoked, got %d", code)
+	}
+	if code, _, _ := loginStatus(r, "alice", "secret123"); code != http.StatusUnauthorized {
+		t.Fatalf("expected old password to stop working, got %d", code)
+	}
+	loginAs(t, r, "alice", "changed456")
+}
+
+func TestChangePasswordIsThrottled(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	tokens := loginAs(t, r, "alice", "secret123")
+
+	change := func(old string) (int, string) {
+		w := doJSON(r, http.MethodPost, "/api/me/password", fmt.Sprintf(`{"old_password":%q,"new_password":"changed456"}`, old), tokens.Token)
+		return w.Code, w.Header().Get("Retry-After")
+	}
+	for i := 1; i <= loginFreeAttempts+1; i++ {
+		if code, _ := change("wrong"); code != http.StatusBadRequest {
+			t.Fatalf("attempt %d: expected 400, got %d", i, code)
+		}
+	}
+	// 与登录共用计数：退避期间正确的旧密码也不再校验，登录同样被拒绝
+	if code, retryAfter := change("secret123"); code != http.StatusTooManyRequests || retryAfter != "2" {
+		t.Fatalf("expected 429 with Retry-After 2, got %d %q", code, retryAfter)
+	}
+	if code, _, _ := loginStatus(r, "alice", "secret123"); code != http.StatusTooManyRequests {
+		t.Fatalf("expected login to share the backoff, got %d", code)
+	}
+
+	unlockSubject(userSubject("alice"), "admin")
+	if code, _ := change("secret123"); code != http.StatusOK {
+		t.Fatalf("expected change to succeed after unlock, got %d", code)
+	}
+	var throttles int64
+	database.DB.Model(&models.LoginThrottle{}).Where("subject = ?", userSubject("alice")).Count(&throttles)
+	if throttles != 0 {
+		t.Fatal("expected a successful check to clear the failure count")
+	}
+}
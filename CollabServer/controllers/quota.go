@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// =============================================================================
+// 存储配额
+// =============================================================================
+// StorageUsage 按用户和房间累计上传占用：附件按逻辑大小计（内容去重不减免），
+// 图片计入原图与全部缩略图/WebP 变体。上传前 checkQuota 校验，写入后 addUsage 累加；
+// 计数器在启动时由 RecalculateStorageUsage 按附件与图片记录重算，漂移可自愈。
+// 配额为 0 表示不限制。
+// =============================================================================
+
+const (
+	usageScopeUser = "user"
+	usageScopeRoom = "room"
+)
+
+// quotaLimit 返回配额字节数（QUOTA_USER_MB 默认 1024，QUOTA_ROOM_MB 默认 2048）
+func quotaLimit(scope string) int64 {
+	if scope == usageScopeRoom {
+		return int64(config.GetEnvInt("QUOTA_ROOM_MB", 2048)) * 1024 * 1024
+	}
+	return int64(config.GetEnvInt("QUOTA_USER_MB", 1024)) * 1024 * 1024
+}
+
+// QuotaExceededError 表示本次上传会超出配额
+type QuotaExceededError struct {
+	Scope    string
+	Limit    int64
+	Used     int64
+	Incoming int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	name := "个人"
+	if e.Scope == usageScopeRoom {
+		name = "房间"
+	}
+	return fmt.Sprintf("存储空间不足：%s配额 %s，已用 %s，本次上传 %s", name, formatBytes(e.Limit), formatBytes(e.Used), formatBytes(e.Incoming))
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1fGB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", n)
+}
+
+func loadUsage(scope, owner string) models.StorageUsage {
+	usage := models.StorageUsage{Scope: scope, Owner: owner}
+	database.DB.Where("scope = ? AND owner = ?", scope, owner).First(&usage)
+	return usage
+}
+
+// checkQuota 校验用户（以及房间，若有）再写入 incoming 字节后是否超出配额
+// 校验与累加不在同一事务内，并发上传可能略微超出，对小型部署足够
+func checkQuota(username, roomID string, incoming int64) error {
+	scopes := [][2]string{{usageScopeUser, username}}
+	if roomID != "" {
+		scopes = append(scopes, [2]string{usageScopeRoom, roomID})
+	}
+	for _, s := range scopes {
+		limit := quotaLimit(s[0])
+		if limit <= 0 {
+			continue
+		}
+		used := loadUsage(s[0], s[1]).Bytes
+		if used+incoming > limit {
+			return &QuotaExceededError{Scope: s[0], Limit: limit, Used: used, Incoming: incoming}
+		}
+	}
+	return nil
+}
+
+// respondQuotaError 在 err 为配额错误时写出 413 响应并返回 true
+func respondQuotaError(c *gin.Context, err error) bool {
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+	c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+		"error":       quotaErr.Error(),
+		"scope":       quotaErr.Scope,
+		"quota_bytes": quotaErr.Limit,
+		"used_bytes":  quotaErr.Used,
+	})
+	return true
+}
+
+// addUsage 累加用户与房间的占用，bytes/files 为负数表示释放
+func addUsage(username, roomID string, bytes, files int64) {
+	owners := [][2]string{{usageScopeUser, username}}
+	if roomID != "" {
+		owners = append(owners, [2]string{usageScopeRoom, roomID})
+	}
+	for _, o := range owners {
+		err := database.DB.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "scope"}, {Name: "owner"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"bytes":      gorm.Expr("MAX(bytes + ?, 0)", bytes),
+				"files":      gorm.Expr("MAX(files + ?, 0)", files),
+				"updated_at": gorm.Expr("CURRENT_TIMESTAMP"),
+			}),
+		}).Create(&models.StorageUsage{Scope: o[0], Owner: o[1], Bytes: max(bytes, 0), Files: max(files, 0)}).Error
+		if err != nil {
+			log.Printf("⚠️ 更新存储用量失败 (%s %s): %v", o[0], o[1], err)
+		}
+	}
+}
+
+type usageAggregate struct {
+	Owner string
+	Bytes int64
+	Files int64
+}
+
+// RecalculateStorageUsage 按未删除的附件与图片记录重算全部用量
+func RecalculateStorageUsage() error {
+	totals := map[[2]string]*models.StorageUsage{}
+	collect := func(scope string, rows []usageAggregate) {
+		for _, r := range rows {
+			if r.Owner == "" {
+				continue
+			}
+			key := [2]string{scope, r.Owner}
+			if totals[key] == nil {
+				totals[key] = &models.StorageUsage{Scope: scope, Owner: r.Owner}
+			}
+			totals[key].Bytes += r.Bytes
+			totals[key].Files += r.Files
+		}
+	}
+
+	for _, q := range []struct {
+		scope, column string
+	}{{usageScopeUser, "uploader"}, {usageScopeRoom, "room_id"}} {
+		var rows []usageAggregate
+		database.DB.Model(&models.Attachment{}).
+			Select(q.column + " AS owner, SUM(size) AS bytes, COUNT(*) AS files").
+			Group(q.column).Scan(&rows)
+		collect(q.scope, rows)
+
+		rows = nil
+		database.DB.Model(&models.Upload{}).
+			Select(q.column + " AS owner, SUM(size) AS bytes, SUM(CASE WHEN original_key = '' THEN 1 ELSE 0 END) AS files").
+			Group(q.column).Scan(&rows)
+		collect(q.scope, rows)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.StorageUsage{}).Error; err != nil {
+			return err
+		}
+		for _, usage := range totals {
+			if err := tx.Create(usage).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// usageReport 是一个用户或房间的用量与配额
+type usageReport struct {
+	Bytes      int64 `json:"bytes"`
+	Files      int64 `json:"files"`
+	QuotaBytes int64 `json:"quota_bytes"` // 0 表示不限制
+}
+
+func newUsageReport(scope, owner string) usageReport {
+	usage := loadUsage(scope, owner)
+	return usageReport{Bytes: usage.Bytes, Files: usage.Files, QuotaBytes: max(quotaLimit(scope), 0)}
+}
+
+// GetStorageUsage 返回当前用户的用量；带 ?room= 时同时返回该房间的用量
+func GetStorageUsage(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	response := gin.H{"user": newUsageReport(usageScopeUser, username)}
+	if roomID := c.Query("room"); roomID != "" {
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+		response["room"] = newUsageReport(usageScopeRoom, roomID)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// AdminStorageSummary 汇总全站存储占用：实际落盘大小、用量最高的用户与房间
+func AdminStorageSummary(c *gin.Context) {
+	var storedBytes, imageBytes int64
+	database.DB.Model(&models.StoredFile{}).Select("COALESCE(SUM(size), 0)").Scan(&storedBytes)
+	database.DB.Model(&models.Upload{}).Select("COALESCE(SUM(size), 0)").Scan(&imageBytes)
+
+	var topUsers, topRooms []models.StorageUsage
+	database.DB.Where("scope = ?", usageScopeUser).Order("bytes desc").Limit(20).Find(&topUsers)
+	database.DB.Where("scope = ?", usageScopeRoom).Order("bytes desc").Limit(20).Find(&topRooms)
+
+	c.JSON(http.StatusOK, gin.H{
+		"stored_bytes": storedBytes + imageBytes, // 去重后的实际占用
+		"file_bytes":   storedBytes,
+		"image_bytes":  imageBytes,
+		"quota": gin.H{
+			"user_bytes": max(quotaLimit(usageScopeUser), 0),
+			"room_bytes": max(quotaLimit(usageScopeRoom), 0),
+		},
+		"top_users": topUsers,
+		"top_rooms": topRooms,
+	})
+}
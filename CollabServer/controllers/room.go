@@ -0,0 +1,357 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListActiveRooms 返回当前有人在线的房间：公开房间对所有人可见，其余房间只对有权限的用户可见
+// GET /api/rooms/active
+func ListActiveRooms(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+
+		rooms := make([]websocket.ActiveRoom, 0)
+		for _, r := range hub.ActiveRooms() {
+			if !r.Public && !canAccessRoom(username, r.RoomID) {
+				continue
+			}
+			rooms = append(rooms, r)
+		}
+		c.JSON(http.StatusOK, gin.H{"rooms": rooms})
+	}
+}
+
+// RoomVisibilityInput 修改房间公开状态的请求体
+type RoomVisibilityInput struct {
+	Public bool `json:"public"`
+}
+
+// SetRoomVisibility 设置房间是否出现在公开的活跃房间目录中（默认不公开），仅房间创建者或管理员可操作
+// PUT /api/rooms/:id/visibility
+func SetRoomVisibility(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := c.Param("id")
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+
+		var input RoomVisibilityInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		room := ensureRoom(roomID)
+		if room.CreatedBy != username && !isAdmin(username) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有房间创建者可以修改公开状态"})
+			return
+		}
+		if err := database.DB.Model(&room).Update("public", input.Public).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		hub.SetRoomPublic(roomID, input.Public)
+		c.JSON(http.StatusOK, gin.H{"room": room})
+	}
+}
+
+// ensureRoom 返回房间设置，不存在时建档。创建者取最早进入房间的用户，而不是第一个调用接口的人，
+// 新建房间的调用方需先写入自己的访问记录
+func ensureRoom(roomID string) models.Room {
+	database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Room{RoomID: roomID, CreatedBy: roomFounder(roomID)})
+	var room models.Room
+	database.DB.Where("room_id = ?", roomID).First(&room)
+	return room
+}
+
+// roomFounder 返回最早进入房间的用户；房间没有访问记录时为空，只有管理员能管理
+func roomFounder(roomID string) string {
+	var history models.History
+	database.DB.Select("username").Where("room_id = ?", roomID).Order("id").Limit(1).Find(&history)
+	return history.Username
+}
+
+// BackfillRoomOwners 为旧版本留下、没有设置记录或创建者为空的房间补录创建者（最早进入房间的用户）
+func BackfillRoomOwners() (int64, error) {
+	now := time.Now()
+	created := database.DB.Exec(`INSERT INTO rooms (room_id, created_by, created_at, updated_at)
+		SELECT h.room_id, h.username, ?, ? FROM histories h
+		WHERE h.id IN (SELECT MIN(id) FROM histories GROUP BY room_id)
+			AND h.room_id NOT IN (SELECT room_id FROM rooms)`, now, now)
+	if created.Error != nil {
+		return 0, created.Error
+	}
+	updated := database.DB.Exec(`UPDATE rooms SET created_by = (
+			SELECT h.username FROM histories h WHERE h.room_id = rooms.room_id ORDER BY h.id LIMIT 1
+		) WHERE created_by = '' AND EXISTS (SELECT 1 FROM histories h WHERE h.room_id = rooms.room_id)`)
+	if updated.Error != nil {
+		return created.RowsAffected, updated.Error
+	}
+	return created.RowsAffected + updated.RowsAffected, nil
+}
+
+// maxRoomTags 是单个房间最多的标签数
+const maxRoomTags = 20
+
+// roomSummary 是房间列表中的一项
+type roomSummary struct {
+	RoomID      string    `json:"room_id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Public      bool      `json:"public"`
+	Tags        []string  `json:"tags" gorm:"-"`
+	LastVisited time.Time `json:"last_visited"`
+}
+
+// roomSummaryColumns 返回查询 roomSummary 的列，lastVisited 为 last_visited 的来源列
+func roomSummaryColumns(lastVisited string) string {
+	return "base.room_id, COALESCE(rooms.title, '') AS title, COALESCE(rooms.description, '') AS description, " +
+		"COALESCE(rooms.public, false) AS public, " + lastVisited + " AS last_visited"
+}
+
+// ListRooms 按标题、标签或文件夹筛选房间
+// GET /api/rooms?q=关键词&tag=设计&folder=3&limit=20&offset=0
+// 不带 folder 时范围是自己访问过的房间；带 folder 时是该文件夹中的房间
+func ListRooms(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	// base 是筛选范围：文件夹中的房间，或自己的访问记录
+	var query *gorm.DB
+	if folderParam := c.Query("folder"); folderParam != "" {
+		folder, ok := findFolder(c, username, folderParam)
+		if !ok {
+			return
+		}
+		// 团队文件夹中可能有自己没进入过的房间，只列出有权访问的
+		query = database.DB.Table("folder_rooms AS base").
+			Select(roomSummaryColumns("base.created_at")).
+			Where("base.folder_id = ? AND base.room_id IN (?)", folder.ID, accessibleRoomIDs(username))
+	} else {
+		query = database.DB.Table("histories AS base").
+			Select(roomSummaryColumns("base.updated_at")).
+			Where("base.username = ?", username)
+	}
+	query = query.Joins("LEFT JOIN rooms ON rooms.room_id = base.room_id").
+		Where("rooms.deleted_at IS NULL")
+
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := likePattern(q)
+		query = query.Where("(base.room_id LIKE ? ESCAPE '\\' OR rooms.title LIKE ? ESCAPE '\\' OR rooms.description LIKE ? ESCAPE '\\')", like, like, like)
+	}
+	if tag := normalizeTag(c.Query("tag")); tag != "" {
+		query = query.Where("base.room_id IN (?)", database.DB.Model(&models.RoomTag{}).Select("room_id").Where("tag = ?", tag))
+	}
+
+	var total int64
+	query.Count(&total)
+	var rooms []roomSummary
+	if err := query.Order("last_visited desc").Limit(limit).Offset(offset).Scan(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return
+	}
+	attachTags(rooms)
+	c.JSON(http.StatusOK, gin.H{"rooms": rooms, "total": total, "limit": limit, "offset": offset})
+}
+
+// GetRoom 返回房间的标题、描述与标签
+// GET /api/rooms/:id
+func GetRoom(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	roomID := c.Param("id")
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+		return
+	}
+	room := ensureRoom(roomID)
+	c.JSON(http.StatusOK, gin.H{"room": room, "tags": roomTags(roomID)})
+}
+
+// RoomMetaInput 修改房间信息的请求体，未提供的字段保持不变
+type RoomMetaInput struct {
+	Title       *string   `json:"title"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
+}
+
+// UpdateRoom 修改房间标题、描述与标签；标题变化会推送给房间内的在线成员
+// PATCH /api/rooms/:id
+func UpdateRoom(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := c.Param("id")
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+
+		var input RoomMetaInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		updates := map[string]interface{}{}
+		if input.Title != nil {
+			title := strings.TrimSpace(*input.Title)
+			if len([]rune(title)) > 200 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "标题不能超过 200 字"})
+				return
+			}
+			updates["title"] = title
+		}
+		if input.Description != nil {
+			description := strings.TrimSpace(*input.Description)
+			if len([]rune(description)) > 1000 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "描述不能超过 1000 字"})
+				return
+			}
+			updates["description"] = description
+		}
+		var tags []string
+		if input.Tags != nil {
+			seen := map[string]bool{}
+			for _, t := range *input.Tags {
+				tag := normalizeTag(t)
+				if tag == "" || seen[tag] {
+					continue
+				}
+				if len([]rune(tag)) > 30 {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "单个标签不能超过 30 字"})
+					return
+				}
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+			if len(tags) > maxRoomTags {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("标签不能超过 %d 个", maxRoomTags)})
+				return
+			}
+		}
+
+		room := ensureRoom(roomID)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if len(updates) > 0 {
+				if err := tx.Model(&room).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			if input.Tags == nil {
+				return nil
+			}
+			if err := tx.Where("room_id = ?", roomID).Delete(&models.RoomTag{}).Error; err != nil {
+				return err
+			}
+			for _, tag := range tags {
+				if err := tx.Create(&models.RoomTag{RoomID: roomID, Tag: tag}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+
+		if input.Title != nil {
+			hub.SetRoomTitle(roomID, room.Title)
+		}
+		c.JSON(http.StatusOK, gin.H{"room": room, "tags": roomTags(roomID)})
+	}
+}
+
+// ListRoomTags 返回当前用户可访问房间中使用过的标签及次数
+// GET /api/rooms/tags
+func ListRoomTags(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	type tagCount struct {
+		Tag   string `json:"tag"`
+		Count int    `json:"count"`
+	}
+	var tags []tagCount
+	database.DB.Model(&models.RoomTag{}).
+		Select("tag, COUNT(*) AS count").
+		Where("room_id IN (?)", accessibleRoomIDs(username)).
+		Group("tag").Order("count desc, tag").
+		Scan(&tags)
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// normalizeTag 统一标签写法：去掉首尾空白与 #，英文转小写
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(tag), "#")))
+}
+
+func roomTags(roomID string) []string {
+	tags := []string{}
+	database.DB.Model(&models.RoomTag{}).Where("room_id = ?", roomID).Order("tag").Pluck("tag", &tags)
+	return tags
+}
+
+// attachTags 批量填充房间列表的标签
+func attachTags(rooms []roomSummary) {
+	if len(rooms) == 0 {
+		return
+	}
+	ids := make([]string, len(rooms))
+	for i, r := range rooms {
+		ids[i] = r.RoomID
+	}
+	var rows []models.RoomTag
+	database.DB.Where("room_id IN ?", ids).Order("tag").Find(&rows)
+	byRoom := map[string][]string{}
+	for _, row := range rows {
+		byRoom[row.RoomID] = append(byRoom[row.RoomID], row.Tag)
+	}
+	for i := range rooms {
+		rooms[i].Tags = byRoom[rooms[i].RoomID]
+		if rooms[i].Tags == nil {
+			rooms[i].Tags = []string{}
+		}
+	}
+}
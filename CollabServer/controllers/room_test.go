@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"net/http"
+	"testing"
+)
+
+func TestBackfillRoomOwnersUsesEarliestVisitor(t *testing.T) {
+	useTestDB(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "legacy"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "legacy"})
+	database.DB.Create(&models.History{Username: "carol", RoomID: "ownerless"})
+	database.DB.Create(&models.History{Username: "dave", RoomID: "ownerless"})
+	database.DB.Create(&models.Room{RoomID: "ownerless"})
+	database.DB.Create(&models.History{Username: "erin", RoomID: "owned"})
+	database.DB.Create(&models.Room{RoomID: "owned", CreatedBy: "frank"})
+
+	if n, err := BackfillRoomOwners(); err != nil || n != 2 {
+		t.Fatalf("expected 2 rooms to be backfilled, got %d, %v", n, err)
+	}
+	want := map[string]string{"legacy": "alice", "ownerless": "carol", "owned": "frank"}
+	for roomID, owner := range want {
+		var room models.Room
+		database.DB.Where("room_id = ?", roomID).First(&room)
+		if room.CreatedBy != owner {
+			t.Fatalf("%s: expected owner %q, got %q", roomID, owner, room.CreatedBy)
+		}
+	}
+	if n, err := BackfillRoomOwners(); err != nil || n != 0 {
+		t.Fatalf("expected backfill to be idempotent, got %d, %v", n, err)
+	}
+}
+
+func TestFirstCallerDoesNotBecomeOwnerOfLegacyRoom(t *testing.T) {
+	useTestDB(t)
+	hub := websocket.NewHub()
+	go hub.Run()
+	database.DB.Create(&models.History{Username: "alice", RoomID: "legacy"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "legacy"})
+
+	// bob 先调用删除接口，不能因为房间还没有设置记录就成为创建者
+	w := performRequest(DeleteRoom(hub), http.MethodDelete, "/api/rooms/:id", "/api/rooms/legacy", "", "bob")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-founder, got %d %s", w.Code, w.Body.String())
+	}
+	if room := ensureRoom("legacy"); room.CreatedBy != "alice" {
+		t.Fatalf("expected earliest visitor to own the room, got %q", room.CreatedBy)
+	}
+}
@@ -0,0 +1,329 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"html"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// 全文检索：/api/search?q=限流器&type=all&room=&sender=&from=&to=&limit=20&offset=0
+// =============================================================================
+// 基于 database.SetupSearchIndex 建立的 FTS5 trigram 索引：
+// - 所有查询词都 >= 3 个字符时走 MATCH，按 bm25 排序并用 snippet() 生成摘要
+// - 否则（如两个字的中文词）退化为 LIKE 子串匹配，按时间倒序，摘要在 Go 中截取
+// 结果只包含调用者访问过的房间。摘要中的命中词用 <mark> 包裹，其余内容已做 HTML 转义。
+// =============================================================================
+
+// 私有区字符作为 snippet() 的临时高亮标记，不会出现在正常文本中
+const (
+	searchMarkOpen  = "\uE000"
+	searchMarkClose = "\uE001"
+	snippetRunes    = 32
+)
+
+// SearchResult 是一条检索命中
+type SearchResult struct {
+	Type      string    `json:"type"` // document 或 message
+	RoomID    string    `json:"room_id"`
+	MessageID uint      `json:"message_id,omitempty"`
+	Sender    string    `json:"sender,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Time      time.Time `json:"time"`
+	Rank      float64   `json:"rank"`
+}
+
+type searchFilter struct {
+	Username string
+	Terms    []string
+	UseFTS   bool
+	RoomID   string
+	Sender   string
+	From     time.Time
+	To       time.Time
+	Limit    int
+	Offset   int
+}
+
+// Search 在文档和聊天记录中做全文检索
+func Search(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	terms := strings.Fields(c.Query("q"))
+	if len(terms) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入搜索关键词"})
+		return
+	}
+
+	filter := searchFilter{
+		Username: username,
+		Terms:    terms,
+		UseFTS:   true,
+		RoomID:   strings.TrimSpace(c.Query("room")),
+		Sender:   strings.TrimSpace(c.Query("sender")),
+	}
+	for _, term := range terms {
+		if utf8.RuneCountInString(term) < 3 {
+			filter.UseFTS = false
+		}
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 参数非法，应为 RFC3339 或 YYYY-MM-DD"})
+		return
+	}
+	if filter.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to 参数非法，应为 RFC3339 或 YYYY-MM-DD"})
+		return
+	}
+
+	filter.Limit, _ = strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if filter.Limit <= 0 || filter.Limit > 100 {
+		filter.Limit = 20
+	}
+	filter.Offset, _ = strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+
+	searchType := c.DefaultQuery("type", "all")
+	response := gin.H{"query": c.Query("q")}
+
+	// 文档没有发送者，按 sender 过滤时只搜聊天
+	if (searchType == "all" || searchType == "documents") && filter.Sender == "" {
+		docs, err := searchDocuments(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检索文档失败"})
+			return
+		}
+		response["documents"] = docs
+	}
+	if searchType == "all" || searchType == "messages" {
+		msgs, err := searchMessages(filter)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "检索聊天记录失败"})
+			return
+		}
+		response["messages"] = msgs
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ftsQuery 把每个查询词转成带引号的短语，多个词之间是 AND 关系
+func ftsQuery(terms []string) string {
+	quoted := make([]string, 0, len(terms))
+	for _, term := range terms {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func likePattern(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(term) + "%"
+}
+
+// applyTextMatch 根据是否走 FTS 添加 MATCH 或 LIKE 条件
+func applyTextMatch(query *gorm.DB, table string, filter searchFilter) *gorm.DB {
+	if filter.UseFTS {
+		return query.Where(table+" MATCH ?", ftsQuery(filter.Terms))
+	}
+	for _, term := range filter.Terms {
+		query = query.Where(table+".content LIKE ? ESCAPE '\\'", likePattern(term))
+	}
+	return query
+}
+
+func searchDocuments(filter searchFilter) ([]SearchResult, error) {
+	type row struct {
+		RoomID    string
+		Snippet   string
+		Content   string
+		Rank      float64
+		UpdatedAt time.Time
+	}
+
+	columns := "documents_fts.room_id AS room_id, d.updated_at AS updated_at, "
+	if filter.UseFTS {
+		columns += "snippet(documents_fts, 1, ?, ?, '…', 16) AS snippet, bm25(documents_fts) AS rank"
+	} else {
+		columns += "documents_fts.content AS content, 0 AS rank"
+	}
+
+	query := database.DB.Table("documents_fts").
+		Joins("JOIN documents d ON d.id = documents_fts.rowid").
+		Where("d.room_id IN (?) AND d.deleted_at IS NULL", accessibleRoomIDs(filter.Username))
+	if filter.UseFTS {
+		query = query.Select(columns, searchMarkOpen, searchMarkClose).Order("rank")
+	} else {
+		query = query.Select(columns).Order("d.updated_at desc")
+	}
+	query = applyTextMatch(query, "documents_fts", filter)
+	if filter.RoomID != "" {
+		query = query.Where("d.room_id = ?", filter.RoomID)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("d.updated_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("d.updated_at < ?", filter.To)
+	}
+
+	var rows []row
+	if err := query.Limit(filter.Limit).Offset(filter.Offset).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, r := range rows {
+		snippet := r.Snippet
+		if !filter.UseFTS {
+			snippet = markTerms(r.Content, filter.Terms)
+		}
+		results = append(results, SearchResult{
+			Type:    "document",
+			RoomID:  r.RoomID,
+			Snippet: highlightSnippet(snippet),
+			Time:    r.UpdatedAt,
+			Rank:    r.Rank,
+		})
+	}
+	return results, nil
+}
+
+func searchMessages(filter searchFilter) ([]SearchResult, error) {
+	type row struct {
+		ID        uint
+		RoomID    string
+		Sender    string
+		Snippet   string
+		Content   string
+		Rank      float64
+		CreatedAt time.Time
+	}
+
+	columns := "m.id AS id, m.room_id AS room_id, m.sender AS sender, m.created_at AS created_at, "
+	if filter.UseFTS {
+		columns += "snippet(messages_fts, 2, ?, ?, '…', 16) AS snippet, bm25(messages_fts) AS rank"
+	} else {
+		columns += "messages_fts.content AS content, 0 AS rank"
+	}
+
+	query := database.DB.Table("messages_fts").
+		Joins("JOIN messages m ON m.id = messages_fts.rowid").
+		Where("m.room_id IN (?) AND m.deleted_at IS NULL", accessibleRoomIDs(filter.Username))
+	if filter.UseFTS {
+		query = query.Select(columns, searchMarkOpen, searchMarkClose).Order("rank")
+	} else {
+		query = query.Select(columns).Order("m.id desc")
+	}
+	query = applyTextMatch(query, "messages_fts", filter)
+	if filter.RoomID != "" {
+		query = query.Where("m.room_id = ?", filter.RoomID)
+	}
+	if filter.Sender != "" {
+		query = query.Where("m.sender = ?", filter.Sender)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("m.created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("m.created_at < ?", filter.To)
+	}
+
+	var rows []row
+	if err := query.Limit(filter.Limit).Offset(filter.Offset).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult, 0, len(rows))
+	for _, r := range rows {
+		snippet := r.Snippet
+		if !filter.UseFTS {
+			snippet = markTerms(r.Content, filter.Terms)
+		}
+		results = append(results, SearchResult{
+			Type:      "message",
+			RoomID:    r.RoomID,
+			MessageID: r.ID,
+			Sender:    r.Sender,
+			Snippet:   highlightSnippet(snippet),
+			Time:      r.CreatedAt,
+			Rank:      r.Rank,
+		})
+	}
+	return results, nil
+}
+
+// markTerms 在 LIKE 模式下截取第一个命中词附近的文字，并用标记符包裹所有命中词
+func markTerms(text string, terms []string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	lower := []rune(strings.ToLower(string(runes)))
+
+	first := -1
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		t := []rune(strings.ToLower(term))
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if string(lower[i:i+len(t)]) == string(t) {
+				spans = append(spans, span{i, i + len(t)})
+				if first < 0 || i < first {
+					first = i
+				}
+			}
+		}
+	}
+	if first < 0 {
+		first = 0
+	}
+
+	start, end := first-snippetRunes/2, first+snippetRunes
+	prefix, suffix := "…", "…"
+	if start <= 0 {
+		start, prefix = 0, ""
+	}
+	if end >= len(runes) {
+		end, suffix = len(runes), ""
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	for i := start; i < end; i++ {
+		for _, s := range spans {
+			if s.start == i {
+				b.WriteString(searchMarkOpen)
+				break
+			}
+		}
+		b.WriteRune(runes[i])
+		for _, s := range spans {
+			if s.end == i+1 {
+				b.WriteString(searchMarkClose)
+				break
+			}
+		}
+	}
+	b.WriteString(suffix)
+	return b.String()
+}
+
+// highlightSnippet 先转义 HTML，再把标记符替换为 <mark>，保证摘要可以安全渲染
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(strings.Join(strings.Fields(snippet), " "))
+	escaped = strings.ReplaceAll(escaped, searchMarkOpen, "<mark>")
+	return strings.ReplaceAll(escaped, searchMarkClose, "</mark>")
+}
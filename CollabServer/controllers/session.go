@@ -0,0 +1,318 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// =============================================================================
+// 登录会话：短期访问令牌 + 轮换的刷新令牌
+// =============================================================================
+// 登录时创建一条 Session，返回访问令牌（JWT，ACCESS_TOKEN_TTL_MINUTES，默认 15 分钟）
+// 与刷新令牌（随机串，REFRESH_TOKEN_TTL_DAYS，默认 30 天）。数据库只保存刷新令牌的摘要。
+// - 访问令牌带 sid，JWTAuth 与 WebSocket 握手都会确认会话仍然有效，吊销后立即失效
+// - 每次 /refresh 都换发新的刷新令牌；已被换掉的旧令牌再次出现时整个会话被吊销
+// - 修改或重置密码、禁用或删除账号时吊销相关会话
+// =============================================================================
+
+// RefreshInput 刷新令牌的请求体
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func accessTokenTTL() time.Duration {
+	return time.Duration(config.GetEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15)) * time.Minute
+}
+
+func refreshTokenTTL() time.Duration {
+	return time.Duration(config.GetEnvInt("REFRESH_TOKEN_TTL_DAYS", 30)) * 24 * time.Hour
+}
+
+// newRefreshToken 生成刷新令牌，返回令牌本身与存库用的摘要
+func newRefreshToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// signAccessToken 签发指向 session 的访问令牌
+func signAccessToken(user models.User, session models.Session) (string, error) {
+	jwtSecret := config.GetEnv("JWT_SECRET", "")
+	if jwtSecret == "" {
+		return "", errors.New("服务器未配置密钥，无法签发 Token")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"userId":   user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+		"sid":      session.ID,
+		"exp":      time.Now().Add(accessTokenTTL()).Unix(),
+	})
+	return token.SignedString([]byte(jwtSecret))
+}
+
+// tokenResponse 是登录与刷新接口共同的响应，token 字段名沿用旧版本
+func tokenResponse(user models.User, accessToken, refreshToken string) gin.H {
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(accessTokenTTL().Seconds()),
+		"username":      user.Username,
+		"userId":        user.ID,
+	}
+}
+
+// clientType 判断登录来自桌面客户端还是浏览器：优先使用 X-Client-Type 请求头，
+// 否则根据 Origin 识别 Wails 客户端（wails.localhost）
+func clientType(c *gin.Context) string {
+	switch strings.ToLower(c.GetHeader("X-Client-Type")) {
+	case "desktop":
+		return "desktop"
+	case "browser":
+		return "browser"
+	}
+	if origin, err := url.Parse(c.GetHeader("Origin")); err == nil {
+		if host := origin.Hostname(); host == "wails.localhost" || strings.HasSuffix(host, ".wails.localhost") {
+			return "desktop"
+		}
+	}
+	return "browser"
+}
+
+// userAgent 返回截断到字段长度以内的 User-Agent
+func userAgent(c *gin.Context) string {
+	ua := c.Request.UserAgent()
+	if len(ua) > 500 {
+		ua = ua[:500]
+	}
+	return ua
+}
+
+// startSession 为登录成功的用户创建会话并签发两种令牌，同时记录登录设备
+func startSession(c *gin.Context, user models.User) (gin.H, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := models.Session{
+		UserID:      user.ID,
+		Username:    user.Username,
+		RefreshHash: hash,
+		ExpiresAt:   now.Add(refreshTokenTTL()),
+		UserAgent:   userAgent(c),
+		IP:          c.ClientIP(),
+		ClientType:  clientType(c),
+		LastSeenAt:  now,
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	accessToken, err := signAccessToken(user, session)
+	if err != nil {
+		return nil, err
+	}
+	return tokenResponse(user, accessToken, refreshToken), nil
+}
+
+// Refresh 用刷新令牌换取新的访问令牌，同时轮换刷新令牌
+// POST /refresh
+func Refresh(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input RefreshInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hash := hashRefreshToken(input.RefreshToken)
+
+		var session models.Session
+		if err := database.DB.Where("refresh_hash = ?", hash).First(&session).Error; err != nil {
+			// 已轮换掉的令牌被再次使用，说明令牌可能被盗，吊销整个会话
+			if database.DB.Where("previous_hash = ? AND revoked_at IS NULL", hash).First(&session).Error == nil {
+				revokeSession(hub, session.ID, "检测到登录凭证被重复使用，请重新登录")
+			}
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录"})
+			return
+		}
+		var user models.User
+		if session.RevokedAt != nil || session.ExpiresAt.Before(time.Now()) ||
+			database.DB.Where("username = ? AND disabled = ?", session.Username, false).First(&user).Error != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录"})
+			return
+		}
+
+		refreshToken, newHash, err := newRefreshToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Token 生成失败"})
+			return
+		}
+		if !rotateSession(c, session.ID, hash, newHash) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录"})
+			return
+		}
+		accessToken, err := signAccessToken(user, session)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, tokenResponse(user, accessToken, refreshToken))
+	}
+}
+
+// rotateSession 以旧摘要为条件换成新的刷新令牌摘要，并发刷新同一令牌时只有一个请求成功
+func rotateSession(c *gin.Context, sessionID uint, oldHash, newHash string) bool {
+	result := database.DB.Model(&models.Session{}).
+		Where("id = ? AND refresh_hash = ?", sessionID, oldHash).
+		Updates(map[string]interface{}{
+			"refresh_hash":  newHash,
+			"previous_hash": oldHash,
+			"expires_at":    time.Now().Add(refreshTokenTTL()),
+			"last_seen_at":  time.Now(),
+			"ip":            c.ClientIP(),
+			"user_agent":    userAgent(c),
+		})
+	return result.Error == nil && result.RowsAffected > 0
+}
+
+// Logout 吊销当前会话，并断开该会话建立的 WebSocket 连接
+// POST /logout
+func Logout(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, ok := getAuthSessionID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		revokeSession(hub, sessionID, "已退出登录")
+		c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+	}
+}
+
+// LogoutAll 吊销当前用户的全部会话（所有设备都需要重新登录）
+// POST /logout/all
+func LogoutAll(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		count := revokeUserSessions(hub, username, 0, "已在所有设备上退出登录")
+		c.JSON(http.StatusOK, gin.H{"message": "已在所有设备上退出登录", "revoked": count})
+	}
+}
+
+// sessionView 是会话列表中的一项，current 标记发起请求的会话
+type sessionView struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+// ListSessions 列出当前用户仍然有效的登录会话，最近活跃的排在前面
+// GET /api/sessions
+func ListSessions(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	current, _ := getAuthSessionID(c)
+
+	var sessions []models.Session
+	database.DB.Where("username = ? AND revoked_at IS NULL AND expires_at > ?", username, time.Now()).
+		Order("last_seen_at desc").Find(&sessions)
+	items := make([]sessionView, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, sessionView{Session: s, Current: s.ID == current})
+	}
+	c.JSON(http.StatusOK, gin.H{"sessions": items})
+}
+
+// RevokeSession 吊销自己的某个会话，该设备需要重新登录；吊销当前会话等同于退出登录
+// DELETE /api/sessions/:id
+func RevokeSession(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		var session models.Session
+		id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil || database.DB.Where("id = ? AND username = ? AND revoked_at IS NULL", id, username).First(&session).Error != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "会话不存在"})
+			return
+		}
+		revokeSession(hub, session.ID, "该设备的登录已被移除")
+		c.JSON(http.StatusOK, gin.H{"message": "已移除该设备的登录"})
+	}
+}
+
+// getAuthSessionID 返回 JWTAuth 写入的会话 ID
+func getAuthSessionID(c *gin.Context) (uint, bool) {
+	raw, exists := c.Get("sessionId")
+	if !exists {
+		return 0, false
+	}
+	id, ok := raw.(uint)
+	return id, ok && id > 0
+}
+
+// revokeSession 吊销单个会话并断开其连接
+func revokeSession(hub *websocket.Hub, sessionID uint, reason string) {
+	database.DB.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", time.Now())
+	hub.DisconnectSession(sessionID, reason)
+}
+
+// revokeUserSessions 吊销用户除 keep 以外的全部会话（keep 为 0 时全部吊销），返回吊销的数量
+func revokeUserSessions(hub *websocket.Hub, username string, keep uint, reason string) int {
+	var ids []uint
+	database.DB.Model(&models.Session{}).Where("username = ? AND revoked_at IS NULL AND id <> ?", username, keep).Pluck("id", &ids)
+	if len(ids) == 0 {
+		return 0
+	}
+	database.DB.Model(&models.Session{}).Where("id IN ?", ids).Update("revoked_at", time.Now())
+	if keep == 0 {
+		hub.DisconnectUser(username, reason)
+		return len(ids)
+	}
+	for _, id := range ids {
+		hub.DisconnectSession(id, reason)
+	}
+	return len(ids)
+}
+
+// RunSessionCleanup 按固定间隔删除已过期或已吊销的会话，以及已过统计窗口且未锁定的登录失败记录
+func RunSessionCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		database.DB.Where("revoked_at IS NOT NULL OR expires_at < ?", now).Delete(&models.Session{})
+		database.DB.Where("last_failure < ? AND locked_until < ?", now.Add(-loginLockoutDuration()), now).Delete(&models.LoginThrottle{})
+	}
+}
@@ -0,0 +1,257 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/middleware"
+	"collab-server/models"
+	"collab-server/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// sessionRouter 挂载登录、刷新与会话管理接口，受保护的接口经过真实的 JWTAuth
+func sessionRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	useTestDB(t)
+	t.Setenv("JWT_SECRET", "test-jwt-secret")
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	r := gin.New()
+	r.POST("/login", Login)
+	r.POST("/refresh", Refresh(hub))
+	auth := r.Group("/", middleware.JWTAuth())
+	auth.GET("/api/me", GetMe)
+	auth.PATCH("/api/me", UpdateMe(hub))
+	auth.POST("/api/me/password", ChangePassword(hub))
+	auth.POST("/logout", Logout(hub))
+	auth.GET("/api/sessions", ListSessions)
+	auth.DELETE("/api/sessions/:id", RevokeSession(hub))
+	return r
+}
+
+func createTestUser(t *testing.T, username, password string) {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Create(&models.User{Username: username, Password: string(hash), Role: "user"}).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func doJSON(r *gin.Engine, method, target, body, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+type testTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func loginAs(t *testing.T, r *gin.Engine, username, password string) testTokens {
+	t.Helper()
+	w := doJSON(r, http.MethodPost, "/login", fmt.Sprintf(`{"username":%q,"password":%q}`, username, password), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login %s: %d %s", username, w.Code, w.Body.String())
+	}
+	var tokens testTokens
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	return tokens
+}
+
+func refresh(r *gin.Engine, refreshToken string) (testTokens, int) {
+	w := doJSON(r, http.MethodPost, "/refresh", fmt.Sprintf(`{"refresh_token":%q}`, refreshToken), "")
+	var tokens testTokens
+	json.Unmarshal(w.Body.Bytes(), &tokens)
+	return tokens, w.Code
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	first := loginAs(t, r, "alice", "secret123")
+
+	second, code := refresh(r, first.RefreshToken)
+	if code != http.StatusOK || second.RefreshToken == "" || second.RefreshToken == first.RefreshToken {
+		t.Fatalf("expected a rotated refresh token, got %d %+v", code, second)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/me", "", second.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected refreshed access token to work, got %d", w.Code)
+	}
+	third, code := refresh(r, second.RefreshToken)
+	if code != http.StatusOK || third.RefreshToken == second.RefreshToken {
+		t.Fatalf("expected the new refresh token to rotate again, got %d", code)
+	}
+
+	var session models.Session
+	database.DB.First(&session)
+	if session.RefreshHash != hashRefreshToken(third.RefreshToken) || session.PreviousHash != hashRefreshToken(second.RefreshToken) {
+		t.Fatal("expected only hashes of the latest two tokens to be stored")
+	}
+}
+
+func TestRefreshReuseRevokesSession(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	first := loginAs(t, r, "alice", "secret123")
+	second, _ := refresh(r, first.RefreshToken)
+
+	// 已被换掉的令牌再次出现：拒绝并吊销整个会话
+	if _, code := refresh(r, first.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("expected reused token to be rejected, got %d", code)
+	}
+	if _, code := refresh(r, second.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("expected the current token to be revoked as well, got %d", code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/me", "", second.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected access token of the revoked session to stop working, got %d", w.Code)
+	}
+}
+
+func TestConcurrentRotationSucceedsOnce(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	tokens := loginAs(t, r, "alice", "secret123")
+	var session models.Session
+	database.DB.First(&session)
+	oldHash := hashRefreshToken(tokens.RefreshToken)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/refresh", nil)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if rotateSession(c, session.ID, oldHash, fmt.Sprintf("new-hash-%d", i)) {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if succeeded != 1 {
+		t.Fatalf("expected exactly one rotation to win, got %d", succeeded)
+	}
+	if _, code := refresh(r, tokens.RefreshToken); code != http.StatusUnauthorized {
+		t.Fatalf("expected the losing token to be rejected, got %d", code)
+	}
+}
+
+func TestSessionRevocationTakesEffectImmediately(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	tokens := loginAs(t, r, "alice", "secret123")
+
+	cases := []struct {
+		name   string
+		revoke func()
+	}{
+		{"logout", func() { doJSON(r, http.MethodPost, "/logout", "", tokens.Token) }},
+		{"disabled", func() { database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("disabled", true) }},
+		{"deleted", func() { database.DB.Where("username = ?", "alice").Delete(&models.User{}) }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			database.DB.Unscoped().Model(&models.User{}).Where("username = ?", "alice").
+				Updates(map[string]interface{}{"disabled": false, "deleted_at": nil})
+			tokens = loginAs(t, r, "alice", "secret123")
+			if w := doJSON(r, http.MethodGet, "/api/me", "", tokens.Token); w.Code != http.StatusOK {
+				t.Fatalf("expected fresh token to work, got %d", w.Code)
+			}
+			tc.revoke()
+			if w := doJSON(r, http.MethodGet, "/api/me", "", tokens.Token); w.Code != http.StatusUnauthorized {
+				t.Fatalf("expected token to be rejected after %s, got %d", tc.name, w.Code)
+			}
+		})
+	}
+}
+
+func TestListAndRevokeOnlyOwnSessions(t *testing.T) {
+	r := sessionRouter(t)
+	createTestUser(t, "alice", "secret123")
+	createTestUser(t, "bob", "secret123")
+	aliceLaptop := loginAs(t, r, "alice", "secret123")
+	alicePhone := loginAs(t, r, "alice", "secret123")
+	bob := loginAs(t, r, "bob", "secret123")
+
+	w := doJSON(r, http.MethodGet, "/api/sessions", "", aliceLaptop.Token)
+	var list struct {
+		Sessions []struct {
+			ID       uint   `json:"id"`
+			Username string `json:"username"`
+			Current  bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Sessions) != 2 {
+		t.Fatalf("expected alice to see her 2 sessions, got %s", w.Body.String())
+	}
+	current := 0
+	for _, s := range list.Sessions {
+		if s.Username != "alice" {
+			t.Fatalf("expected only alice's sessions, got %s", w.Body.String())
+		}
+		if s.Current {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Fatalf("expected exactly one current session, got %d", current)
+	}
+
+	var bobSession, phoneSession models.Session
+	database.DB.Where("refresh_hash = ?", hashRefreshToken(bob.RefreshToken)).First(&bobSession)
+	database.DB.Where("refresh_hash = ?", hashRefreshToken(alicePhone.RefreshToken)).First(&phoneSession)
+
+	cases := []struct {
+		name      string
+		sessionID uint
+		wantCode  int
+	}{
+		{"other user's session", bobSession.ID, http.StatusNotFound},
+		{"missing session", 9999, http.StatusNotFound},
+		{"own other device", phoneSession.ID, http.StatusOK},
+		{"already revoked", phoneSession.ID, http.StatusNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := doJSON(r, http.MethodDelete, fmt.Sprintf("/api/sessions/%d", tc.sessionID), "", aliceLaptop.Token)
+			if w.Code != tc.wantCode {
+				t.Fatalf("expected %d, got %d %s", tc.wantCode, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if w := doJSON(r, http.MethodGet, "/api/me", "", bob.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected bob's session to be untouched, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/me", "", alicePhone.Token); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected revoked device to be signed out, got %d", w.Code)
+	}
+	if w := doJSON(r, http.MethodGet, "/api/me", "", aliceLaptop.Token); w.Code != http.StatusOK {
+		t.Fatalf("expected current device to stay signed in, got %d", w.Code)
+	}
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/richtext"
+	"collab-server/storage"
+	"collab-server/uploads"
+	"collab-server/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TemplateInput 把房间保存为模板的请求体
+type TemplateInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Global      bool   `json:"global"` // 保存为全局模板，仅管理员可用
+}
+
+// InstantiateTemplateInput 从模板创建房间的请求体
+type InstantiateTemplateInput struct {
+	RoomID   string `json:"room_id" binding:"required"` // 新房间号，不能已存在
+	FromRoom string `json:"from_room"`                  // 可选：取该房间的在线成员作为 {{attendees}}
+}
+
+// ListTemplates 返回全局模板和当前用户的个人模板（不含正文）
+// GET /api/templates
+func ListTemplates(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	var templates []models.Template
+	database.DB.Omit("content").Where("owner = ? OR owner = ''", username).Order("owner, name").Find(&templates)
+	c.JSON(http.StatusOK, gin.H{"templates": templates})
+}
+
+// GetTemplate 返回单个模板（含正文），用于预览
+// GET /api/templates/:id
+func GetTemplate(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	tpl, ok := findTemplate(c, username)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"template": tpl})
+}
+
+// SaveRoomAsTemplate 把房间当前文档保存为模板
+// POST /api/rooms/:id/template
+func SaveRoomAsTemplate(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := c.Param("id")
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+
+		var input TemplateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		input.Name = strings.TrimSpace(input.Name)
+		if input.Name == "" || len([]rune(input.Name)) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "模板名称不能为空且不超过 100 字"})
+			return
+		}
+		if input.Global && !isAdmin(username) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以创建全局模板"})
+			return
+		}
+
+		content, live := hub.RoomContent(roomID)
+		if !live {
+			var doc models.Document
+			if err := database.DB.Where("room_id = ?", roomID).First(&doc).Error; err != nil {
+				c.JSON(http.StatusNotFound, gin.H{"error": "文档不存在"})
+				return
+			}
+			content = doc.Content
+		}
+
+		// 模板可能被他人使用，保存前去掉保存者自己都无权读取的图片
+		content = uploads.RewriteLinks(content, func(key string) (string, bool) {
+			upload, found := uploads.Lookup(key)
+			return key, canAccessUpload(username, upload, found)
+		})
+
+		tpl := models.Template{
+			Name:        input.Name,
+			Description: strings.TrimSpace(input.Description),
+			Content:     content,
+			Owner:       username,
+			CreatedBy:   username,
+		}
+		if input.Global {
+			tpl.Owner = ""
+		}
+		if err := database.DB.Create(&tpl).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模板失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"template": tpl})
+	}
+}
+
+// DeleteTemplate 删除个人模板；全局模板只有管理员可以删除
+// DELETE /api/templates/:id
+func DeleteTemplate(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	tpl, ok := findTemplate(c, username)
+	if !ok {
+		return
+	}
+	if tpl.Owner == "" && !isAdmin(username) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有管理员可以删除全局模板"})
+		return
+	}
+	database.DB.Delete(&tpl)
+	c.JSON(http.StatusOK, gin.H{"message": "已删除"})
+}
+
+// CreateRoomFromTemplate 用模板创建新房间，替换 {{date}}、{{room}}、{{attendees}} 变量
+// POST /api/templates/:id/rooms
+func CreateRoomFromTemplate(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		tpl, ok := findTemplate(c, username)
+		if !ok {
+			return
+		}
+
+		var input InstantiateTemplateInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		roomID := strings.TrimSpace(input.RoomID)
+		if roomID == "" || len(roomID) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "房间号不能为空且不超过 100 个字符"})
+			return
+		}
+		if roomExists(roomID) {
+			c.JSON(http.StatusConflict, gin.H{"error": "房间已存在"})
+			return
+		}
+
+		// 参会人取来源房间的在线成员（即 user_list），没有时只有创建者本人
+		attendees := []string{username}
+		if input.FromRoom != "" && canAccessRoom(username, input.FromRoom) {
+			if users := hub.RoomUsers(input.FromRoom); len(users) > 0 {
+				attendees = users
+			}
+		}
+
+		content := richtext.FillTemplate(tpl.Content, map[string]string{
+			"date":      time.Now().Format("2006-01-02"),
+			"room":      roomID,
+			"attendees": strings.Join(attendees, "、"),
+		})
+		database.DB.Create(&models.History{Username: username, RoomID: roomID, UpdatedAt: time.Now()})
+		ensureRoom(roomID)
+		content = copyTemplateImages(c.Request.Context(), content, tpl.CreatedBy, roomID, username)
+		hub.ReplaceDocument(roomID, content, username)
+
+		c.JSON(http.StatusOK, gin.H{"room_id": roomID, "template_id": tpl.ID})
+	}
+}
+
+// copyTemplateImages 把模板中的图片复制到新房间并改写为新 Key，新房间的成员因此只能读到副本。
+// 模板作者已无权读取、复制失败或超出配额的图片从内容中删除
+func copyTemplateImages(ctx context.Context, content, author, roomID, username string) string {
+	return uploads.RewriteLinks(content, func(key string) (string, bool) {
+		upload, found := uploads.Lookup(key)
+		if !canAccessUpload(author, upload, found) {
+			return "", false
+		}
+		newKey, err := copyUploadToRoom(ctx, upload, roomID, username)
+		if err != nil {
+			var quotaErr *QuotaExceededError
+			if !errors.As(err, &quotaErr) {
+				log.Printf("⚠️ 复制模板图片 %s 失败: %v", key, err)
+			}
+			return "", false
+		}
+		return newKey, true
+	})
+}
+
+// copyUploadToRoom 以新 Key 复制一份图片并记在 roomID 名下，计入 username 与房间的配额
+func copyUploadToRoom(ctx context.Context, upload models.Upload, roomID, username string) (string, error) {
+	if err := checkQuota(username, roomID, upload.Size); err != nil {
+		return "", err
+	}
+	r, obj, err := storage.Default.Get(ctx, upload.StorageKey)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+
+	key := fmt.Sprintf("%d%s", time.Now().UnixNano(), path.Ext(upload.StorageKey))
+	if err := storage.Default.Put(ctx, key, r, obj.Size, obj.ContentType); err != nil {
+		return "", err
+	}
+	copied := models.Upload{StorageKey: key, RoomID: roomID, Uploader: username, Size: obj.Size}
+	if err := database.DB.Create(&copied).Error; err != nil {
+		storage.Default.Delete(context.Background(), key)
+		return "", err
+	}
+	addUsage(username, roomID, obj.Size, 1)
+	return key, nil
+}
+
+// findTemplate 按路径参数查找当前用户可见的模板，找不到时已写入 404
+func findTemplate(c *gin.Context, username string) (models.Template, bool) {
+	var tpl models.Template
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || database.DB.Where("id = ? AND (owner = ? OR owner = '')", id, username).First(&tpl).Error != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return tpl, false
+	}
+	return tpl, true
+}
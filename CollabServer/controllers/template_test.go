@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/uploads"
+	"collab-server/websocket"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTemplatesDoNotCarryPrivateImages(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	hub := websocket.NewHub()
+	go hub.Run()
+
+	for _, key := range []string{"own.png", "foreign.png"} {
+		putTestObject(t, s, key)
+	}
+	database.DB.Create(&models.Upload{StorageKey: "own.png", RoomID: "room-1", Uploader: "alice", Size: 4})
+	database.DB.Create(&models.Upload{StorageKey: "foreign.png", RoomID: "room-2", Uploader: "carol", Size: 4})
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.Document{RoomID: "room-1", Content: `<p>图</p><img src="/uploads/own.png"><img src="/uploads/foreign.png">`})
+
+	w := performRequest(SaveRoomAsTemplate(hub), http.MethodPost, "/api/rooms/:id/template", "/api/rooms/room-1/template", `{"name":"周会"}`, "alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("save template: %d %s", w.Code, w.Body.String())
+	}
+	var tpl models.Template
+	database.DB.First(&tpl)
+	if strings.Contains(tpl.Content, "foreign.png") || !strings.Contains(tpl.Content, "/uploads/own.png") {
+		t.Fatalf("expected only readable images in template, got %q", tpl.Content)
+	}
+	// 模板中的图片引用应阻止孤儿清理
+	if refs, err := referencedUploadKeys(); err != nil || !refs["own.png"] {
+		t.Fatalf("expected template reference to be collected, got %v, %v", refs, err)
+	}
+
+	// 把模板改为全局，由另一个用户实例化
+	database.DB.Model(&tpl).Update("owner", "")
+	w = performRequest(CreateRoomFromTemplate(hub), http.MethodPost, "/api/templates/:id/rooms", "/api/templates/1/rooms", `{"room_id":"room-new"}`, "bob")
+	if w.Code != http.StatusOK {
+		t.Fatalf("create room: %d %s", w.Code, w.Body.String())
+	}
+	content, ok := hub.RoomContent("room-new")
+	if !ok {
+		var doc models.Document
+		database.DB.Where("room_id = ?", "room-new").First(&doc)
+		content = doc.Content
+	}
+	keys := uploads.Keys(content)
+	if len(keys) != 1 || keys[0] == "own.png" {
+		t.Fatalf("expected a fresh copy of own.png, got %v in %q", keys, content)
+	}
+	copied, found := uploads.Lookup(keys[0])
+	if !found || copied.RoomID != "room-new" || copied.Uploader != "bob" {
+		t.Fatalf("expected copy to belong to the new room, got %+v", copied)
+	}
+	if !canAccessUpload("bob", copied, found) {
+		t.Fatal("expected new room member to read the copy")
+	}
+	original, _ := uploads.Lookup("own.png")
+	if canAccessUpload("bob", original, true) {
+		t.Fatal("expected original image to stay private to room-1")
+	}
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/storage"
+	"collab-server/websocket"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// =============================================================================
+// 房间回收站
+// =============================================================================
+// 删除房间不会立即清除数据：房间、文档、聊天记录与附件用同一个时间戳软删除，
+// 在保留期（TRASH_RETENTION_DAYS，默认 30 天）内可以整体恢复，过期后由定时任务彻底清除。
+// 文档中的图片不在这里处理：彻底清除后它们不再被引用，由孤儿文件清理回收。
+// =============================================================================
+
+// trashedModels 是随房间一起进入回收站的数据
+var trashedModels = []interface{}{&models.Document{}, &models.Message{}, &models.Attachment{}}
+
+// trashEntry 是回收站中的一个房间
+type trashEntry struct {
+	models.Room
+	PurgeAt time.Time `json:"purge_at"`
+}
+
+func trashRetention() time.Duration {
+	return time.Duration(config.GetEnvInt("TRASH_RETENTION_DAYS", 30)) * 24 * time.Hour
+}
+
+// canManageTrashedRoom 判断用户能否恢复或彻底删除房间：删除者、创建者或管理员
+func canManageTrashedRoom(username string, room models.Room) bool {
+	return room.DeletedBy == username || room.CreatedBy == username || isAdmin(username)
+}
+
+// DeleteRoom 把房间移入回收站，在线成员会被断开
+// DELETE /api/rooms/:id
+func DeleteRoom(hub *websocket.Hub) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := getAuthUsername(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+			return
+		}
+		roomID := c.Param("id")
+		if !canAccessRoom(username, roomID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该房间"})
+			return
+		}
+		room := ensureRoom(roomID)
+		if room.CreatedBy != username && !isAdmin(username) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "只有房间创建者可以删除房间"})
+			return
+		}
+
+		// 先标记房间，阻止新的连接进入；再关闭房间把内存中的文档落盘，最后软删除内容
+		now := time.Now()
+		if err := database.DB.Model(&room).Updates(map[string]interface{}{"deleted_at": now, "deleted_by": username}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		hub.CloseRoom(roomID, "房间已被删除")
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, m := range trashedModels {
+				if err := tx.Model(m).Where("room_id = ?", roomID).Update("deleted_at", now).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("⚠️ 房间 %s 移入回收站失败: %v", roomID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+			return
+		}
+		addAttachmentUsage(roomTrashAttachments(roomID, now), -1)
+
+		c.JSON(http.StatusOK, gin.H{"message": "已移入回收站", "purge_at": now.Add(trashRetention())})
+	}
+}
+
+// ListTrash 返回自己删除或创建的、仍在回收站中的房间；管理员可用 ?all=true 查看全部
+// GET /api/trash
+func ListTrash(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	query := database.DB.Unscoped().Where("deleted_at IS NOT NULL")
+	if c.Query("all") != "true" || !isAdmin(username) {
+		query = query.Where("deleted_by = ? OR created_by = ?", username, username)
+	}
+	var rooms []models.Room
+	query.Order("deleted_at desc").Find(&rooms)
+
+	retention := trashRetention()
+	entries := make([]trashEntry, 0, len(rooms))
+	for _, r := range rooms {
+		entries = append(entries, trashEntry{Room: r, PurgeAt: r.DeletedAt.Time.Add(retention)})
+	}
+	c.JSON(http.StatusOK, gin.H{"rooms": entries})
+}
+
+// RestoreRoom 从回收站恢复房间及其文档、聊天记录与附件
+// POST /api/trash/:id/restore
+func RestoreRoom(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	room, ok := findTrashedRoom(c, username)
+	if !ok {
+		return
+	}
+
+	// 房间删除前单独删掉的附件时间更早，不会被一起恢复
+	deletedAt := room.DeletedAt.Time
+	attachments := roomTrashAttachments(room.RoomID, deletedAt)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, m := range trashedModels {
+			if err := tx.Unscoped().Model(m).Where("room_id = ? AND deleted_at >= ?", room.RoomID, deletedAt).Update("deleted_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Unscoped().Model(&room).Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": ""}).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "恢复失败"})
+		return
+	}
+	addAttachmentUsage(attachments, 1)
+	c.JSON(http.StatusOK, gin.H{"message": "已恢复", "room_id": room.RoomID})
+}
+
+// PurgeRoom 立即彻底删除回收站中的房间
+// DELETE /api/trash/:id
+func PurgeRoom(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	room, ok := findTrashedRoom(c, username)
+	if !ok {
+		return
+	}
+	if err := purgeRoom(c.Request.Context(), room.RoomID); err != nil {
+		log.Printf("⚠️ 彻底删除房间 %s 失败: %v", room.RoomID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已彻底删除"})
+}
+
+// findTrashedRoom 查找回收站中当前用户有权管理的房间，找不到时已写入响应
+func findTrashedRoom(c *gin.Context, username string) (models.Room, bool) {
+	var room models.Room
+	if err := database.DB.Unscoped().Where("room_id = ? AND deleted_at IS NOT NULL", c.Param("id")).First(&room).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该房间"})
+		return room, false
+	}
+	if !canManageTrashedRoom(username, room) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该房间"})
+		return room, false
+	}
+	return room, true
+}
+
+// roomTrashAttachments 返回随房间在 since 时刻一起移入回收站的附件
+func roomTrashAttachments(roomID string, since time.Time) []models.Attachment {
+	var attachments []models.Attachment
+	database.DB.Unscoped().Where("room_id = ? AND deleted_at >= ?", roomID, since).Find(&attachments)
+	return attachments
+}
+
+// addAttachmentUsage 移入回收站时扣除（sign = -1）、恢复时加回（sign = 1）附件占用的存储用量
+func addAttachmentUsage(attachments []models.Attachment, sign int64) {
+	for _, a := range attachments {
+		addUsage(a.Uploader, a.RoomID, sign*a.Size, sign)
+	}
+}
+
+// RunTrashPurge 按固定间隔彻底删除超过保留期的房间，interval <= 0 时不启用
+func RunTrashPurge(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		purgeDeletedAttachments(context.Background())
+		var roomIDs []string
+		database.DB.Unscoped().Model(&models.Room{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", time.Now().Add(-trashRetention())).
+			Pluck("room_id", &roomIDs)
+		for _, roomID := range roomIDs {
+			if err := purgeRoom(context.Background(), roomID); err != nil {
+				log.Printf("⚠️ 彻底删除房间 %s 失败: %v", roomID, err)
+				continue
+			}
+			log.Printf("🗑️ 房间 %s 超过保留期，已彻底删除", roomID)
+		}
+	}
+}
+
+// purgeRoom 物理删除房间的全部数据。附件文件按内容寻址共用，只有不再被任何附件引用时才删除
+func purgeRoom(ctx context.Context, roomID string) error {
+	var shas []string
+	database.DB.Unscoped().Model(&models.Attachment{}).Where("room_id = ?", roomID).Distinct().Pluck("file_sha256", &shas)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		messageIDs := tx.Unscoped().Model(&models.Message{}).Select("id").Where("room_id = ?", roomID)
+		if err := tx.Unscoped().Where("message_id IN (?)", messageIDs).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		for _, m := range []interface{}{
+			&models.MessageAudit{}, &models.Message{}, &models.Document{}, &models.DocumentVersion{}, &models.Attachment{},
+			&models.RoomTag{}, &models.FolderRoom{}, &models.History{}, &models.Notification{}, &models.Room{},
+		} {
+			if err := tx.Unscoped().Where("room_id = ?", roomID).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("scope = ? AND owner = ?", usageScopeRoom, roomID).Delete(&models.StorageUsage{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	releaseStoredFiles(ctx, shas)
+	return nil
+}
+
+// releaseStoredFiles 删除不再被任何附件（包括回收站中的）引用的文件内容
+func releaseStoredFiles(ctx context.Context, shas []string) {
+	for _, sum := range shas {
+		var refs int64
+		database.DB.Unscoped().Model(&models.Attachment{}).Where("file_sha256 = ?", sum).Count(&refs)
+		if refs > 0 {
+			continue
+		}
+		var file models.StoredFile
+		if database.DB.Where("sha256 = ?", sum).First(&file).Error != nil {
+			continue
+		}
+		if err := storage.Default.Delete(ctx, file.StorageKey); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("⚠️ 删除附件文件 %s 失败: %v", file.StorageKey, err)
+			continue
+		}
+		database.DB.Delete(&file)
+	}
+}
+
+// purgeDeletedAttachments 彻底删除早先单独删除、但只做了软删除的附件（所在房间不在回收站中），并释放其文件内容
+func purgeDeletedAttachments(ctx context.Context) {
+	deleted := database.DB.Unscoped().Model(&models.Attachment{}).
+		Where("deleted_at IS NOT NULL AND room_id NOT IN (?)", trashedRoomIDs())
+	var shas []string
+	deleted.Session(&gorm.Session{}).Distinct().Pluck("file_sha256", &shas)
+	if len(shas) == 0 {
+		return
+	}
+	if err := deleted.Delete(&models.Attachment{}).Error; err != nil {
+		log.Printf("⚠️ 清理已删除附件失败: %v", err)
+		return
+	}
+	releaseStoredFiles(ctx, shas)
+}
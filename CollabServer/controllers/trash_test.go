@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/websocket"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func trashRoom(t *testing.T, hub *websocket.Hub, username, roomID string) {
+	t.Helper()
+	w := performRequest(DeleteRoom(hub), http.MethodDelete, "/api/rooms/:id", "/api/rooms/"+roomID, "", username)
+	if w.Code != http.StatusOK {
+		t.Fatalf("delete %s: %d %s", roomID, w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteAndRestoreRoomRoundTrip(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	hub := websocket.NewHub()
+	go hub.Run()
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-1"})
+	database.DB.Create(&models.Document{RoomID: "room-1", Content: "<p>doc</p>"})
+	kept := models.Message{RoomID: "room-1", Sender: "alice", Content: "kept"}
+	database.DB.Create(&kept)
+	// 房间删除之前就被单独删除的消息
+	removed := models.Message{RoomID: "room-1", Sender: "bob", Content: "removed earlier"}
+	database.DB.Create(&removed)
+	database.DB.Model(&removed).Update("deleted_at", time.Now().Add(-time.Hour))
+	uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "a.txt", []byte("attachment")))
+
+	if w := performRequest(DeleteRoom(hub), http.MethodDelete, "/api/rooms/:id", "/api/rooms/room-1", "", "bob"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected non-owner delete to be refused, got %d", w.Code)
+	}
+	trashRoom(t, hub, "alice", "room-1")
+
+	var messages, documents, attachments int64
+	database.DB.Model(&models.Message{}).Where("room_id = ?", "room-1").Count(&messages)
+	database.DB.Model(&models.Document{}).Where("room_id = ?", "room-1").Count(&documents)
+	database.DB.Model(&models.Attachment{}).Where("room_id = ?", "room-1").Count(&attachments)
+	if messages+documents+attachments != 0 || canAccessRoom("alice", "room-1") {
+		t.Fatalf("expected room contents to be hidden, got %d messages, %d documents, %d attachments", messages, documents, attachments)
+	}
+	if used := loadUsage(usageScopeUser, "alice"); used.Bytes != 0 {
+		t.Fatalf("expected trashed attachments to be released from quota, got %d", used.Bytes)
+	}
+
+	if w := performRequest(RestoreRoom, http.MethodPost, "/api/trash/:id/restore", "/api/trash/room-1/restore", "", "bob"); w.Code != http.StatusForbidden {
+		t.Fatalf("expected non-owner restore to be refused, got %d", w.Code)
+	}
+	if w := performRequest(RestoreRoom, http.MethodPost, "/api/trash/:id/restore", "/api/trash/room-1/restore", "", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", w.Code, w.Body.String())
+	}
+
+	var restored []models.Message
+	database.DB.Where("room_id = ?", "room-1").Find(&restored)
+	if len(restored) != 1 || restored[0].ID != kept.ID {
+		t.Fatalf("expected only the message deleted with the room to come back, got %+v", restored)
+	}
+	database.DB.Model(&models.Document{}).Where("room_id = ?", "room-1").Count(&documents)
+	database.DB.Model(&models.Attachment{}).Where("room_id = ?", "room-1").Count(&attachments)
+	if documents != 1 || attachments != 1 || !canAccessRoom("bob", "room-1") {
+		t.Fatalf("expected document and attachment to be restored, got %d, %d", documents, attachments)
+	}
+	if used := loadUsage(usageScopeUser, "alice"); used.Bytes != int64(len("attachment")) {
+		t.Fatalf("expected quota usage to be charged again, got %d", used.Bytes)
+	}
+}
+
+func TestPurgeRoomKeepsSharedContent(t *testing.T) {
+	useTestDB(t)
+	s := useTestStorage(t)
+	hub := websocket.NewHub()
+	go hub.Run()
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-1"})
+	database.DB.Create(&models.History{Username: "alice", RoomID: "room-2"})
+	first := uploadedAttachment(t, uploadTestFile(t, "alice", "room-1", "a.txt", []byte("shared blob")))
+	uploadedAttachment(t, uploadTestFile(t, "alice", "room-2", "b.txt", []byte("shared blob")))
+	database.DB.Create(&models.Notification{Username: "bob", RoomID: "room-1", Sender: "alice", Content: "@bob"})
+	database.DB.Create(&models.Notification{Username: "bob", RoomID: "room-2", Sender: "alice", Content: "@bob"})
+
+	trashRoom(t, hub, "alice", "room-1")
+	if w := performRequest(PurgeRoom, http.MethodDelete, "/api/trash/:id", "/api/trash/room-1", "", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("purge: %d %s", w.Code, w.Body.String())
+	}
+
+	if !storedObjectExists(s, first.FileSHA256) {
+		t.Fatal("expected content still used by room-2 to survive the purge")
+	}
+	var rooms, notifications, usage int64
+	database.DB.Unscoped().Model(&models.Room{}).Where("room_id = ?", "room-1").Count(&rooms)
+	database.DB.Unscoped().Model(&models.Notification{}).Where("room_id = ?", "room-1").Count(&notifications)
+	database.DB.Model(&models.StorageUsage{}).Where("scope = ? AND owner = ?", usageScopeRoom, "room-1").Count(&usage)
+	if rooms+notifications+usage != 0 {
+		t.Fatalf("expected room, notifications and usage rows to be removed, got %d, %d, %d", rooms, notifications, usage)
+	}
+	database.DB.Model(&models.Notification{}).Where("room_id = ?", "room-2").Count(&notifications)
+	if notifications != 1 {
+		t.Fatal("expected other rooms' notifications to be kept")
+	}
+
+	trashRoom(t, hub, "alice", "room-2")
+	if err := purgeRoom(t.Context(), "room-2"); err != nil {
+		t.Fatal(err)
+	}
+	if storedObjectExists(s, first.FileSHA256) {
+		t.Fatal("expected content to be removed once no room references it")
+	}
+}
@@ -0,0 +1,442 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// tus 断点续传：/api/tus
+// =============================================================================
+// 实现 tus 1.0.0 核心协议及 creation、expiration、termination 扩展：
+//   POST   /api/tus       创建上传（Upload-Length；Upload-Metadata 带 filename、room）
+//   HEAD   /api/tus/:id   查询已接收的偏移量
+//   PATCH  /api/tus/:id   从 Upload-Offset 处追加一个数据块
+//   DELETE /api/tus/:id   放弃上传
+//   GET    /api/tus/:id   （非协议）查询状态，完成后返回生成的附件
+//
+// 数据在完成前暂存于 TUS_STAGING_DIR，断线后客户端 HEAD 取得偏移即可续传；
+// 传完后走与 /api/files 相同的类型嗅探、内容寻址与附件流程。
+// 过期未完成的会话由 RunTusCleanup 定期清理。
+// =============================================================================
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	// tusSniffBytes 收到这么多字节后即嗅探类型，不允许的类型尽早拒绝
+	tusSniffBytes = 3072
+)
+
+// tusWriting 记录正在被 PATCH 写入的上传，防止同一上传被并发写入。
+// 请求结束即删除，表的大小只取决于同时进行的写入数
+var (
+	tusWritingMu sync.Mutex
+	tusWriting   = map[string]bool{}
+)
+
+// tryLockTusUpload 占用上传的写入权，已被占用时返回 false
+func tryLockTusUpload(id string) bool {
+	tusWritingMu.Lock()
+	defer tusWritingMu.Unlock()
+	if tusWriting[id] {
+		return false
+	}
+	tusWriting[id] = true
+	return true
+}
+
+func unlockTusUpload(id string) {
+	tusWritingMu.Lock()
+	defer tusWritingMu.Unlock()
+	delete(tusWriting, id)
+}
+
+func tusStagingDir() string {
+	return config.GetEnv("TUS_STAGING_DIR", filepath.Join(os.TempDir(), "collab-tus"))
+}
+
+func tusMaxSize() int64 {
+	return int64(config.GetEnvInt("TUS_MAX_SIZE_MB", 2048)) * 1024 * 1024
+}
+
+func tusExpiry() time.Duration {
+	return time.Duration(config.GetEnvInt("TUS_EXPIRE_HOURS", 24)) * time.Hour
+}
+
+func tusStagingPath(id string) string {
+	return filepath.Join(tusStagingDir(), id)
+}
+
+// tusPrepare 写入公共响应头并校验 Tus-Resumable 版本
+func tusPrepare(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Cache-Control", "no-store")
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"error": "不支持的 Tus-Resumable 版本"})
+		return false
+	}
+	return true
+}
+
+// parseTusMetadata 解析 "key base64value,key2 base64value2" 格式的 Upload-Metadata
+func parseTusMetadata(raw string) map[string]string {
+	meta := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			continue
+		}
+		meta[key] = string(decoded)
+	}
+	return meta
+}
+
+func newTusID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func setTusExpires(c *gin.Context, upload models.ResumableUpload) {
+	if !upload.Completed {
+		c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// TusOptions 返回服务端支持的协议版本与扩展
+func TusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(tusMaxSize(), 10))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTusUpload 创建一次断点续传上传
+func CreateTusUpload(c *gin.Context) {
+	if !tusPrepare(c) {
+		return
+	}
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Length 缺失或非法"})
+		return
+	}
+	if length > tusMaxSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("文件大小不能超过 %dMB", tusMaxSize()>>20)})
+		return
+	}
+
+	meta := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	roomID := strings.TrimSpace(meta["room"])
+	if !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权向该房间上传文件"})
+		return
+	}
+	if respondQuotaError(c, checkQuota(username, roomID, length)) {
+		return
+	}
+	filename := filepath.Base(strings.TrimSpace(meta["filename"]))
+	if filename == "" || filename == "." || filename == "/" {
+		filename = "upload"
+	}
+
+	id, err := newTusID()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	if err := os.MkdirAll(tusStagingDir(), 0700); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	f, err := os.OpenFile(tusStagingPath(id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+	f.Close()
+
+	upload := models.ResumableUpload{
+		ID:        id,
+		Username:  username,
+		RoomID:    roomID,
+		Filename:  filename,
+		Length:    length,
+		ExpiresAt: time.Now().Add(tusExpiry()),
+	}
+	if err := database.DB.Create(&upload).Error; err != nil {
+		os.Remove(tusStagingPath(id))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建上传失败"})
+		return
+	}
+
+	c.Header("Location", "/api/tus/"+id)
+	c.Header("Upload-Offset", "0")
+	setTusExpires(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// loadTusUpload 读取当前用户的上传会话，过期未完成的视为已不存在
+func loadTusUpload(c *gin.Context) (models.ResumableUpload, bool) {
+	var upload models.ResumableUpload
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return upload, false
+	}
+	if err := database.DB.Where("id = ? AND username = ?", c.Param("id"), username).First(&upload).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在"})
+		return upload, false
+	}
+	if !upload.Completed && time.Now().After(upload.ExpiresAt) {
+		if tryLockTusUpload(upload.ID) {
+			discardTusUpload(upload.ID)
+			unlockTusUpload(upload.ID)
+		}
+		c.JSON(http.StatusGone, gin.H{"error": "上传已过期"})
+		return upload, false
+	}
+	return upload, true
+}
+
+// HeadTusUpload 返回已接收的偏移量，客户端据此续传
+func HeadTusUpload(c *gin.Context) {
+	if !tusPrepare(c) {
+		return
+	}
+	upload, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	setTusExpires(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// PatchTusUpload 在 Upload-Offset 处追加数据，收齐后生成附件
+func PatchTusUpload(c *gin.Context) {
+	if !tusPrepare(c) {
+		return
+	}
+	if c.ContentType() != "application/offset+octet-stream" {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Content-Type 必须是 application/offset+octet-stream"})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Upload-Offset 缺失或非法"})
+		return
+	}
+
+	upload, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	if !tryLockTusUpload(upload.ID) {
+		c.JSON(http.StatusLocked, gin.H{"error": "该上传正在写入"})
+		return
+	}
+	defer unlockTusUpload(upload.ID)
+
+	// 加锁后重新读取，拿到最新的偏移量
+	if err := database.DB.First(&upload, "id = ?", upload.ID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上传不存在"})
+		return
+	}
+	if upload.Completed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上传已完成"})
+		return
+	}
+	if offset != upload.Offset {
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"error": "Upload-Offset 与服务器不一致"})
+		return
+	}
+
+	f, err := os.OpenFile(tusStagingPath(upload.ID), os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入上传数据失败"})
+		return
+	}
+	written, copyErr := io.Copy(f, io.LimitReader(c.Request.Body, upload.Length-upload.Offset))
+	f.Close()
+
+	// 即使连接中途断开，已落盘的部分也计入偏移量，下次从这里续传
+	previous := upload.Offset
+	upload.Offset += written
+	database.DB.Model(&upload).Update("offset", upload.Offset)
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	setTusExpires(c, upload)
+
+	if copyErr != nil {
+		log.Printf("⚠️ tus 上传 %s 在偏移 %d 处中断: %v", upload.ID, upload.Offset, copyErr)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "数据接收中断，请从 Upload-Offset 续传"})
+		return
+	}
+
+	// 首个数据块够长时就嗅探类型，不允许的类型不必等整个文件传完
+	if previous < tusSniffBytes && (upload.Offset >= tusSniffBytes || upload.Offset == upload.Length) {
+		mimeType, err := sniffStagedFile(upload.ID)
+		if err != nil || !isAttachmentTypeAllowed(mimeType) {
+			discardTusUpload(upload.ID)
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": fmt.Sprintf("文件内容类型不允许: %s", mimeType)})
+			return
+		}
+	}
+
+	if upload.Offset == upload.Length {
+		// 创建之后可能有其他上传占用了空间，落库前再校验一次
+		if err := checkQuota(upload.Username, upload.RoomID, upload.Length); err != nil {
+			discardTusUpload(upload.ID)
+			respondQuotaError(c, err)
+			return
+		}
+		attachment, err := finishTusUpload(c, upload)
+		if err != nil {
+			log.Printf("⚠️ tus 上传 %s 完成处理失败: %v", upload.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
+			return
+		}
+		c.Header("X-Attachment-Id", strconv.FormatUint(uint64(attachment.ID), 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func sniffStagedFile(id string) (string, error) {
+	detected, err := mimetype.DetectFile(tusStagingPath(id))
+	if err != nil {
+		return "", err
+	}
+	return baseMimeType(detected.String()), nil
+}
+
+// finishTusUpload 计算哈希、写入存储并创建附件，随后删除暂存文件
+func finishTusUpload(c *gin.Context, upload models.ResumableUpload) (models.Attachment, error) {
+	f, err := os.Open(tusStagingPath(upload.ID))
+	if err != nil {
+		return models.Attachment{}, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return models.Attachment{}, err
+	}
+	sum := hex.EncodeToString(hasher.Sum(nil))
+	mimeType, err := sniffStagedFile(upload.ID)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	attachment, err := saveAttachment(c.Request.Context(), f, upload.Length, sum, mimeType, upload.RoomID, upload.Username, upload.Filename)
+	if err != nil {
+		return models.Attachment{}, err
+	}
+
+	database.DB.Model(&upload).Updates(map[string]interface{}{"completed": true, "attachment_id": attachment.ID})
+	os.Remove(tusStagingPath(upload.ID))
+	return attachment, nil
+}
+
+// GetTusUpload 返回上传进度；完成后附带生成的附件
+func GetTusUpload(c *gin.Context) {
+	upload, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	response := gin.H{"upload": upload}
+	if upload.Completed {
+		var attachment models.Attachment
+		if err := database.DB.First(&attachment, upload.AttachmentID).Error; err == nil {
+			response["attachment"] = attachment
+			response["url"] = fmt.Sprintf("/api/files/%d/download", attachment.ID)
+		}
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteTusUpload 放弃上传并删除暂存数据（termination 扩展）
+func DeleteTusUpload(c *gin.Context) {
+	if !tusPrepare(c) {
+		return
+	}
+	upload, ok := loadTusUpload(c)
+	if !ok {
+		return
+	}
+	// 写入进行中时删除暂存文件会让那次 PATCH 在收完数据后失败，让客户端稍后重试
+	if !tryLockTusUpload(upload.ID) {
+		c.JSON(http.StatusLocked, gin.H{"error": "该上传正在写入"})
+		return
+	}
+	defer unlockTusUpload(upload.ID)
+	discardTusUpload(upload.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// discardTusUpload 删除暂存数据和会话记录，调用方需持有该上传的写入权
+func discardTusUpload(id string) {
+	os.Remove(tusStagingPath(id))
+	database.DB.Delete(&models.ResumableUpload{}, "id = ?", id)
+}
+
+// RunTusCleanup 定期清理过期的上传会话（在独立 goroutine 中运行）
+func RunTusCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		cleanupTusUploads(time.Now())
+	}
+}
+
+// cleanupTusUploads 删除过期未完成的上传及其暂存数据；已完成的会话记录同样在过期后删除。
+// 正在写入的上传留到下一轮再处理
+func cleanupTusUploads(now time.Time) {
+	var expired []models.ResumableUpload
+	database.DB.Where("expires_at < ?", now).Find(&expired)
+	removed := 0
+	for _, upload := range expired {
+		if !tryLockTusUpload(upload.ID) {
+			continue
+		}
+		discardTusUpload(upload.ID)
+		unlockTusUpload(upload.ID)
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("🧹 已清理 %d 个过期的断点续传会话", removed)
+	}
+}
@@ -0,0 +1,81 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTusUploadLockIsReleasedAndForgotten(t *testing.T) {
+	if !tryLockTusUpload("u1") {
+		t.Fatal("expected first writer to acquire the upload")
+	}
+	if tryLockTusUpload("u1") {
+		t.Fatal("expected concurrent writer to be rejected")
+	}
+	if !tryLockTusUpload("u2") {
+		t.Fatal("expected other uploads to be independent")
+	}
+	unlockTusUpload("u1")
+	unlockTusUpload("u2")
+
+	tusWritingMu.Lock()
+	remaining := len(tusWriting)
+	tusWritingMu.Unlock()
+	if remaining != 0 {
+		t.Fatalf("expected no lock entries after writers finish, got %d", remaining)
+	}
+	if !tryLockTusUpload("u1") {
+		t.Fatal("expected upload to be writable again")
+	}
+	unlockTusUpload("u1")
+}
+
+func TestTusDiscardWaitsForWriter(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("TUS_STAGING_DIR", t.TempDir())
+	for _, id := range []string{"busy", "idle"} {
+		database.DB.Create(&models.ResumableUpload{ID: id, Username: "alice", RoomID: "room-1", Length: 10, ExpiresAt: time.Now().Add(time.Hour)})
+		os.WriteFile(tusStagingPath(id), []byte("part"), 0600)
+	}
+
+	// busy 正在被 PATCH 写入
+	if !tryLockTusUpload("busy") {
+		t.Fatal("expected to acquire the upload")
+	}
+	r := gin.New()
+	r.DELETE("/api/tus/:id", func(c *gin.Context) {
+		c.Set("username", "alice")
+		c.Next()
+	}, DeleteTusUpload)
+	req := httptest.NewRequest(http.MethodDelete, "/api/tus/busy", nil)
+	req.Header.Set("Tus-Resumable", tusVersion)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusLocked {
+		t.Fatalf("expected 423 while a write is in flight, got %d", w.Code)
+	}
+
+	database.DB.Model(&models.ResumableUpload{}).Where("1 = 1").Update("expires_at", time.Now().Add(-time.Minute))
+	cleanupTusUploads(time.Now())
+	if _, err := os.Stat(tusStagingPath("busy")); err != nil {
+		t.Fatal("expected staging file of the in-flight upload to survive cleanup")
+	}
+	if _, err := os.Stat(tusStagingPath("idle")); !os.IsNotExist(err) {
+		t.Fatal("expected idle expired upload to be cleaned up")
+	}
+
+	unlockTusUpload("busy")
+	cleanupTusUploads(time.Now())
+	var remaining int64
+	database.DB.Model(&models.ResumableUpload{}).Count(&remaining)
+	if remaining != 0 {
+		t.Fatalf("expected the upload to be cleaned up once the writer finished, got %d", remaining)
+	}
+}
@@ -1,19 +1,54 @@
 package controllers
 
 import (
+	"bytes"
 	"collab-server/config"
+	"collab-server/database"
+	"collab-server/imageproc"
+	"collab-server/models"
+	"collab-server/storage"
+	"collab-server/uploads"
+	"context"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
-	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
-// UploadImage 处理图片上传
+// uploadedImageVariant 是上传响应中的一个图片变体
+type uploadedImageVariant struct {
+	Name      string `json:"name"`
+	Format    string `json:"format"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Size      int    `json:"size"`
+	URL       string `json:"url"`
+	SignedURL string `json:"signed_url"`
+}
+
+// UploadImage 处理图片上传（表单字段：image，可选 room）
+// 带 room 时图片归属该房间，房间成员都能访问；否则只有上传者本人能访问。
+// 图片会在服务端去除 EXIF、限制尺寸并生成缩略图/WebP，见 imageproc.Process
 func UploadImage(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	roomID := strings.TrimSpace(c.PostForm("room"))
+	if roomID != "" && !canAccessRoom(username, roomID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权向该房间上传文件"})
+		return
+	}
+
 	// 1. 获取文件
 	file, err := c.FormFile("image")
 	if err != nil {
@@ -21,58 +56,354 @@ func UploadImage(c *gin.Context) {
 		return
 	}
 
-	// 2. 文件大小校验（最大 5MB）
-	if file.Size > 5*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "文件大小不能超过 5MB"})
+	// 2. 文件大小校验（IMAGE_MAX_UPLOAD_MB，默认 10MB）
+	maxMB := config.GetEnvInt("IMAGE_MAX_UPLOAD_MB", 10)
+	if file.Size > int64(maxMB)*1024*1024 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件大小不能超过 %dMB", maxMB)})
 		return
 	}
 
 	// 3. 扩展名校验
-	ext := filepath.Ext(file.Filename)
-	if ext != ".jpg" && ext != ".png" && ext != ".jpeg" && ext != ".gif" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "只支持 jpg, png, gif 格式"})
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if ext != ".jpg" && ext != ".png" && ext != ".jpeg" && ext != ".gif" && ext != ".webp" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "只支持 jpg, png, gif, webp 格式"})
 		return
 	}
 
-	// 4. MIME 类型校验（读取文件头检测真实类型，防止伪装扩展名）
+	// 4. MIME 类型校验（检测文件头的真实类型，防止伪装扩展名）
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
 		return
 	}
 	defer src.Close()
-	buf := make([]byte, 512)
-	if _, err := src.Read(buf); err != nil && err != io.EOF {
+	data, err := io.ReadAll(src)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
 		return
 	}
-	mimeType := http.DetectContentType(buf)
-	allowedMimes := map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true}
+	mimeType := http.DetectContentType(data)
+	allowedMimes := map[string]bool{"image/jpeg": true, "image/png": true, "image/gif": true, "image/webp": true}
 	if !allowedMimes[mimeType] {
 		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("文件内容类型不允许: %s", mimeType)})
 		return
 	}
 
-	// 3. 准备保存目录
-	uploadPath := config.GetEnv("UPLOAD_DIR", "uploads")
-	if _, err := os.Stat(uploadPath); os.IsNotExist(err) {
-		os.Mkdir(uploadPath, 0755) // 如果目录不存在则创建
+	// 5. 解码、摆正、去元数据、缩放并生成缩略图
+	variants, err := imageproc.Process(data, imageproc.OptionsFromEnv())
+	if err != nil {
+		if errors.Is(err, imageproc.ErrTooLarge) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "图片无法解析"})
+		return
 	}
 
-	// 4. 生成唯一文件名 (时间戳 + 原始文件名) 以防覆盖
-	filename := fmt.Sprintf("%d%s", time.Now().UnixNano(), ext)
-	savePath := filepath.Join(uploadPath, filename)
-
-	// 5. 保存文件到磁盘
-	if err := c.SaveUploadedFile(file, savePath); err != nil {
+	// 6. 按全部变体的大小校验配额后逐个写入存储后端
+	exp := uploads.Expiry(time.Now())
+	results, err := saveImageVariants(c.Request.Context(), variants, roomID, username, exp)
+	if respondQuotaError(c, err) {
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️ 保存图片失败: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败"})
 		return
 	}
 
-	// 6. 返回相对 URL，避免 Host 头污染风险
-	fileURL := fmt.Sprintf("/uploads/%s", filename)
-
+	// 7. 返回相对 URL，避免 Host 头污染风险
+	// url 是写入文档的规范地址，signed_url 可直接用于 <img> 展示；
+	// variants 包含原图、缩略图及 WebP 版本，编辑器可用缩略图展示并链接到原图
 	c.JSON(http.StatusOK, gin.H{
-		"url": fileURL,
+		"url":        results[0].URL,
+		"signed_url": results[0].SignedURL,
+		"width":      results[0].Width,
+		"height":     results[0].Height,
+		"variants":   results,
+		"expires_at": exp,
 	})
 }
+
+// saveImageVariants 写入 imageproc 生成的全部变体并创建上传记录：<时间戳>.<ext> 为原图，
+// <时间戳>_w320.<ext> 为缩略图。缩略图与 WebP 版本同样占用空间，按全部变体的总大小校验并计入配额。
+// 任何一步失败都会删除已写入的文件和记录
+func saveImageVariants(ctx context.Context, variants []imageproc.Variant, roomID, username string, exp time.Time) (results []uploadedImageVariant, err error) {
+	var total int64
+	for _, v := range variants {
+		total += int64(len(v.Data))
+	}
+	if err := checkQuota(username, roomID, total); err != nil {
+		return nil, err
+	}
+
+	base := fmt.Sprintf("%d", time.Now().UnixNano())
+	originalKey := base + variants[0].Ext()
+	var written []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, key := range written {
+			if delErr := storage.Default.Delete(context.Background(), key); delErr != nil && !errors.Is(delErr, storage.ErrNotFound) {
+				log.Printf("⚠️ 清理未完成的图片 %s 失败: %v", key, delErr)
+			}
+		}
+		if len(written) > 0 {
+			database.DB.Unscoped().Where("storage_key IN ?", written).Delete(&models.Upload{})
+		}
+	}()
+
+	results = make([]uploadedImageVariant, 0, len(variants))
+	for _, v := range variants {
+		key := base + v.Ext()
+		if v.Name != "original" {
+			key = base + "_" + v.Name + v.Ext()
+		}
+		written = append(written, key)
+		if err := storage.Default.Put(ctx, key, bytes.NewReader(v.Data), int64(len(v.Data)), v.ContentType()); err != nil {
+			return nil, err
+		}
+
+		upload := models.Upload{StorageKey: key, RoomID: roomID, Uploader: username, Size: int64(len(v.Data))}
+		if key != originalKey {
+			upload.OriginalKey = originalKey
+		}
+		if err := database.DB.Create(&upload).Error; err != nil {
+			return nil, err
+		}
+
+		results = append(results, uploadedImageVariant{
+			Name:      v.Name,
+			Format:    v.Format,
+			Width:     v.Width,
+			Height:    v.Height,
+			Size:      len(v.Data),
+			URL:       "/uploads/" + key,
+			SignedURL: uploads.SignedPath(key, upload.SignVersion, exp),
+		})
+	}
+	addUsage(username, roomID, total, 1)
+	return results, nil
+}
+
+// canAccessUpload 判断用户能否读取 /uploads 下的文件：
+// 归属房间的按房间权限，未指定房间的只有上传者（用作头像时所有登录用户可见）。
+// 没有上传记录的文件一律拒绝，旧版本的文件在启动时由 BackfillUploadRecords 补录
+func canAccessUpload(username string, upload models.Upload, found bool) bool {
+	if username == "" || !found {
+		return false
+	}
+	if upload.RoomID == "" {
+		return upload.Uploader == username || uploads.IsAvatar(upload)
+	}
+	return canAccessRoom(username, upload.RoomID)
+}
+
+// BackfillUploadRecords 为旧版本上传、没有记录的 /uploads 文件补录归属，按引用位置决定：
+// 头像归用户本人，文档（含历史快照）与聊天中的图片归所在房间（多个房间引用时取最先扫描到的），
+// 私信中的图片归发送者。存储中已不存在的文件不补录
+func BackfillUploadRecords(ctx context.Context) (int, error) {
+	var known []string
+	database.DB.Model(&models.Upload{}).Pluck("storage_key", &known)
+	recorded := make(map[string]bool, len(known))
+	for _, key := range known {
+		recorded[key] = true
+	}
+
+	var pending []models.Upload
+	// 每个来源查询 (内容, 房间, 上传者) 三列
+	sources := []*gorm.DB{
+		database.DB.Unscoped().Model(&models.User{}).Select("avatar, '', username").Where("avatar LIKE ?", "%/uploads/%"),
+		database.DB.Unscoped().Model(&models.Document{}).Select("content, room_id, ''").Where("content LIKE ?", "%/uploads/%"),
+		database.DB.Model(&models.DocumentVersion{}).Select("content, room_id, ''").Where("content LIKE ?", "%/uploads/%"),
+		database.DB.Unscoped().Model(&models.Message{}).Select("content, room_id, ''").Where("content LIKE ?", "%/uploads/%"),
+		database.DB.Unscoped().Model(&models.DirectMessage{}).Select("content, '', sender").Where("content LIKE ?", "%/uploads/%"),
+	}
+	for _, query := range sources {
+		rows, err := query.Order("id").Rows()
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var content, roomID, uploader string
+			if err := rows.Scan(&content, &roomID, &uploader); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			for _, key := range uploads.Keys(content) {
+				if recorded[key] || strings.HasPrefix(key, "files/") {
+					continue
+				}
+				recorded[key] = true
+				pending = append(pending, models.Upload{StorageKey: key, RoomID: roomID, Uploader: uploader})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	created := 0
+	for _, upload := range pending {
+		obj, err := storage.Default.Stat(ctx, upload.StorageKey)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("⚠️ 读取旧文件 %s 失败: %v", upload.StorageKey, err)
+			}
+			continue
+		}
+		upload.Size = obj.Size
+		if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&upload).Error; err != nil {
+			return created, err
+		}
+		created++
+	}
+	return created, nil
+}
+
+// ServeUpload 通过存储后端输出 /uploads 下的文件。
+// 接受两种凭证：服务器签发的 ?sig= 签名链接（供 <img> 嵌入），或 Bearer Token + 房间权限。
+// files/ 前缀是内容寻址的附件，必须经 /api/files/:id/download 鉴权下载
+func ServeUpload(c *gin.Context) {
+	key, err := storage.CleanKey(c.Param("filepath"))
+	if err != nil || strings.HasPrefix(key, "files/") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+
+	upload, found := uploads.Lookup(key)
+	if sig := c.Query("sig"); sig != "" {
+		if !uploads.Verify(key, upload.SignVersion, sig, time.Now()) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "链接已过期或已被吊销"})
+			return
+		}
+	} else {
+		username, _ := getAuthUsername(c)
+		if username == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "需要登录或签名链接"})
+			return
+		}
+		if !canAccessUpload(username, upload, found) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权访问该文件"})
+			return
+		}
+	}
+
+	// 签名链接本身会过期，只允许浏览器私有缓存
+	c.Header("Cache-Control", "private, max-age=300")
+	serveStoredObject(c, key, "", "")
+}
+
+// UploadURLsInput 批量签名请求体
+type UploadURLsInput struct {
+	URLs []string `json:"urls" binding:"required"`
+}
+
+// SignUploadURLs 为客户端续签 /uploads 链接，无权访问的链接不会出现在结果中
+func SignUploadURLs(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	var input UploadURLsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(input.URLs) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "单次最多签名 200 个链接"})
+		return
+	}
+
+	exp := uploads.Expiry(time.Now())
+	signed := make(map[string]string, len(input.URLs))
+	for _, raw := range input.URLs {
+		key, ok := uploads.KeyFromURL(raw)
+		if !ok || strings.HasPrefix(key, "files/") {
+			continue
+		}
+		upload, found := uploads.Lookup(key)
+		if !canAccessUpload(username, upload, found) {
+			continue
+		}
+		signed[raw] = uploads.SignedPath(key, upload.SignVersion, exp)
+	}
+	c.JSON(http.StatusOK, gin.H{"urls": signed, "expires_at": exp})
+}
+
+// RevokeUploadURLs 吊销某个文件此前签发的所有签名链接（仅上传者），之后需重新签名
+func RevokeUploadURLs(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	var input struct {
+		URL string `json:"url" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	key, ok := uploads.KeyFromURL(input.URL)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不是 /uploads 链接"})
+		return
+	}
+
+	result := database.DB.Model(&models.Upload{}).
+		Where("storage_key = ? AND uploader = ?", key, username).
+		UpdateColumn("sign_version", gorm.Expr("sign_version + 1"))
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在或无权吊销"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已吊销"})
+}
+
+// serveStoredObject 从存储后端读取对象并写入响应；
+// contentType 为空时使用后端记录的类型，disposition 非空时作为 Content-Disposition
+func serveStoredObject(c *gin.Context, key, contentType, disposition string) {
+	reader, obj, err := storage.Default.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+			return
+		}
+		log.Printf("⚠️ 读取存储对象 %s 失败: %v", key, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+		return
+	}
+	defer reader.Close()
+
+	if contentType == "" {
+		contentType = obj.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	if disposition != "" {
+		c.Header("Content-Disposition", disposition)
+	}
+
+	// 本地文件支持 Range / If-Modified-Since；对象存储的响应流直接透传
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, "", obj.ModTime, rs)
+		return
+	}
+	if obj.Size >= 0 {
+		c.Header("Content-Length", fmt.Sprint(obj.Size))
+	}
+	if !obj.ModTime.IsZero() {
+		c.Header("Last-Modified", obj.ModTime.UTC().Format(http.TimeFormat))
+	}
+	c.Status(http.StatusOK)
+	if c.Request.Method != http.MethodHead {
+		io.Copy(c.Writer, reader)
+	}
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/storage"
+	"collab-server/uploads"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =============================================================================
+// /uploads 孤儿文件清理
+// =============================================================================
+// 图片插入文档后又被删掉时，文件仍留在存储里。清理任务分两步：
+//   1. 扫描文档（含历史快照、已删除的记录）、聊天、私信、通知、模板和头像中的 /uploads 引用；
+//   2. 存储中未被引用的图片先记入 OrphanedUpload，超过宽限期仍未被引用才删除。
+// 原图与它的缩略图/WebP 变体视为一组：引用其中任何一个，整组都保留。
+// 附件（files/ 前缀）按内容寻址、由附件记录管理，不在此处理。
+// =============================================================================
+
+// uploadGCMu 保证同一时间只有一次清理在运行（定时任务与管理员手动触发）
+var uploadGCMu sync.Mutex
+
+// uploadReferenceSources 列出可能保存 /uploads 链接的表和列
+var uploadReferenceSources = []struct {
+	model  interface{}
+	column string
+}{
+	{&models.Document{}, "content"},
+	{&models.DocumentVersion{}, "content"},
+	{&models.Message{}, "content"},
+	{&models.MessageAudit{}, "old_content"},
+	{&models.MessageAudit{}, "new_content"},
+	{&models.DirectMessage{}, "content"},
+	{&models.Notification{}, "content"},
+	{&models.Template{}, "content"},
+	{&models.User{}, "avatar"},
+}
+
+// removedUpload 是一个已删除（或演练模式下将被删除）的文件
+type removedUpload struct {
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+}
+
+// UploadGCReport 汇总一次清理的结果
+type UploadGCReport struct {
+	DryRun     bool            `json:"dry_run"`
+	Scanned    int             `json:"scanned"`    // 存储中的图片数
+	Referenced int             `json:"referenced"` // 内容中引用到的 Key 数
+	Marked     []string        `json:"marked"`     // 本次新标记为孤儿的文件
+	Pending    int             `json:"pending"`    // 已标记、仍在宽限期内的文件数
+	Restored   []string        `json:"restored"`   // 重新被引用而取消标记的文件
+	Removed    []removedUpload `json:"removed"`
+	FreedBytes int64           `json:"freed_bytes"`
+}
+
+func uploadGCGrace() time.Duration {
+	return time.Duration(config.GetEnvInt("UPLOAD_GC_GRACE_HOURS", 72)) * time.Hour
+}
+
+// RunUploadGC 按固定间隔执行孤儿文件清理，interval <= 0 时不启用
+func RunUploadGC(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		report, err := collectOrphanedUploads(context.Background(), time.Now(), false)
+		if err != nil {
+			log.Printf("⚠️ 孤儿文件清理失败: %v", err)
+			continue
+		}
+		if len(report.Marked) > 0 || len(report.Removed) > 0 {
+			log.Printf("🧹 孤儿文件清理：新标记 %d 个，删除 %d 个，释放 %s", len(report.Marked), len(report.Removed), formatBytes(report.FreedBytes))
+		}
+	}
+}
+
+// AdminUploadGC 由管理员手动触发一次清理；?dry_run=true 时只报告，不做任何修改
+func AdminUploadGC(c *gin.Context) {
+	dryRun := c.Query("dry_run") == "true" || c.Query("dry_run") == "1"
+	report, err := collectOrphanedUploads(c.Request.Context(), time.Now(), dryRun)
+	if err != nil {
+		log.Printf("⚠️ 孤儿文件清理失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清理失败"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// referencedUploadKeys 收集所有内容中引用到的 /uploads Key。
+// 软删除的记录也要扫描，否则从回收站恢复后图片已经不在了
+func referencedUploadKeys() (map[string]bool, error) {
+	refs := map[string]bool{}
+	for _, src := range uploadReferenceSources {
+		rows, err := database.DB.Unscoped().Model(src.model).
+			Select(src.column).
+			Where(src.column+" LIKE ?", "%/uploads/%").
+			Rows()
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var content string
+			if err := rows.Scan(&content); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			for _, key := range uploads.Keys(content) {
+				refs[key] = true
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return refs, nil
+}
+
+// collectOrphanedUploads 执行一次标记-清理
+func collectOrphanedUploads(ctx context.Context, now time.Time, dryRun bool) (UploadGCReport, error) {
+	uploadGCMu.Lock()
+	defer uploadGCMu.Unlock()
+
+	report := UploadGCReport{DryRun: dryRun, Marked: []string{}, Restored: []string{}, Removed: []removedUpload{}}
+
+	// 先列存储再扫引用：扫描期间新上传并插入文档的图片，最多只是不在本次列表里
+	objects, err := storage.Default.List(ctx, "")
+	if err != nil {
+		return report, err
+	}
+	refs, err := referencedUploadKeys()
+	if err != nil {
+		return report, err
+	}
+	report.Referenced = len(refs)
+
+	var records []models.Upload
+	database.DB.Find(&records)
+	byKey := make(map[string]models.Upload, len(records))
+	for _, u := range records {
+		byKey[u.StorageKey] = u
+	}
+	// group 把变体归到原图名下
+	group := func(key string) string {
+		if u, ok := byKey[key]; ok && u.OriginalKey != "" {
+			return u.OriginalKey
+		}
+		return key
+	}
+	keptGroups := map[string]bool{}
+	for key := range refs {
+		keptGroups[group(key)] = true
+	}
+
+	var marks []models.OrphanedUpload
+	database.DB.Find(&marks)
+	marked := make(map[string]models.OrphanedUpload, len(marks))
+	for _, m := range marks {
+		marked[m.StorageKey] = m
+	}
+
+	grace := uploadGCGrace()
+	existing := map[string]bool{}
+	for _, obj := range objects {
+		if strings.HasPrefix(obj.Key, "files/") {
+			continue
+		}
+		report.Scanned++
+		existing[obj.Key] = true
+		if keptGroups[group(obj.Key)] {
+			continue
+		}
+
+		mark, ok := marked[obj.Key]
+		switch {
+		case !ok:
+			report.Marked = append(report.Marked, obj.Key)
+			if !dryRun {
+				database.DB.Create(&models.OrphanedUpload{StorageKey: obj.Key, Size: obj.Size, MarkedAt: now})
+			}
+		case now.Sub(mark.MarkedAt) >= grace:
+			if !dryRun {
+				if err := removeOrphanedUpload(ctx, obj.Key, byKey); err != nil {
+					log.Printf("⚠️ 删除孤儿文件 %s 失败: %v", obj.Key, err)
+					continue
+				}
+			}
+			report.Removed = append(report.Removed, removedUpload{Key: obj.Key, Size: obj.Size})
+			report.FreedBytes += obj.Size
+		default:
+			report.Pending++
+		}
+	}
+
+	// 重新被引用或已不在存储中的文件取消标记
+	for key := range marked {
+		if existing[key] && !keptGroups[group(key)] {
+			continue
+		}
+		if existing[key] {
+			report.Restored = append(report.Restored, key)
+		}
+		if !dryRun {
+			database.DB.Delete(&models.OrphanedUpload{}, "storage_key = ?", key)
+		}
+	}
+	return report, nil
+}
+
+// removeOrphanedUpload 删除文件、上传记录与标记，并释放配额
+func removeOrphanedUpload(ctx context.Context, key string, byKey map[string]models.Upload) error {
+	if err := storage.Default.Delete(ctx, key); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if u, ok := byKey[key]; ok {
+		database.DB.Unscoped().Delete(&u)
+		var files int64
+		if u.OriginalKey == "" {
+			files = 1
+		}
+		addUsage(u.Uploader, u.RoomID, -u.Size, -files)
+	}
+	database.DB.Delete(&models.OrphanedUpload{}, "storage_key = ?", key)
+	return nil
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/imageproc"
+	"collab-server/models"
+	"collab-server/storage"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// failingStorage 在写入第 failAt 个对象时返回错误
+type failingStorage struct {
+	storage.Storage
+	puts   int
+	failAt int
+}
+
+func (s *failingStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	s.puts++
+	if s.puts == s.failAt {
+		return errors.New("disk full")
+	}
+	return s.Storage.Put(ctx, key, r, size, contentType)
+}
+
+func testVariants(sizes ...int) []imageproc.Variant {
+	names := []string{"original", "w320", "w800"}
+	var variants []imageproc.Variant
+	for i, size := range sizes {
+		variants = append(variants, imageproc.Variant{Name: names[i], Format: "png", Data: make([]byte, size)})
+	}
+	return variants
+}
+
+func TestSaveImageVariantsChargesQuotaForAllVariants(t *testing.T) {
+	useTestDB(t)
+	useTestStorage(t)
+	t.Setenv("QUOTA_USER_MB", "1")
+	// 原图本身放得下，加上缩略图就超出
+	database.DB.Create(&models.StorageUsage{Scope: usageScopeUser, Owner: "alice", Bytes: 1024*1024 - 150})
+
+	_, err := saveImageVariants(context.Background(), testVariants(100, 60), "", "alice", time.Now())
+	var quotaErr *QuotaExceededError
+	if !errors.As(err, &quotaErr) || quotaErr.Incoming != 160 {
+		t.Fatalf("expected quota error for 160 bytes, got %v", err)
+	}
+
+	results, err := saveImageVariants(context.Background(), testVariants(100, 40), "", "alice", time.Now())
+	if err != nil || len(results) != 2 {
+		t.Fatalf("expected both variants to be saved, got %v, %v", results, err)
+	}
+	if used := loadUsage(usageScopeUser, "alice"); used.Bytes != 1024*1024-10 {
+		t.Fatalf("expected usage to include every variant, got %d", used.Bytes)
+	}
+}
+
+func TestSaveImageVariantsRemovesWrittenVariantsOnError(t *testing.T) {
+	useTestDB(t)
+	local := useTestStorage(t)
+	storage.Default = &failingStorage{Storage: local, failAt: 3}
+
+	if _, err := saveImageVariants(context.Background(), testVariants(10, 10, 10), "", "alice", time.Now()); err == nil {
+		t.Fatal("expected storage failure")
+	}
+
+	objects, err := local.List(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Fatalf("expected written variants to be removed, got %+v", objects)
+	}
+	var records int64
+	database.DB.Unscoped().Model(&models.Upload{}).Count(&records)
+	if records != 0 {
+		t.Fatalf("expected upload records to be removed, got %d", records)
+	}
+	if used := loadUsage(usageScopeUser, "alice"); used.Bytes != 0 {
+		t.Fatalf("expected no usage to be charged, got %d", used.Bytes)
+	}
+}
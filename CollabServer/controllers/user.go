@@ -4,6 +4,8 @@ import (
 	"collab-server/database"
 	"collab-server/models"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
@@ -22,7 +24,8 @@ func getAuthUsername(c *gin.Context) (string, bool) {
 	return username, true
 }
 
-// GetHistory 获取当前登录用户的最近 10 条访问记录
+// GetHistory 分页获取当前登录用户的访问记录，置顶的排在最前，其余按最近访问倒序
+// GET /history?limit=10&offset=0&q=关键词&pinned=true（q 匹配房间号、备注名或房间标题）
 func GetHistory(c *gin.Context) {
 	username, ok := getAuthUsername(c)
 	if !ok {
@@ -30,11 +33,103 @@ func GetHistory(c *gin.Context) {
 		return
 	}
 
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if limit <= 0 || limit > 100 {
+		limit = 10
+	}
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := database.DB.Model(&models.History{}).Where("username = ? AND room_id NOT IN (?)", username, trashedRoomIDs())
+	if q := strings.TrimSpace(c.Query("q")); q != "" {
+		like := likePattern(q)
+		titled := database.DB.Model(&models.Room{}).Select("room_id").Where("title LIKE ? ESCAPE '\\'", like)
+		query = query.Where("(room_id LIKE ? ESCAPE '\\' OR label LIKE ? ESCAPE '\\' OR room_id IN (?))", like, like, titled)
+	}
+	if pinned := c.Query("pinned"); pinned != "" {
+		query = query.Where("pinned = ?", pinned == "true" || pinned == "1")
+	}
+
+	var total int64
+	query.Count(&total)
 	var histories []models.History
-	// 按时间倒序，取前 10 条
-	database.DB.Where("username = ?", username).Order("updated_at desc").Limit(10).Find(&histories)
+	query.Order("pinned desc, updated_at desc").Limit(limit).Offset(offset).Find(&histories)
+
+	c.JSON(http.StatusOK, gin.H{"history": histories, "total": total, "limit": limit, "offset": offset})
+}
+
+// HistoryUpdateInput 修改访问记录的请求体，未提供的字段保持不变
+type HistoryUpdateInput struct {
+	Label  *string `json:"label"`
+	Pinned *bool   `json:"pinned"`
+}
+
+// UpdateHistory 修改访问记录的备注名或置顶状态
+// PATCH /history/:id
+func UpdateHistory(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+
+	var input HistoryUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	updates := map[string]interface{}{}
+	if input.Label != nil {
+		label := strings.TrimSpace(*input.Label)
+		if len([]rune(label)) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "备注名不能超过 100 字"})
+			return
+		}
+		updates["label"] = label
+	}
+	if input.Pinned != nil {
+		updates["pinned"] = *input.Pinned
+	}
+	updateHistory(c, username, updates)
+}
+
+// PinHistory / UnpinHistory 置顶或取消置顶访问记录
+// POST /history/:id/pin、DELETE /history/:id/pin
+func PinHistory(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	updateHistory(c, username, map[string]interface{}{"pinned": true})
+}
+
+func UnpinHistory(c *gin.Context) {
+	username, ok := getAuthUsername(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证用户"})
+		return
+	}
+	updateHistory(c, username, map[string]interface{}{"pinned": false})
+}
 
-	c.JSON(http.StatusOK, gin.H{"history": histories})
+// updateHistory 更新当前用户的一条访问记录并返回最新内容；不修改 updated_at，避免打乱最近访问顺序
+func updateHistory(c *gin.Context, username string, updates map[string]interface{}) {
+	var history models.History
+	if err := database.DB.Where("id = ? AND username = ?", c.Param("id"), username).First(&history).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
+		return
+	}
+	if len(updates) > 0 {
+		if err := database.DB.Model(&history).UpdateColumns(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+			return
+		}
+		database.DB.First(&history, history.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{"history": history})
 }
 
 // DeleteHistory 删除当前登录用户的指定访问记录
@@ -0,0 +1,131 @@
+package controllers
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+type historyPage struct {
+	History []models.History `json:"history"`
+	Total   int64            `json:"total"`
+}
+
+func getHistory(t *testing.T, username, query string) historyPage {
+	t.Helper()
+	w := performRequest(GetHistory, http.MethodGet, "/history", "/history"+query, "", username)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /history%s: %d %s", query, w.Code, w.Body.String())
+	}
+	var page historyPage
+	json.Unmarshal(w.Body.Bytes(), &page)
+	return page
+}
+
+func historyRooms(page historyPage) []string {
+	rooms := make([]string, 0, len(page.History))
+	for _, h := range page.History {
+		rooms = append(rooms, h.RoomID)
+	}
+	return rooms
+}
+
+// seedHistory 为 alice 写入 room-0…room-4，room-4 最近访问
+func seedHistory(t *testing.T) {
+	t.Helper()
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		database.DB.Create(&models.History{Username: "alice", RoomID: fmt.Sprintf("room-%d", i), UpdatedAt: base.Add(time.Duration(i) * time.Hour)})
+	}
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-9", UpdatedAt: base})
+}
+
+func TestGetHistoryPaginatesByRecency(t *testing.T) {
+	useTestDB(t)
+	seedHistory(t)
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"?limit=2", []string{"room-4", "room-3"}},
+		{"?limit=2&offset=2", []string{"room-2", "room-1"}},
+		{"?limit=2&offset=4", []string{"room-0"}},
+		{"?limit=2&offset=10", []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.query, func(t *testing.T) {
+			page := getHistory(t, "alice", tc.query)
+			if got := historyRooms(page); fmt.Sprint(got) != fmt.Sprint(tc.want) || page.Total != 5 {
+				t.Fatalf("expected %v of 5, got %v of %d", tc.want, got, page.Total)
+			}
+		})
+	}
+}
+
+func TestGetHistorySearchesTitleAndLabel(t *testing.T) {
+	useTestDB(t)
+	seedHistory(t)
+	database.DB.Create(&models.Room{RoomID: "room-1", Title: "周会纪要"})
+	database.DB.Model(&models.History{}).Where("room_id = ?", "room-3").Update("label", "我的周报")
+	// 别人的房间标题匹配也不会出现
+	database.DB.Create(&models.Room{RoomID: "room-9", Title: "周会"})
+
+	cases := []struct {
+		q    string
+		want []string
+	}{
+		{"周", []string{"room-3", "room-1"}},
+		{"纪要", []string{"room-1"}},
+		{"room-2", []string{"room-2"}},
+		{"100%", []string{}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.q, func(t *testing.T) {
+			page := getHistory(t, "alice", "?q="+url.QueryEscape(tc.q))
+			if got := historyRooms(page); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Fatalf("q=%s: expected %v, got %v", tc.q, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPinnedHistoryComesFirstWithoutTouchingRecency(t *testing.T) {
+	useTestDB(t)
+	seedHistory(t)
+
+	var oldest models.History
+	database.DB.Where("room_id = ?", "room-0").First(&oldest)
+	target := fmt.Sprintf("/history/%d/pin", oldest.ID)
+	if w := performRequest(PinHistory, http.MethodPost, "/history/:id/pin", target, "", "alice"); w.Code != http.StatusOK {
+		t.Fatalf("pin: %d %s", w.Code, w.Body.String())
+	}
+	if w := performRequest(PinHistory, http.MethodPost, "/history/:id/pin", target, "", "bob"); w.Code != http.StatusNotFound {
+		t.Fatalf("expected pinning someone else's record to 404, got %d", w.Code)
+	}
+
+	if got := historyRooms(getHistory(t, "alice", "?limit=3")); fmt.Sprint(got) != "[room-0 room-4 room-3]" {
+		t.Fatalf("expected pinned room first, got %v", got)
+	}
+	if got := historyRooms(getHistory(t, "alice", "?pinned=true")); fmt.Sprint(got) != "[room-0]" {
+		t.Fatalf("expected only the pinned room, got %v", got)
+	}
+	var after models.History
+	database.DB.First(&after, oldest.ID)
+	if !after.UpdatedAt.Equal(oldest.UpdatedAt) {
+		t.Fatalf("expected pinning to keep last visited time, got %v", after.UpdatedAt)
+	}
+
+	w := performRequest(UnpinHistory, http.MethodDelete, "/history/:id/pin", target, "", "alice")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unpin: %d", w.Code)
+	}
+	if got := historyRooms(getHistory(t, "alice", "?limit=1")); fmt.Sprint(got) != "[room-4]" {
+		t.Fatalf("expected recency order after unpinning, got %v", got)
+	}
+}
@@ -41,15 +41,53 @@ func Connect() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	// 🛠️ 更新：自动迁移 User, Document 和 Message
-	err = DB.AutoMigrate(&models.User{}, &models.Document{}, &models.Message{}, &models.History{})
+	// 访问记录加唯一索引之前，先合并旧版本并发进入房间时产生的重复记录
+	if err := mergeDuplicateHistories(); err != nil {
+		log.Fatal("Failed to merge duplicate histories:", err)
+	}
+
+	// 🛠️ 更新：自动迁移 User, Document, Message 及聊天/通知相关表
+	err = DB.AutoMigrate(&models.User{}, &models.Document{}, &models.Message{}, &models.History{}, &models.Notification{}, &models.MessageReaction{}, &models.MessageAudit{},
+		&models.Conversation{}, &models.ConversationMember{}, &models.DirectMessage{},
+		&models.StoredFile{}, &models.Attachment{}, &models.Upload{}, &models.ResumableUpload{}, &models.StorageUsage{}, &models.OrphanedUpload{}, &models.DocumentVersion{}, &models.Template{}, &models.Room{}, &models.RoomTag{}, &models.Folder{}, &models.FolderRoom{}, &models.Session{}, &models.LoginThrottle{}, &models.AuthAudit{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 🔎 全文检索索引失败不影响主流程，只是搜索接口不可用
+	if err := SetupSearchIndex(); err != nil {
+		log.Printf("⚠️ 全文检索索引初始化失败: %v", err)
+	}
+
 	fmt.Println("✅ Database connected and migrated successfully!")
 }
 
+// mergeDuplicateHistories 把同一用户同一房间的多条访问记录合并到最早的一条：
+// 次数与停留时长相加，取最近的访问时间，置顶或备注只要有一条设置过就保留
+func mergeDuplicateHistories() error {
+	m := DB.Migrator()
+	if !m.HasTable(&models.History{}) {
+		return nil
+	}
+	const same = "h.username = histories.username AND h.room_id = histories.room_id"
+	sets := "updated_at = (SELECT MAX(h.updated_at) FROM histories h WHERE " + same + ")"
+	if m.HasColumn(&models.History{}, "VisitCount") {
+		sets += ", visit_count = (SELECT SUM(h.visit_count) FROM histories h WHERE " + same + ")" +
+			", time_spent = (SELECT SUM(h.time_spent) FROM histories h WHERE " + same + ")" +
+			", pinned = (SELECT MAX(h.pinned) FROM histories h WHERE " + same + ")" +
+			", label = COALESCE((SELECT h.label FROM histories h WHERE " + same + " AND h.label <> '' ORDER BY h.id LIMIT 1), '')"
+	}
+	return DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Exec("UPDATE histories SET " + sets +
+			" WHERE id IN (SELECT MIN(id) FROM histories GROUP BY username, room_id HAVING COUNT(*) > 1)")
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		log.Printf("🔧 合并了 %d 组重复的访问记录", result.RowsAffected)
+		return tx.Exec("DELETE FROM histories WHERE id NOT IN (SELECT MIN(id) FROM histories GROUP BY username, room_id)").Error
+	})
+}
+
 // =============================================================================
 // Close 优雅停机专用：安全关闭数据库连接
 // =============================================================================
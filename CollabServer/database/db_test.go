@@ -0,0 +1,65 @@
+package database
+
+import (
+	"collab-server/models"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestMergeDuplicateHistories(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	prev := DB
+	DB = db
+	t.Cleanup(func() {
+		DB = prev
+		sqlDB.Close()
+	})
+
+	// 旧版本的表没有唯一索引
+	err = db.Exec(`CREATE TABLE histories (id integer PRIMARY KEY AUTOINCREMENT, username text, room_id text, updated_at datetime,
+		visit_count integer NOT NULL DEFAULT 0, time_spent integer NOT NULL DEFAULT 0, pinned numeric NOT NULL DEFAULT false, label text)`).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	rows := []models.History{
+		{Username: "alice", RoomID: "room-1", UpdatedAt: base, VisitCount: 2, TimeSpent: 60},
+		{Username: "alice", RoomID: "room-1", UpdatedAt: base.Add(time.Hour), VisitCount: 1, TimeSpent: 30, Pinned: true, Label: "周会"},
+		{Username: "alice", RoomID: "room-2", UpdatedAt: base, VisitCount: 1},
+		{Username: "bob", RoomID: "room-1", UpdatedAt: base, VisitCount: 4},
+	}
+	for i := range rows {
+		if err := db.Create(&rows[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mergeDuplicateHistories(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.History{}); err != nil {
+		t.Fatalf("expected unique index to apply after merge: %v", err)
+	}
+
+	var merged []models.History
+	db.Order("id").Find(&merged)
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 records after merge, got %+v", merged)
+	}
+	got := merged[0]
+	if got.ID != rows[0].ID || got.VisitCount != 3 || got.TimeSpent != 90 || !got.Pinned || got.Label != "周会" || !got.UpdatedAt.Equal(base.Add(time.Hour)) {
+		t.Fatalf("unexpected merged record %+v", got)
+	}
+	if merged[2].VisitCount != 4 {
+		t.Fatalf("expected other users' records untouched, got %+v", merged[2])
+	}
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"collab-server/richtext"
+	"database/sql/driver"
+	"fmt"
+	"log"
+
+	sqlite "github.com/glebarez/go-sqlite"
+)
+
+// =============================================================================
+// 全文检索索引（SQLite FTS5）
+// =============================================================================
+// documents_fts / messages_fts 两张虚拟表分别索引文档正文和聊天内容，rowid 与源表 ID 一致。
+// 同步完全由触发器完成，Hub 定时保存、导入、删除等任何写入路径都无需关心索引。
+//
+// - 文档内容是 Tiptap HTML，触发器里调用 strip_html() 只索引纯文本
+// - 分词器使用 trigram，中文无需额外分词即可做子串匹配（查询词至少 3 个字符）
+// - 软删除（deleted_at 非空）以及被撤回的聊天消息不进入索引
+// =============================================================================
+
+func init() {
+	// strip_html 必须在打开连接之前注册，触发器依赖它
+	sqlite.MustRegisterDeterministicScalarFunction("strip_html", 1, func(ctx *sqlite.FunctionContext, args []driver.Value) (driver.Value, error) {
+		switch v := args[0].(type) {
+		case string:
+			return richtext.PlainText(v), nil
+		case []byte:
+			return richtext.PlainText(string(v)), nil
+		default:
+			return "", nil
+		}
+	})
+}
+
+var searchIndexStatements = []string{
+	`CREATE TRIGGER IF NOT EXISTS documents_fts_ai AFTER INSERT ON documents BEGIN
+		INSERT INTO documents_fts(rowid, room_id, content)
+		SELECT new.id, new.room_id, strip_html(new.content) WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS documents_fts_au AFTER UPDATE ON documents BEGIN
+		DELETE FROM documents_fts WHERE rowid = old.id;
+		INSERT INTO documents_fts(rowid, room_id, content)
+		SELECT new.id, new.room_id, strip_html(new.content) WHERE new.deleted_at IS NULL;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS documents_fts_ad AFTER DELETE ON documents BEGIN
+		DELETE FROM documents_fts WHERE rowid = old.id;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, room_id, sender, content)
+		SELECT new.id, new.room_id, new.sender, new.content WHERE new.deleted_at IS NULL AND new.deleted = 0;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE ON messages BEGIN
+		DELETE FROM messages_fts WHERE rowid = old.id;
+		INSERT INTO messages_fts(rowid, room_id, sender, content)
+		SELECT new.id, new.room_id, new.sender, new.content WHERE new.deleted_at IS NULL AND new.deleted = 0;
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		DELETE FROM messages_fts WHERE rowid = old.id;
+	END`,
+}
+
+// SetupSearchIndex 创建 FTS5 虚拟表和同步触发器，首次创建时回填已有数据
+func SetupSearchIndex() error {
+	var existing int64
+	DB.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name IN ('documents_fts', 'messages_fts')").Scan(&existing)
+
+	if err := DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS documents_fts USING fts5(room_id UNINDEXED, content, tokenize = 'trigram')`).Error; err != nil {
+		return fmt.Errorf("创建 documents_fts 失败: %w", err)
+	}
+	if err := DB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(room_id UNINDEXED, sender UNINDEXED, content, tokenize = 'trigram')`).Error; err != nil {
+		return fmt.Errorf("创建 messages_fts 失败: %w", err)
+	}
+	for _, stmt := range searchIndexStatements {
+		if err := DB.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("创建全文索引触发器失败: %w", err)
+		}
+	}
+
+	if existing < 2 {
+		log.Println("🔎 正在为已有文档和聊天记录建立全文索引...")
+		DB.Exec(`DELETE FROM documents_fts`)
+		DB.Exec(`DELETE FROM messages_fts`)
+		DB.Exec(`INSERT INTO documents_fts(rowid, room_id, content)
+			SELECT id, room_id, strip_html(content) FROM documents WHERE deleted_at IS NULL`)
+		DB.Exec(`INSERT INTO messages_fts(rowid, room_id, sender, content)
+			SELECT id, room_id, sender, content FROM messages WHERE deleted_at IS NULL AND deleted = 0`)
+	}
+	return nil
+}
@@ -0,0 +1,298 @@
+// Package imageproc 对上传的图片做服务端处理：按 EXIF 方向摆正、去除元数据、限制尺寸并生成缩略图
+package imageproc
+
+import (
+	"bytes"
+	"collab-server/config"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"golang.org/x/image/draw"
+)
+
+// =============================================================================
+// 处理流程
+// =============================================================================
+//  1. DecodeConfig 先读尺寸，超过像素上限直接拒绝（防解压炸弹）；
+//     GIF 每帧都会解码为整张画布大小以内的图像，因此按 帧数 × 画布像素 计算，帧数在解码前扫描得到
+//  2. 完整解码；JPEG 读取 EXIF Orientation 并在缩放后摆正
+//  3. 重新编码输出——标准库编码器不写任何元数据，EXIF/GPS 随之丢弃
+//  4. 按 ThumbnailSizes 生成缩略图（只生成比原图小的尺寸）
+//  5. WebP：nativewebp 只支持无损编码，照片类图片往往比 JPEG 更大，
+//     因此每个变体都尝试编码，只保留不大于对应 JPEG/PNG 的结果
+//
+// 多帧 GIF 原样保留以免丢失动画（GIF 不携带 EXIF），缩略图取第一帧。
+// =============================================================================
+
+// ErrTooLarge 表示图片像素数超过上限
+var ErrTooLarge = errors.New("图片分辨率过大")
+
+// Options 控制图片处理参数
+type Options struct {
+	MaxDimension   int   // 原图最长边上限，超过则等比缩小
+	ThumbnailSizes []int // 缩略图最长边，从小到大
+	MaxPixels      int   // 解码前的像素数上限
+	WebP           bool  // 是否尝试输出 WebP
+	JPEGQuality    int
+}
+
+// OptionsFromEnv 从 IMAGE_* 配置读取处理参数
+func OptionsFromEnv() Options {
+	opts := Options{
+		MaxDimension: config.GetEnvInt("IMAGE_MAX_DIMENSION", 2048),
+		MaxPixels:    config.GetEnvInt("IMAGE_MAX_PIXELS", 40_000_000),
+		WebP:         config.GetEnv("IMAGE_WEBP", "true") != "false",
+		JPEGQuality:  config.GetEnvInt("IMAGE_JPEG_QUALITY", 85),
+	}
+	for _, raw := range strings.Split(config.GetEnv("IMAGE_THUMBNAIL_SIZES", "320,800"), ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(raw)); err == nil && n > 0 {
+			opts.ThumbnailSizes = append(opts.ThumbnailSizes, n)
+		}
+	}
+	sort.Ints(opts.ThumbnailSizes)
+	return opts
+}
+
+// Variant 是处理后的一份输出
+type Variant struct {
+	Name   string // original 或 w<最长边>，例如 w320
+	Format string // jpeg / png / gif / webp
+	Width  int
+	Height int
+	Data   []byte
+}
+
+// Ext 返回变体对应的文件扩展名
+func (v Variant) Ext() string {
+	if v.Format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + v.Format
+}
+
+// ContentType 返回变体的 MIME 类型
+func (v Variant) ContentType() string {
+	return "image/" + v.Format
+}
+
+// Process 处理一张图片，返回 original、各缩略图及其 WebP 版本
+func Process(data []byte, opts Options) ([]Variant, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("无法识别的图片: %w", err)
+	}
+	if opts.MaxPixels > 0 && cfg.Width*cfg.Height > opts.MaxPixels {
+		return nil, ErrTooLarge
+	}
+	if format == "gif" && opts.MaxPixels > 0 {
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, fmt.Errorf("解码 GIF 失败: %w", err)
+		}
+		if frames*cfg.Width*cfg.Height > opts.MaxPixels {
+			return nil, ErrTooLarge
+		}
+	}
+
+	var (
+		src      image.Image
+		original *Variant
+	)
+	if format == "gif" {
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解码 GIF 失败: %w", err)
+		}
+		src = anim.Image[0]
+		if len(anim.Image) > 1 {
+			original = &Variant{Name: "original", Format: "gif", Width: cfg.Width, Height: cfg.Height, Data: data}
+		}
+	} else {
+		if src, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("解码图片失败: %w", err)
+		}
+	}
+
+	// 照片统一输出 JPEG，其余（可能带透明通道）输出 PNG
+	outFormat := "png"
+	if format == "jpeg" {
+		outFormat = "jpeg"
+	}
+
+	var variants []Variant
+	base := src
+	if original == nil {
+		orientation := 1
+		if format == "jpeg" {
+			orientation = exifOrientation(data)
+		}
+		// 方向为 5~8 时宽高互换，先按摆正后的尺寸计算缩放目标
+		w, h := cfg.Width, cfg.Height
+		if orientation >= 5 {
+			w, h = h, w
+		}
+		tw, th := fitWithin(w, h, opts.MaxDimension)
+		if orientation >= 5 {
+			tw, th = th, tw
+		}
+		base = orient(scale(src, tw, th), orientation)
+
+		encoded, err := encode(base, outFormat, opts.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		b := base.Bounds()
+		original = &Variant{Name: "original", Format: outFormat, Width: b.Dx(), Height: b.Dy(), Data: encoded}
+	}
+	variants = append(variants, *original)
+
+	bw, bh := base.Bounds().Dx(), base.Bounds().Dy()
+	for _, size := range opts.ThumbnailSizes {
+		if size >= bw && size >= bh {
+			break
+		}
+		tw, th := fitWithin(bw, bh, size)
+		thumb := scale(base, tw, th)
+		encoded, err := encode(thumb, outFormat, opts.JPEGQuality)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, Variant{Name: fmt.Sprintf("w%d", size), Format: outFormat, Width: tw, Height: th, Data: encoded})
+	}
+
+	if opts.WebP {
+		variants = append(variants, webpVariants(variants, base)...)
+	}
+	return variants, nil
+}
+
+// gifFrameCount 只遍历 GIF 的块结构统计帧数，不解压图像数据
+func gifFrameCount(data []byte) (int, error) {
+	errFormat := errors.New("GIF 结构不完整")
+	if len(data) < 13 {
+		return 0, errFormat
+	}
+	pos := 13
+	// 逻辑屏幕描述符的最高位表示带全局调色板，大小为 3 * 2^(n+1) 字节
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+	// skipSubBlocks 跳过以 0 长度结尾的数据子块序列
+	skipSubBlocks := func() bool {
+		for pos < len(data) {
+			n := int(data[pos])
+			pos += 1 + n
+			if n == 0 {
+				return true
+			}
+		}
+		return false
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展块：标签后接子块
+			pos += 2
+			if !skipSubBlocks() {
+				return 0, errFormat
+			}
+		case 0x2C: // 图像描述符：9 字节 + 可选局部调色板 + LZW 最小码长 + 子块
+			if pos+10 > len(data) {
+				return 0, errFormat
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			pos++
+			if !skipSubBlocks() {
+				return 0, errFormat
+			}
+			frames++
+		case 0x3B: // 结束符
+			return frames, nil
+		default:
+			return 0, errFormat
+		}
+	}
+	// 缺少结束符的 GIF 也能被解码，按已扫描到的帧计算
+	return frames, nil
+}
+
+// webpVariants 为每个非动画变体生成 WebP，只保留不大于原格式的结果
+func webpVariants(variants []Variant, base image.Image) []Variant {
+	var out []Variant
+	for _, v := range variants {
+		if v.Format == "gif" {
+			continue
+		}
+		img := base
+		if v.Name != "original" {
+			img = scale(base, v.Width, v.Height)
+		}
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, img, nil); err != nil || buf.Len() > len(v.Data) {
+			continue
+		}
+		out = append(out, Variant{Name: v.Name, Format: "webp", Width: v.Width, Height: v.Height, Data: buf.Bytes()})
+	}
+	return out
+}
+
+// fitWithin 等比缩放到最长边不超过 max；max<=0 或已满足时原样返回
+func fitWithin(w, h, max int) (int, int) {
+	if max <= 0 || (w <= max && h <= max) {
+		return w, h
+	}
+	if w >= h {
+		return max, maxInt(1, h*max/w)
+	}
+	return maxInt(1, w*max/h), max
+}
+
+// scale 缩放到指定尺寸，输出 RGBA 以便后续按像素摆正
+func scale(src image.Image, w, h int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	b := src.Bounds()
+	if b.Dx() == w && b.Dy() == h {
+		draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	} else {
+		draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	}
+	return dst
+}
+
+func encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "jpeg":
+		if quality <= 0 || quality > 100 {
+			quality = 85
+		}
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	default:
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("编码图片失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"testing"
+)
+
+// testJPEG 生成左红右蓝的 40x20 JPEG，并插入带 Orientation 与 GPS 占位的 Exif 段
+func testJPEG(t *testing.T, orientation uint16) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= 20 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+
+	// TIFF 头（大端）+ IFD0 一个条目：Orientation，类型 SHORT，数量 1
+	tiff := []byte{'M', 'M', 0, 42, 0, 0, 0, 8, 0, 1,
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, byte(orientation >> 8), byte(orientation), 0, 0,
+		0, 0, 0, 0}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	payload = append(payload, []byte("GPS-SECRET")...)
+	app1 := append([]byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...)
+
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, app1...)
+	return append(out, data[2:]...)
+}
+
+func isRed(c color.Color) bool {
+	r, g, b, _ := c.RGBA()
+	return r > 0xC000 && g < 0x4000 && b < 0x4000
+}
+
+func TestProcessRotatesAndStripsExif(t *testing.T) {
+	data := testJPEG(t, 6)
+	if got := exifOrientation(data); got != 6 {
+		t.Fatalf("expected orientation 6, got %d", got)
+	}
+
+	variants, err := Process(data, Options{MaxDimension: 100, ThumbnailSizes: []int{10}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 2 {
+		t.Fatalf("expected original + one thumbnail, got %d variants", len(variants))
+	}
+
+	original := variants[0]
+	if original.Width != 20 || original.Height != 40 {
+		t.Fatalf("expected rotated 20x40, got %dx%d", original.Width, original.Height)
+	}
+	if bytes.Contains(original.Data, []byte("Exif")) || bytes.Contains(original.Data, []byte("GPS-SECRET")) {
+		t.Fatal("expected EXIF metadata to be stripped")
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(original.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 顺时针旋转 90° 后，原图左半（红）应位于上半部分
+	if !isRed(decoded.At(10, 5)) || isRed(decoded.At(10, 35)) {
+		t.Fatal("expected image to be rotated clockwise")
+	}
+
+	thumb := variants[1]
+	if thumb.Name != "w10" || thumb.Width != 5 || thumb.Height != 10 {
+		t.Fatalf("unexpected thumbnail %s %dx%d", thumb.Name, thumb.Width, thumb.Height)
+	}
+}
+
+func TestProcessDownscalesToMaxDimension(t *testing.T) {
+	variants, err := Process(testJPEG(t, 1), Options{MaxDimension: 10, ThumbnailSizes: []int{320}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(variants) != 1 || variants[0].Width != 10 || variants[0].Height != 5 {
+		t.Fatalf("expected single 10x5 original, got %+v", variants)
+	}
+}
+
+func TestProcessRejectsHugeImages(t *testing.T) {
+	if _, err := Process(testJPEG(t, 1), Options{MaxPixels: 100}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestProcessKeepsAnimatedGIF(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{
+		Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 40, 40), palette), image.NewPaletted(image.Rect(0, 0, 40, 40), palette)},
+		Delay: []int{10, 10},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	variants, err := Process(buf.Bytes(), Options{ThumbnailSizes: []int{20}, WebP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variants[0].Format != "gif" || !bytes.Equal(variants[0].Data, buf.Bytes()) {
+		t.Fatal("expected animated GIF to be kept as-is")
+	}
+	for _, v := range variants[1:] {
+		if v.Format == "gif" {
+			t.Fatalf("expected thumbnails to be re-encoded, got %s", v.Format)
+		}
+	}
+}
+
+func TestProcessRejectsGIFWithTooManyFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	anim := &gif.GIF{}
+	for i := 0; i < 30; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, 40, 40), palette))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := gifFrameCount(buf.Bytes()); err != nil || n != 30 {
+		t.Fatalf("expected 30 frames, got %d, %v", n, err)
+	}
+	// 单帧 1600 像素在限制以内，30 帧合计 48000 像素超出
+	if _, err := Process(buf.Bytes(), Options{MaxPixels: 40_000}); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if _, err := Process(buf.Bytes(), Options{MaxPixels: 48_000}); err != nil {
+		t.Fatalf("expected GIF within the limit to be accepted, got %v", err)
+	}
+}
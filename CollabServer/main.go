@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"collab-server/config"
 	"collab-server/controllers"
 	"collab-server/database"
 	"collab-server/middleware"
 	"collab-server/models"
+	"collab-server/storage"
 	"collab-server/websocket"
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -74,6 +77,10 @@ func getServerPort() string {
 var hub *websocket.Hub
 
 func main() {
+	// 运维命令：collab_server -create-admin <用户名>，密码取自 ADMIN_PASSWORD 或标准输入
+	createAdmin := flag.String("create-admin", "", "创建管理员（或把已有用户提升为管理员）后退出")
+	flag.Parse()
+
 	// 🔧 设置日志格式：包含时间戳和文件名行号，方便调试定位
 	log.SetFlags(log.LstdFlags | log.Lshortfile)
 
@@ -101,7 +108,32 @@ func main() {
 	fmt.Println("⏳ 正在连接数据库...")
 	database.Connect()
 	// AutoMigrate 会自动创建或更新表结构，非常适合快速迭代
-	database.DB.AutoMigrate(&models.User{}, &models.Document{}, &models.Message{}, &models.History{})
+	database.DB.AutoMigrate(&models.User{}, &models.Document{}, &models.Message{}, &models.History{}, &models.Notification{}, &models.MessageReaction{}, &models.MessageAudit{},
+		&models.Conversation{}, &models.ConversationMember{}, &models.DirectMessage{},
+		&models.StoredFile{}, &models.Attachment{}, &models.Upload{}, &models.ResumableUpload{}, &models.StorageUsage{}, &models.OrphanedUpload{}, &models.DocumentVersion{}, &models.Template{}, &models.Room{}, &models.RoomTag{}, &models.Folder{}, &models.FolderRoom{}, &models.Session{}, &models.LoginThrottle{}, &models.AuthAudit{})
+
+	if *createAdmin != "" {
+		runCreateAdmin(*createAdmin)
+		return
+	}
+	// 🔐 首次部署：站点还没有管理员时，用 ADMIN_USERNAME / ADMIN_PASSWORD 创建
+	if created, err := controllers.BootstrapAdmin(config.GetEnv("ADMIN_USERNAME", ""), config.GetEnv("ADMIN_PASSWORD", "")); err != nil {
+		log.Printf("⚠️ 创建初始管理员失败: %v", err)
+	} else if created {
+		log.Printf("✅ 已创建初始管理员 %s", config.GetEnv("ADMIN_USERNAME", ""))
+	}
+
+	// 旧版本的房间没有设置记录，以最早进入房间的用户为创建者补录
+	if n, err := controllers.BackfillRoomOwners(); err != nil {
+		log.Printf("⚠️ 补录房间创建者失败: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ 已为 %d 个房间补录创建者", n)
+	}
+
+	// 存储用量计数器以附件和图片记录为准重算，修正异常退出造成的偏差
+	if err := controllers.RecalculateStorageUsage(); err != nil {
+		log.Printf("⚠️ 重算存储用量失败: %v", err)
+	}
 
 	// ==========================================================================
 	// 阶段 2：初始化 WebSocket Hub
@@ -111,12 +143,40 @@ func main() {
 	hub = websocket.NewHub()
 	go hub.Run() // 在独立 goroutine 中运行 Hub 的事件循环
 
+	// 定期清理过期未完成的断点续传上传
+	go controllers.RunTusCleanup(time.Hour)
+	// 定期删除已过期或已吊销的登录会话与过期的登录失败记录
+	go controllers.RunSessionCleanup(time.Hour)
+	// 定期清理不再被引用的 /uploads 图片
+	go controllers.RunUploadGC(time.Duration(config.GetEnvInt("UPLOAD_GC_INTERVAL_HOURS", 6)) * time.Hour)
+	go controllers.RunTrashPurge(time.Duration(config.GetEnvInt("TRASH_PURGE_INTERVAL_HOURS", 6)) * time.Hour)
+
 	// ==========================================================================
 	// 阶段 3：配置 Gin 路由引擎
 	// ==========================================================================
 	r := gin.Default()
 	r.MaxMultipartMemory = 10 << 20 // 限制上传文件大小为 10MB
 
+	// -------------------------------------------------------------------------
+	// 🔐 可信代理：只有来自这些地址的 X-Forwarded-For 才会被采信
+	// -------------------------------------------------------------------------
+	// c.ClientIP() 用于登录按 IP 限流和会话记录的 IP，若信任任意来源的转发头，
+	// 客户端伪造 X-Forwarded-For 即可绕过 IP 锁定。未配置时不信任任何代理，直接使用连接地址
+	var trustedProxies []string
+	if proxies := config.GetEnv("TRUSTED_PROXIES", ""); proxies != "" {
+		for _, p := range strings.Split(proxies, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				trustedProxies = append(trustedProxies, p)
+			}
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("❌ TRUSTED_PROXIES 配置无效: %v", err)
+	}
+	if len(trustedProxies) > 0 {
+		log.Printf("🔐 可信代理已加载: %v", trustedProxies)
+	}
+
 	// -------------------------------------------------------------------------
 	// 🔐 CORS 安全配置（核心加固点）
 	// -------------------------------------------------------------------------
@@ -140,9 +200,11 @@ func main() {
 		log.Printf("🔐 CORS 白名单已加载: %v", origins)
 	}
 
-	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With"}
-	corsConfig.ExposeHeaders = []string{"Content-Length"}
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Type", "Authorization", "Accept", "X-Requested-With",
+		"Tus-Resumable", "Upload-Length", "Upload-Offset", "Upload-Metadata", "X-Client-Type"}
+	corsConfig.ExposeHeaders = []string{"Content-Length", "Content-Disposition",
+		"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Upload-Offset", "Upload-Length", "Upload-Expires", "X-Attachment-Id"}
 	corsConfig.AllowCredentials = true // 允许携带 Cookie/Token
 
 	r.Use(cors.New(corsConfig))
@@ -156,15 +218,23 @@ func main() {
 	// -------------------------------------------------------------------------
 	// 📂 静态资源服务配置
 	// -------------------------------------------------------------------------
-	// 🔧 UPLOAD_DIR: 用户上传文件存储目录
-	// 使用相对路径时，基于程序执行位置（通常是 CollabServer 目录）
-	uploadDir := config.GetEnv("UPLOAD_DIR", "uploads")
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		log.Printf("⚠️ 无法创建 uploads 目录: %v", err)
-	} else {
-		log.Printf("📂 上传目录已就绪: %s", uploadDir)
+	// 🔧 STORAGE_BACKEND: 上传文件存储后端（local 使用 UPLOAD_DIR，s3 使用 S3_* 配置）
+	// /uploads 不再直接挂载磁盘目录，而是经由存储后端读取，本地与对象存储行为一致
+	if err := storage.Init(); err != nil {
+		log.Fatalf("❌ 存储后端初始化失败: %v", err)
 	}
-	r.Static("/uploads", uploadDir)
+	// 旧版本上传的图片没有记录，补录后才能按房间或上传者鉴权
+	if n, err := controllers.BackfillUploadRecords(context.Background()); err != nil {
+		log.Printf("⚠️ 补录旧图片记录失败: %v", err)
+	} else if n > 0 {
+		log.Printf("✅ 已补录 %d 个旧图片的上传记录", n)
+		if err := controllers.RecalculateStorageUsage(); err != nil {
+			log.Printf("⚠️ 重算存储用量失败: %v", err)
+		}
+	}
+	// 访问需携带签名参数或 Bearer Token，见 controllers.ServeUpload
+	r.GET("/uploads/*filepath", middleware.OptionalJWTAuth(), controllers.ServeUpload)
+	r.HEAD("/uploads/*filepath", middleware.OptionalJWTAuth(), controllers.ServeUpload)
 
 	// 🔧 DIST_PATH: 前端打包产物目录
 	// 部署时需确保 dist 文件夹与 collab_server 在正确的相对位置
@@ -208,6 +278,8 @@ func main() {
 					!strings.HasPrefix(path, "/uploads") &&
 					!strings.HasPrefix(path, "/register") &&
 					!strings.HasPrefix(path, "/login") &&
+					!strings.HasPrefix(path, "/logout") &&
+					!strings.HasPrefix(path, "/refresh") &&
 					!strings.HasPrefix(path, "/history") &&
 					!strings.HasPrefix(path, "/upload") &&
 					!strings.HasPrefix(path, "/ping") {
@@ -226,22 +298,136 @@ func main() {
 	// 🛤️ 路由定义
 	// -------------------------------------------------------------------------
 	r.POST("/register", controllers.Register)
+	// tus 能力查询不需要登录（客户端在上传前探测）
+	r.OPTIONS("/api/tus", controllers.TusOptions)
 	r.POST("/login", controllers.Login)
+	r.POST("/refresh", controllers.Refresh(hub))
 
 	// 需要鉴权的路由
 	authGroup := r.Group("/")
 	authGroup.Use(middleware.JWTAuth())
 	{
+		// 🔑 登录会话
+		authGroup.POST("/logout", controllers.Logout(hub))
+		authGroup.POST("/logout/all", controllers.LogoutAll(hub))
+		authGroup.GET("/api/sessions", controllers.ListSessions)
+		authGroup.DELETE("/api/sessions/:id", controllers.RevokeSession(hub))
+
 		authGroup.GET("/history", controllers.GetHistory)
 		authGroup.DELETE("/history/:id", controllers.DeleteHistory)
+		authGroup.PATCH("/history/:id", controllers.UpdateHistory)
+		authGroup.POST("/history/:id/pin", controllers.PinHistory)
+		authGroup.DELETE("/history/:id/pin", controllers.UnpinHistory)
 		authGroup.POST("/upload", controllers.UploadImage)
+
+		// 👤 个人资料
+		authGroup.GET("/api/me", controllers.GetMe)
+		authGroup.PATCH("/api/me", controllers.UpdateMe(hub))
+		authGroup.POST("/api/me/password", controllers.ChangePassword(hub))
+
+		authGroup.POST("/api/uploads/sign", controllers.SignUploadURLs)
+		authGroup.POST("/api/uploads/revoke", controllers.RevokeUploadURLs)
 		authGroup.POST("/api/ai/chat", controllers.AIChat)
+
+		// 🔔 通知收件箱（@提及）
+		authGroup.GET("/api/notifications", controllers.ListNotifications)
+		authGroup.POST("/api/notifications/read-all", controllers.MarkAllNotificationsRead)
+		authGroup.POST("/api/notifications/:id/read", controllers.MarkNotificationRead)
+		authGroup.DELETE("/api/notifications/:id", controllers.DeleteNotification)
+		authGroup.DELETE("/api/notifications", controllers.ClearNotifications)
+
+		// 📜 聊天记录分页
+		authGroup.GET("/api/rooms/:id/messages", controllers.GetRoomMessages)
+
+		// 🔎 全文检索（文档 + 聊天）
+		authGroup.GET("/api/search", controllers.Search)
+
+		// ✉️ 私信会话
+		authGroup.GET("/api/conversations", controllers.ListConversations)
+		authGroup.POST("/api/conversations", controllers.CreateConversation)
+		authGroup.GET("/api/conversations/:id/messages", controllers.GetConversationMessages)
+		authGroup.POST("/api/conversations/:id/messages", controllers.SendConversationMessage(hub))
+		authGroup.POST("/api/conversations/:id/read", controllers.MarkConversationRead(hub))
+
+		// 📎 通用附件
+		authGroup.POST("/api/files", controllers.UploadFile)
+		authGroup.GET("/api/files/:id", controllers.GetFile)
+		authGroup.GET("/api/files/:id/download", controllers.DownloadFile)
+		authGroup.DELETE("/api/files/:id", controllers.DeleteFile)
+		authGroup.GET("/api/rooms/:id/files", controllers.ListRoomFiles)
+
+		// 🏠 活跃房间目录
+		authGroup.GET("/api/rooms/active", controllers.ListActiveRooms(hub))
+		authGroup.PUT("/api/rooms/:id/visibility", controllers.SetRoomVisibility(hub))
+
+		// 🗂️ 房间信息、标签与文件夹
+		authGroup.GET("/api/rooms", controllers.ListRooms)
+		authGroup.GET("/api/rooms/tags", controllers.ListRoomTags)
+		authGroup.GET("/api/rooms/:id", controllers.GetRoom)
+		authGroup.PATCH("/api/rooms/:id", controllers.UpdateRoom(hub))
+		authGroup.DELETE("/api/rooms/:id", controllers.DeleteRoom(hub))
+		authGroup.GET("/api/folders", controllers.ListFolders)
+		authGroup.POST("/api/folders", controllers.CreateFolder)
+		authGroup.PATCH("/api/folders/:id", controllers.UpdateFolder)
+		authGroup.DELETE("/api/folders/:id", controllers.DeleteFolder)
+		authGroup.POST("/api/folders/:id/rooms", controllers.AddRoomToFolder)
+		authGroup.DELETE("/api/folders/:id/rooms/:room", controllers.RemoveRoomFromFolder)
+
+		// 文档导出
+		authGroup.GET("/api/rooms/:id/export", controllers.ExportDocument(hub))
+		authGroup.POST("/api/rooms/:id/import", controllers.ImportDocument(hub))
+
+		// 📋 文档模板
+		authGroup.GET("/api/templates", controllers.ListTemplates)
+		authGroup.GET("/api/templates/:id", controllers.GetTemplate)
+		authGroup.DELETE("/api/templates/:id", controllers.DeleteTemplate)
+		authGroup.POST("/api/templates/:id/rooms", controllers.CreateRoomFromTemplate(hub))
+		authGroup.POST("/api/rooms/:id/template", controllers.SaveRoomAsTemplate(hub))
+
+		// 🗑️ 回收站
+		authGroup.GET("/api/trash", controllers.ListTrash)
+		authGroup.POST("/api/trash/:id/restore", controllers.RestoreRoom)
+		authGroup.DELETE("/api/trash/:id", controllers.PurgeRoom)
+
+		// ⏯️ tus 断点续传（大文件）
+		authGroup.POST("/api/tus", controllers.CreateTusUpload)
+		authGroup.HEAD("/api/tus/:id", controllers.HeadTusUpload)
+		authGroup.PATCH("/api/tus/:id", controllers.PatchTusUpload)
+		authGroup.GET("/api/tus/:id", controllers.GetTusUpload)
+		authGroup.DELETE("/api/tus/:id", controllers.DeleteTusUpload)
+
+		// 存储用量与配额
+		authGroup.GET("/api/storage/usage", controllers.GetStorageUsage)
+
+		// 管理接口（需管理员角色）
+		adminGroup := authGroup.Group("/api/admin")
+		adminGroup.Use(middleware.RequireAdmin())
+		{
+			adminGroup.GET("/storage", controllers.AdminStorageSummary)
+			adminGroup.POST("/uploads/gc", controllers.AdminUploadGC)
+
+			adminGroup.GET("/users", controllers.AdminListUsers)
+			adminGroup.POST("/users/:id/disable", controllers.AdminDisableUser(hub))
+			adminGroup.POST("/users/:id/enable", controllers.AdminEnableUser)
+			adminGroup.DELETE("/users/:id", controllers.AdminDeleteUser(hub))
+			adminGroup.POST("/users/:id/password", controllers.AdminResetPassword(hub))
+			adminGroup.PUT("/users/:id/role", controllers.AdminSetUserRole)
+			adminGroup.POST("/users/:id/unlock", controllers.AdminUnlockUser)
+			adminGroup.GET("/lockouts", controllers.AdminListLockouts)
+			adminGroup.DELETE("/lockouts/:id", controllers.AdminDeleteLockout)
+			adminGroup.GET("/auth-audit", controllers.AdminListAuthAudit)
+			adminGroup.POST("/rooms/:id/close", controllers.AdminCloseRoom(hub))
+		}
 	}
 
 	// WebSocket 端点
 	r.GET("/ws", func(c *gin.Context) {
 		websocket.ServeWs(hub, c)
 	})
+	// 用户频道：私信与通知，不绑定房间
+	r.GET("/ws/user", func(c *gin.Context) {
+		websocket.ServeUserWs(hub, c)
+	})
 
 	// 健康检查端点（用于负载均衡器或监控系统）
 	r.GET("/ping", func(c *gin.Context) {
@@ -277,6 +463,25 @@ func main() {
 	gracefulShutdown(srv)
 }
 
+// runCreateAdmin 处理 -create-admin 命令行参数。用户已存在且未提供密码时只提升角色
+func runCreateAdmin(username string) {
+	password := config.GetEnv("ADMIN_PASSWORD", "")
+	if password == "" {
+		fmt.Print("请输入管理员密码（已有用户可直接回车，仅提升为管理员）: ")
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		password = strings.TrimSpace(line)
+	}
+	created, err := controllers.EnsureAdmin(username, password)
+	if err != nil {
+		log.Fatalf("❌ 创建管理员失败: %v", err)
+	}
+	if created {
+		fmt.Printf("✅ 已创建管理员 %s\n", username)
+	} else {
+		fmt.Printf("✅ 已将 %s 设为管理员\n", username)
+	}
+}
+
 // =============================================================================
 // gracefulShutdown 实现优雅停机逻辑
 // =============================================================================
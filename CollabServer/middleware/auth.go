@@ -2,9 +2,12 @@ package middleware
 
 import (
 	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -32,17 +35,7 @@ func JWTAuth() gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// 2. 解析并验证 Token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// 校验使用的签名算法是否是我们指定的 HMAC
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("非法的签名算法: %v", token.Header["alg"])
-			}
-			secret := config.GetEnv("JWT_SECRET", "")
-			if secret == "" {
-				return nil, fmt.Errorf("服务器未配置密钥")
-			}
-			return []byte(secret), nil
-		})
+		token, err := parseToken(tokenString)
 
 		// 3. 提取信息并向后传递
 		if err != nil || !token.Valid {
@@ -52,7 +45,16 @@ func JWTAuth() gin.HandlerFunc {
 		}
 
 		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+			// Token 在有效期内也要确认所属会话未被吊销、账号仍然可用（未被禁用或删除）
+			sessionID, ok := SessionActive(claims)
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录"})
+				c.Abort()
+				return
+			}
+			TouchSession(sessionID, c.ClientIP())
 			// 将解析出的 user 信息存入上下文，供后续的 Controller 使用
+			c.Set("sessionId", sessionID)
 			c.Set("userId", claims["userId"])
 			c.Set("username", claims["username"])
 			c.Set("role", claims["role"])
@@ -64,3 +66,82 @@ func JWTAuth() gin.HandlerFunc {
 		}
 	}
 }
+
+// OptionalJWTAuth 携带有效 Bearer Token 时写入用户信息，否则直接放行，
+// 由后续处理器决定是否接受其他凭证（例如 /uploads 的签名链接）
+func OptionalJWTAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			if token, err := parseToken(tokenString); err == nil && token.Valid {
+				if claims, ok := token.Claims.(jwt.MapClaims); ok {
+					if sessionID, active := SessionActive(claims); active {
+						c.Set("sessionId", sessionID)
+						c.Set("userId", claims["userId"])
+						c.Set("username", claims["username"])
+						c.Set("role", claims["role"])
+					}
+				}
+			}
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin 只允许管理员访问，需挂在 JWTAuth 之后。
+// 角色以数据库为准而不是 Token 中的 role，降级后立即生效
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, _ := c.Get("username")
+		name, _ := username.(string)
+		var user models.User
+		if name == "" || database.DB.Select("role").Where("username = ?", name).First(&user).Error != nil || user.Role != "admin" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要管理员权限"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// SessionActive 校验访问令牌中的会话（sid）未被吊销、未过期，且所属账号未被禁用或删除，
+// 返回会话 ID。HTTP 接口与 WebSocket 握手共用
+func SessionActive(claims jwt.MapClaims) (uint, bool) {
+	name, _ := claims["username"].(string)
+	sid, _ := claims["sid"].(float64)
+	if name == "" || sid <= 0 {
+		return 0, false
+	}
+	var count int64
+	database.DB.Model(&models.Session{}).
+		Joins("JOIN users ON users.username = sessions.username AND users.deleted_at IS NULL AND users.disabled = ?", false).
+		Where("sessions.id = ? AND sessions.username = ? AND sessions.revoked_at IS NULL AND sessions.expires_at > ?", uint(sid), name, time.Now()).
+		Count(&count)
+	return uint(sid), count > 0
+}
+
+// sessionTouchInterval 内重复的请求不再更新会话的最近活跃时间，避免每个请求都写库
+const sessionTouchInterval = time.Minute
+
+// TouchSession 记录会话最近一次活跃的时间与来源 IP
+func TouchSession(sessionID uint, ip string) {
+	now := time.Now()
+	database.DB.Model(&models.Session{}).
+		Where("id = ? AND (last_seen_at < ? OR ip <> ?)", sessionID, now.Add(-sessionTouchInterval), ip).
+		UpdateColumns(map[string]interface{}{"last_seen_at": now, "ip": ip})
+}
+
+// parseToken 使用 JWT_SECRET 校验 HMAC 签名的 Token
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// 校验使用的签名算法是否是我们指定的 HMAC
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("非法的签名算法: %v", token.Header["alg"])
+		}
+		secret := config.GetEnv("JWT_SECRET", "")
+		if secret == "" {
+			return nil, fmt.Errorf("服务器未配置密钥")
+		}
+		return []byte(secret), nil
+	})
+}
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// StoredFile 是按 SHA-256 内容寻址的文件实体，相同内容只存一份
+type StoredFile struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	SHA256     string    `gorm:"uniqueIndex;size:64;not null" json:"sha256"`
+	Size       int64     `json:"size"`
+	MimeType   string    `gorm:"size:150" json:"mime_type"`
+	StorageKey string    `gorm:"size:255;not null" json:"-"` // 存储中的相对路径
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Attachment 把一个文件挂到房间上，记录上传者和原始文件名
+type Attachment struct {
+	gorm.Model
+	RoomID       string `gorm:"index;size:100;not null" json:"room_id"`
+	Uploader     string `gorm:"index;size:100" json:"uploader"`
+	FileSHA256   string `gorm:"index;size:64;not null" json:"sha256"`
+	OriginalName string `gorm:"size:255" json:"original_name"`
+	Size         int64  `json:"size"`
+	MimeType     string `gorm:"size:150" json:"mime_type"`
+}
+
+// Upload 记录 /upload 上传的图片属于哪个房间，/uploads 据此鉴权
+type Upload struct {
+	gorm.Model
+	StorageKey  string `gorm:"uniqueIndex;size:255;not null" json:"key"`
+	RoomID      string `gorm:"index;size:100" json:"room_id"`
+	Uploader    string `gorm:"index;size:100" json:"uploader"`
+	OriginalKey string `gorm:"index;size:255" json:"original_key,omitempty"` // 缩略图/WebP 变体指向原图
+	Size        int64  `json:"size"`
+	SignVersion uint   `json:"-"` // 递增即吊销此前签发的全部签名链接
+}
+
+// OrphanedUpload 标记不再被任何内容引用的 /uploads 文件，超过宽限期后由清理任务删除；
+// 期间重新被引用则取消标记
+type OrphanedUpload struct {
+	StorageKey string    `gorm:"primaryKey;size:255" json:"key"`
+	Size       int64     `json:"size"`
+	MarkedAt   time.Time `json:"marked_at"`
+}
+
+// ResumableUpload 是一次 tus 断点续传会话，数据在完成前暂存于本地
+type ResumableUpload struct {
+	ID           string    `gorm:"primaryKey;size:32" json:"id"`
+	Username     string    `gorm:"index;size:100;not null" json:"username"`
+	RoomID       string    `gorm:"size:100;not null" json:"room_id"`
+	Filename     string    `gorm:"size:255" json:"filename"`
+	Length       int64     `json:"length"`
+	Offset       int64     `json:"offset"`
+	Completed    bool      `json:"completed"`
+	AttachmentID uint      `json:"attachment_id,omitempty"` // 完成后生成的附件
+	ExpiresAt    time.Time `gorm:"index" json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Conversation 是房间之外的私信会话，可以是一对一或小型群聊
+type Conversation struct {
+	gorm.Model
+	// 一对一会话的唯一键（按字母序拼接两个用户名），群聊为 NULL
+	DirectKey     *string   `gorm:"uniqueIndex;size:210" json:"-"`
+	IsGroup       bool      `gorm:"default:false" json:"is_group"`
+	Title         string    `gorm:"size:100" json:"title"`
+	CreatedBy     string    `gorm:"size:100" json:"created_by"`
+	LastMessageAt time.Time `gorm:"index" json:"last_message_at"`
+
+	Members []ConversationMember `json:"members,omitempty"`
+}
+
+// ConversationMember 记录会话成员及其已读位置
+type ConversationMember struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	ConversationID    uint      `gorm:"uniqueIndex:idx_conversation_member;not null" json:"conversation_id"`
+	Username          string    `gorm:"uniqueIndex:idx_conversation_member;index;size:100;not null" json:"username"`
+	LastReadMessageID uint      `gorm:"default:0" json:"last_read_message_id"`
+	JoinedAt          time.Time `json:"joined_at"`
+}
+
+// DirectMessage 是私信会话中的一条消息，离线时同样落库，上线后按未读拉取
+type DirectMessage struct {
+	gorm.Model
+	ConversationID uint   `gorm:"index;not null" json:"conversation_id"`
+	Sender         string `gorm:"size:100" json:"sender"`
+	Content        string `gorm:"type:text" json:"content"`
+}
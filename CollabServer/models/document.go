@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -10,3 +12,13 @@ type Document struct {
 	RoomID  string `gorm:"uniqueIndex;size:100;not null" json:"room_id"`
 	Content string `gorm:"type:text" json:"content"`
 }
+
+// DocumentVersion 是文档被整体覆盖前保存的历史快照
+type DocumentVersion struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	RoomID    string    `gorm:"index;size:100;not null" json:"room_id"`
+	Content   string    `gorm:"type:text" json:"content"`
+	Author    string    `gorm:"size:100" json:"author"` // 触发覆盖的用户
+	Reason    string    `gorm:"size:50" json:"reason"`  // 快照原因，例如 import
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -4,7 +4,12 @@ import "time"
 
 type History struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	Username  string    `gorm:"index" json:"username"` // 索引，加速查询
-	RoomID    string    `json:"room_id"`
+	Username  string    `gorm:"index;uniqueIndex:idx_history_user_room" json:"username"` // 索引，加速查询
+	RoomID    string    `gorm:"uniqueIndex:idx_history_user_room" json:"room_id"`        // 每个用户每个房间只有一条记录
 	UpdatedAt time.Time `json:"last_visited"`
+
+	VisitCount int    `gorm:"not null;default:0" json:"visit_count"`
+	TimeSpent  int64  `gorm:"not null;default:0" json:"time_spent"` // 累计停留时长（秒），离开房间时累加
+	Pinned     bool   `gorm:"not null;default:false" json:"pinned"`
+	Label      string `gorm:"size:100" json:"label"` // 用户自定义的房间备注名
 }
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// LoginThrottle 记录某个用户名或 IP 的连续登录失败次数与锁定截止时间
+type LoginThrottle struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Subject     string    `gorm:"uniqueIndex;size:200;not null" json:"subject"` // user:用户名 或 ip:地址
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// AuthAudit 记录登录锁定与管理员解锁
+type AuthAudit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Action    string    `gorm:"index;size:20" json:"action"` // lockout 或 unlock
+	Subject   string    `gorm:"index;size:200" json:"subject"`
+	IP        string    `gorm:"size:64" json:"ip"`
+	Actor     string    `gorm:"size:100" json:"actor,omitempty"` // 执行解锁的管理员
+	Detail    string    `gorm:"size:500" json:"detail"`
+	CreatedAt time.Time `json:"created_at"`
+}
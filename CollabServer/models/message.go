@@ -1,10 +1,53 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Message struct {
 	gorm.Model
 	RoomID  string `gorm:"index;size:100;not null" json:"room_id"` // ✅ 必须有 json:"room_id"
 	Sender  string `gorm:"size:100" json:"sender"`                 // ✅ 必须有 json:"sender"
 	Content string `gorm:"type:text" json:"content"`               // ✅ 必须有 json:"content"
+
+	// 🧵 回复线程：指向同一房间内的父消息，0 表示不是回复
+	ReplyToID uint `gorm:"index;default:0" json:"reply_to_id,omitempty"`
+
+	// ✏️ 编辑与删除：删除是软删除，原文保留在 MessageAudit 中，这里只留下墓碑
+	EditedAt  *time.Time `json:"edited_at,omitempty"`
+	Deleted   bool       `gorm:"default:false" json:"deleted,omitempty"`
+	DeletedBy string     `gorm:"size:100" json:"deleted_by,omitempty"`
+
+	// 😀 表情回应聚合结果，不落库，由 MessageReaction 统计得到
+	Reactions []ReactionSummary `gorm:"-" json:"reactions,omitempty"`
+}
+
+// MessageReaction 记录某个用户对某条消息的一个表情回应
+type MessageReaction struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	MessageID uint      `gorm:"uniqueIndex:idx_reaction_unique;not null" json:"message_id"`
+	Username  string    `gorm:"uniqueIndex:idx_reaction_unique;size:100;not null" json:"username"`
+	Emoji     string    `gorm:"uniqueIndex:idx_reaction_unique;size:32;not null" json:"emoji"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary 是某个表情在一条消息上的聚合
+type ReactionSummary struct {
+	Emoji string   `json:"emoji"`
+	Count int      `json:"count"`
+	Users []string `json:"users"`
+}
+
+// MessageAudit 记录消息的编辑与删除，保留修改前的原文
+type MessageAudit struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	MessageID  uint      `gorm:"index;not null" json:"message_id"`
+	RoomID     string    `gorm:"index;size:100" json:"room_id"`
+	Action     string    `gorm:"size:20" json:"action"` // edit 或 delete
+	Actor      string    `gorm:"size:100" json:"actor"`
+	OldContent string    `gorm:"type:text" json:"old_content"`
+	NewContent string    `gorm:"type:text" json:"new_content"`
+	CreatedAt  time.Time `json:"created_at"`
 }
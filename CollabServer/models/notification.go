@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// Notification 是用户收件箱中的一条通知（目前来源于 @提及）
+type Notification struct {
+	gorm.Model
+	Username string `gorm:"index;size:100;not null" json:"username"` // 接收者
+	Type     string `gorm:"size:30;default:'mention'" json:"type"`   // mention
+	Source   string `gorm:"size:30" json:"source"`                   // chat 或 document
+	RoomID   string `gorm:"index;size:100" json:"room_id"`
+	Sender   string `gorm:"size:100" json:"sender"`
+	Content  string `gorm:"type:text" json:"content"` // 提及位置附近的摘要
+	Read     bool   `gorm:"index;default:false" json:"read"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Room 保存房间级别的设置，第一次有人进入（或通过导入、模板创建）时生成
+type Room struct {
+	RoomID      string    `gorm:"primaryKey;size:100" json:"room_id"`
+	Title       string    `gorm:"size:200" json:"title"`
+	Description string    `gorm:"size:1000" json:"description"`
+	Public      bool      `gorm:"not null;default:false" json:"public"` // 只有创建者明确公开的房间才出现在活跃房间目录中
+	CreatedBy   string    `gorm:"size:100" json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	// 回收站：删除房间时文档、聊天与附件使用同一个 DeletedAt 软删除，恢复时按此时间找回
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	DeletedBy string         `gorm:"size:100" json:"deleted_by,omitempty"`
+}
+
+// RoomTag 是房间标签，一个房间可以有多个标签
+type RoomTag struct {
+	ID     uint   `gorm:"primaryKey" json:"id"`
+	RoomID string `gorm:"uniqueIndex:idx_room_tag;size:100;not null" json:"room_id"`
+	Tag    string `gorm:"uniqueIndex:idx_room_tag;index;size:50;not null" json:"tag"`
+}
+
+// Folder 是整理房间用的文件夹，可以嵌套。
+// Owner 不为空时是个人文件夹；ConversationID 不为空时是团队文件夹，群聊成员共享
+type Folder struct {
+	gorm.Model
+	Name           string `gorm:"size:100;not null" json:"name"`
+	ParentID       *uint  `gorm:"index" json:"parent_id"`
+	Owner          string `gorm:"index;size:100" json:"owner"`
+	ConversationID *uint  `gorm:"index" json:"conversation_id"`
+}
+
+// FolderRoom 记录文件夹中的房间
+type FolderRoom struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	FolderID  uint      `gorm:"uniqueIndex:idx_folder_room;not null" json:"folder_id"`
+	RoomID    string    `gorm:"uniqueIndex:idx_folder_room;index;size:100;not null" json:"room_id"`
+	AddedBy   string    `gorm:"size:100" json:"added_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// Session 是一次登录产生的会话。访问令牌（JWT）通过 sid 指向会话，会话被吊销后立即失效；
+// 刷新令牌只保存 SHA-256 摘要，每次刷新都会轮换
+type Session struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	UserID       uint       `gorm:"index" json:"user_id"`
+	Username     string     `gorm:"index;size:100;not null" json:"username"`
+	RefreshHash  string     `gorm:"uniqueIndex;size:64;not null" json:"-"`
+	PreviousHash string     `gorm:"index;size:64" json:"-"` // 上一个刷新令牌，再次出现说明令牌已泄露
+	ExpiresAt    time.Time  `json:"expires_at"`             // 刷新令牌的过期时间，每次刷新顺延
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+
+	// 设备信息：登录时记录，之后每次鉴权通过的请求或 WebSocket 连接刷新 IP 与最近活跃时间
+	UserAgent  string    `gorm:"size:500" json:"user_agent"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	ClientType string    `gorm:"size:20" json:"client_type"` // desktop 或 browser
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
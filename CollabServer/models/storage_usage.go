@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// StorageUsage 记录某个用户或房间已占用的上传空间（字节数与文件数）
+type StorageUsage struct {
+	ID        uint      `gorm:"primaryKey" json:"-"`
+	Scope     string    `gorm:"uniqueIndex:idx_storage_usage_owner;size:10;not null" json:"scope"` // user 或 room
+	Owner     string    `gorm:"uniqueIndex:idx_storage_usage_owner;size:100;not null" json:"owner"`
+	Bytes     int64     `json:"bytes"`
+	Files     int64     `json:"files"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "gorm.io/gorm"
+
+// Template 是文档模板：Owner 为空表示全局模板（管理员维护），否则为个人模板
+type Template struct {
+	gorm.Model
+	Name        string `gorm:"size:100;not null" json:"name"`
+	Description string `gorm:"size:500" json:"description"`
+	Content     string `gorm:"type:text" json:"content"`
+	Owner       string `gorm:"index;size:100" json:"owner"`
+	CreatedBy   string `gorm:"size:100" json:"created_by"`
+}
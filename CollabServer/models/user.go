@@ -5,9 +5,11 @@ import (
 )
 
 type User struct {
-	gorm.Model        // 自动包含 ID, CreatedAt, UpdatedAt 等字段
-	Username   string `gorm:"uniqueIndex;not null" json:"username"`
-	Password   string `gorm:"not null" json:"-"` // json:"-" 表示返回给前端时不带密码
-	Avatar     string `json:"avatar"`
-	Role       string `gorm:"default:'user'" json:"role"` // user 或 admin
+	gorm.Model         // 自动包含 ID, CreatedAt, UpdatedAt 等字段
+	Username    string `gorm:"uniqueIndex;not null" json:"username"`
+	Password    string `gorm:"not null" json:"-"` // json:"-" 表示返回给前端时不带密码
+	Avatar      string `json:"avatar"`            // /uploads 下的规范地址（不带签名）
+	DisplayName string `gorm:"size:50" json:"display_name"`
+	Role        string `gorm:"default:'user'" json:"role"`    // user 或 admin
+	Disabled    bool   `gorm:"default:false" json:"disabled"` // 被管理员禁用后不能登录，已签发的 Token 也随之失效
 }
@@ -0,0 +1,210 @@
+package richtext
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// parseFragment 把编辑器 HTML 解析为 <body> 下的节点列表
+func parseFragment(content string) []*html.Node {
+	nodes, err := html.ParseFragment(strings.NewReader(content), &html.Node{
+		Type:     html.ElementNode,
+		Data:     "body",
+		DataAtom: atom.Body,
+	})
+	if err != nil {
+		return nil
+	}
+	return nodes
+}
+
+// blockTags 是按块处理的元素，其余元素视为行内内容
+var blockTags = map[atom.Atom]bool{
+	atom.P: true, atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Blockquote: true, atom.Pre: true, atom.Hr: true,
+	atom.Div: true, atom.Section: true, atom.Article: true, atom.Header: true, atom.Footer: true,
+	atom.Table: true, atom.Thead: true, atom.Tbody: true, atom.Tr: true, atom.Figure: true,
+}
+
+func isBlock(n *html.Node) bool {
+	return n.Type == html.ElementNode && blockTags[n.DataAtom]
+}
+
+// block 是一个块级元素，或是相邻行内节点组成的隐式段落（el 为 nil）
+type block struct {
+	el     *html.Node
+	inline []*html.Node
+}
+
+// blocksOf 把同级节点分成块；只含空白的隐式段落会被丢弃
+func blocksOf(nodes []*html.Node) []block {
+	var blocks []block
+	var run []*html.Node
+	flush := func() {
+		for _, n := range run {
+			if n.Type != html.TextNode || strings.TrimSpace(n.Data) != "" {
+				blocks = append(blocks, block{inline: run})
+				break
+			}
+		}
+		run = nil
+	}
+	for _, n := range nodes {
+		switch {
+		case n.Type == html.CommentNode:
+		case isBlock(n):
+			flush()
+			blocks = append(blocks, block{el: n})
+		case isTaskLabel(n):
+			// 任务项前的复选框由 data-checked 表示
+		default:
+			run = append(run, n)
+		}
+	}
+	flush()
+	return blocks
+}
+
+func children(n *html.Node) []*html.Node {
+	var nodes []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		nodes = append(nodes, c)
+	}
+	return nodes
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// headingLevel 返回 h1-h6 的级别，其他元素返回 0
+func headingLevel(n *html.Node) int {
+	switch n.DataAtom {
+	case atom.H1:
+		return 1
+	case atom.H2:
+		return 2
+	case atom.H3:
+		return 3
+	case atom.H4:
+		return 4
+	case atom.H5:
+		return 5
+	case atom.H6:
+		return 6
+	}
+	return 0
+}
+
+// Tiptap 任务列表：<ul data-type="taskList"><li data-type="taskItem" data-checked="true">
+func isTaskItem(n *html.Node) bool {
+	return n.DataAtom == atom.Li && attr(n, "data-type") == "taskItem"
+}
+
+func isChecked(n *html.Node) bool {
+	return attr(n, "data-checked") == "true"
+}
+
+func isTaskLabel(n *html.Node) bool {
+	return n.Type == html.ElementNode && n.DataAtom == atom.Label &&
+		n.Parent != nil && isTaskItem(n.Parent)
+}
+
+// codeLanguage 读取代码块的 class="language-xxx"
+func codeLanguage(pre *html.Node) string {
+	for _, n := range append([]*html.Node{pre}, children(pre)...) {
+		if n.Type != html.ElementNode {
+			continue
+		}
+		for _, class := range strings.Fields(attr(n, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// textContent 返回节点内全部文本，保留原始空白（用于代码块）
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && n.DataAtom == atom.Br:
+			b.WriteString("\n")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// collapseSpace 按 HTML 规则把连续空白折叠为一个空格
+func collapseSpace(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		if r == ' ' || r == '\n' || r == '\t' || r == '\r' || r == '\f' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// ImageLoader 读取图片内容；返回 false 表示无法获取（外链或无权访问），调用方保留原链接
+type ImageLoader func(src string) (data []byte, contentType string, ok bool)
+
+// loadImage 优先解析 data: URI，其余交给 loader
+func loadImage(src string, loader ImageLoader) ([]byte, string, bool) {
+	if rest, ok := strings.CutPrefix(src, "data:"); ok {
+		meta, payload, found := strings.Cut(rest, ",")
+		if !found || !strings.HasSuffix(meta, ";base64") {
+			return nil, "", false
+		}
+		data, err := base64.StdEncoding.DecodeString(payload)
+		if err != nil {
+			return nil, "", false
+		}
+		return data, strings.TrimSuffix(meta, ";base64"), true
+	}
+	if loader == nil {
+		return nil, "", false
+	}
+	return loader(src)
+}
+
+// isSafeHref 只允许相对地址和 http/https/mailto 链接
+func isSafeHref(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,437 @@
+package richtext
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// =============================================================================
+// DOCX 导出
+// =============================================================================
+// 直接生成 WordprocessingML：document.xml 中每个块级元素对应一个或多个段落，
+// 行内格式对应 run 属性，图片内嵌到 word/media 中。
+// Word 不支持 WebP，WebP 与无法读取的图片以替代文本代替。
+// =============================================================================
+
+const (
+	emuPerPixel   = 9525    // 96 DPI 下 1 像素对应的 EMU
+	maxImageWidth = 5486400 // 正文宽度 6 英寸
+	indentPerLvl  = 420     // 每级缩进（twip）
+)
+
+type docxRun struct {
+	bold, italic, underline, strike, code bool
+	link                                  string
+}
+
+type docxMedia struct {
+	name string
+	data []byte
+}
+
+type docxWriter struct {
+	body     strings.Builder
+	loader   ImageLoader
+	rels     []string // document.xml.rels 中的额外关系
+	media    []docxMedia
+	nums     []int // 每个有序列表一个 w:num，以便重新从 start 编号
+	imageSeq int
+}
+
+// DOCX 把 Tiptap HTML 转换为 .docx 文件
+func DOCX(title, content string, loader ImageLoader) ([]byte, error) {
+	w := &docxWriter{loader: loader}
+	w.blocks(parseFragment(content), docxPara{})
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := []struct{ name, body string }{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", fmt.Sprintf(docxCoreProps, xmlEscape(title))},
+		{"word/_rels/document.xml.rels", w.documentRels()},
+		{"word/document.xml", docxDocumentHead + w.body.String() + docxDocumentTail},
+		{"word/styles.xml", docxStyles},
+		{"word/numbering.xml", w.numbering()},
+	}
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write([]byte(f.body)); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range w.media {
+		fw, err := zw.Create("word/media/" + m.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := fw.Write(m.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// docxPara 是块级上下文：段落样式、列表编号与缩进
+type docxPara struct {
+	style  string
+	numID  int
+	level  int
+	indent int
+	prefix string // 任务项前的复选框符号
+}
+
+func (p docxPara) properties() string {
+	var b strings.Builder
+	if p.style != "" {
+		fmt.Fprintf(&b, `<w:pStyle w:val="%s"/>`, p.style)
+	}
+	if p.numID > 0 {
+		fmt.Fprintf(&b, `<w:numPr><w:ilvl w:val="%d"/><w:numId w:val="%d"/></w:numPr>`, p.level, p.numID)
+	} else if p.indent > 0 {
+		fmt.Fprintf(&b, `<w:ind w:left="%d"/>`, p.indent)
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return "<w:pPr>" + b.String() + "</w:pPr>"
+}
+
+func (w *docxWriter) blocks(nodes []*html.Node, ctx docxPara) {
+	for _, b := range blocksOf(nodes) {
+		if b.el == nil {
+			w.paragraph(b.inline, ctx)
+		} else {
+			w.block(b.el, ctx)
+		}
+		// 列表项只有第一个段落带编号，后续段落按同级缩进
+		if ctx.numID > 0 || ctx.prefix != "" {
+			ctx.indent = (ctx.level + 1) * indentPerLvl
+			ctx.numID, ctx.prefix = 0, ""
+		}
+	}
+}
+
+func (w *docxWriter) block(n *html.Node, ctx docxPara) {
+	if level := headingLevel(n); level > 0 {
+		ctx.style = fmt.Sprintf("Heading%d", level)
+		w.paragraph(children(n), ctx)
+		return
+	}
+	switch n.DataAtom {
+	case atom.P:
+		w.paragraph(children(n), ctx)
+	case atom.Hr:
+		w.body.WriteString(`<w:p><w:pPr><w:pBdr><w:bottom w:val="single" w:sz="6" w:space="1" w:color="D0D7DE"/></w:pBdr></w:pPr></w:p>`)
+	case atom.Pre:
+		ctx.style = "Code"
+		ctx.numID = 0
+		w.body.WriteString("<w:p>" + ctx.properties())
+		for i, line := range strings.Split(strings.TrimSuffix(textContent(n), "\n"), "\n") {
+			if i > 0 {
+				w.body.WriteString("<w:r><w:br/></w:r>")
+			}
+			w.text(line, docxRun{})
+		}
+		w.body.WriteString("</w:p>")
+	case atom.Blockquote:
+		ctx.style = "Quote"
+		w.blocks(children(n), ctx)
+	case atom.Ul, atom.Ol:
+		w.list(n, ctx)
+	default:
+		w.blocks(children(n), ctx)
+	}
+}
+
+func (w *docxWriter) list(n *html.Node, ctx docxPara) {
+	level := 0
+	if ctx.numID > 0 || ctx.indent > 0 || ctx.prefix != "" {
+		level = ctx.level + 1
+	}
+	numID := 1 // 无序列表共用 numId 1
+	if n.DataAtom == atom.Ol {
+		start := 1
+		if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+			start = s
+		}
+		w.nums = append(w.nums, start)
+		numID = len(w.nums) + 1
+	}
+	for _, li := range children(n) {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		item := docxPara{style: ctx.style, numID: numID, level: min(level, 8)}
+		if isTaskItem(li) {
+			item.numID = 0
+			item.indent = level * indentPerLvl
+			item.prefix = "☐ "
+			if isChecked(li) {
+				item.prefix = "☑ "
+			}
+		}
+		w.blocks(children(li), item)
+	}
+}
+
+func (w *docxWriter) paragraph(nodes []*html.Node, ctx docxPara) {
+	w.body.WriteString("<w:p>" + ctx.properties())
+	if ctx.prefix != "" {
+		w.text(ctx.prefix, docxRun{})
+	}
+	trim := true
+	for _, n := range nodes {
+		w.inline(n, docxRun{}, &trim)
+	}
+	w.body.WriteString("</w:p>")
+}
+
+// inline 输出行内节点；trim 用于去掉段落开头的空白
+func (w *docxWriter) inline(n *html.Node, run docxRun, trim *bool) {
+	if n.Type == html.TextNode {
+		text := collapseSpace(n.Data)
+		if *trim {
+			text = strings.TrimLeft(text, " ")
+		}
+		if text != "" {
+			*trim = strings.HasSuffix(text, " ")
+			w.text(text, run)
+		}
+		return
+	}
+	if n.Type != html.ElementNode {
+		return
+	}
+	switch n.DataAtom {
+	case atom.Br:
+		w.body.WriteString("<w:r><w:br/></w:r>")
+		*trim = true
+		return
+	case atom.Img:
+		w.image(n)
+		*trim = false
+		return
+	case atom.Strong, atom.B:
+		run.bold = true
+	case atom.Em, atom.I:
+		run.italic = true
+	case atom.U:
+		run.underline = true
+	case atom.S, atom.Del, atom.Strike:
+		run.strike = true
+	case atom.Code:
+		run.code = true
+	case atom.A:
+		if href := attr(n, "href"); href != "" && isSafeHref(href) {
+			run.link = href
+		}
+	case atom.Input, atom.Script, atom.Style:
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.inline(c, run, trim)
+	}
+}
+
+func (w *docxWriter) text(text string, run docxRun) {
+	var props strings.Builder
+	if run.link != "" {
+		props.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+	}
+	if run.code {
+		props.WriteString(`<w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/>`)
+	}
+	if run.bold {
+		props.WriteString("<w:b/>")
+	}
+	if run.italic {
+		props.WriteString("<w:i/>")
+	}
+	if run.strike {
+		props.WriteString("<w:strike/>")
+	}
+	if run.underline {
+		props.WriteString(`<w:u w:val="single"/>`)
+	}
+	if run.code {
+		props.WriteString(`<w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/>`)
+	}
+
+	r := "<w:r>"
+	if props.Len() > 0 {
+		r += "<w:rPr>" + props.String() + "</w:rPr>"
+	}
+	r += `<w:t xml:space="preserve">` + xmlEscape(text) + "</w:t></w:r>"
+
+	if run.link != "" {
+		id := w.addRel(fmt.Sprintf(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"`, xmlEscape(run.link)))
+		r = fmt.Sprintf(`<w:hyperlink r:id="%s">%s</w:hyperlink>`, id, r)
+	}
+	w.body.WriteString(r)
+}
+
+// image 内嵌 PNG/JPEG/GIF 图片，宽度超过正文时按比例缩小
+func (w *docxWriter) image(n *html.Node) {
+	alt := attr(n, "alt")
+	data, _, ok := loadImage(attr(n, "src"), w.loader)
+	var cfg image.Config
+	var format string
+	var err error
+	if ok {
+		cfg, format, err = image.DecodeConfig(bytes.NewReader(data))
+	}
+	if !ok || err != nil || cfg.Width == 0 || cfg.Height == 0 {
+		if alt != "" {
+			w.text("["+alt+"]", docxRun{})
+		}
+		return
+	}
+
+	w.imageSeq++
+	ext := map[string]string{"jpeg": "jpeg", "png": "png", "gif": "gif"}[format]
+	name := fmt.Sprintf("image%d.%s", w.imageSeq, ext)
+	w.media = append(w.media, docxMedia{name: name, data: data})
+	id := w.addRel(fmt.Sprintf(`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/image" Target="media/%s"`, name))
+
+	cx, cy := int64(cfg.Width)*emuPerPixel, int64(cfg.Height)*emuPerPixel
+	if cx > maxImageWidth {
+		cy = cy * maxImageWidth / cx
+		cx = maxImageWidth
+	}
+	fmt.Fprintf(&w.body, docxImageRun, cx, cy, w.imageSeq, w.imageSeq, xmlEscape(alt), w.imageSeq, name, id, cx, cy)
+}
+
+// addRel 追加一条关系并返回其 Id；rId1-rId3 留给样式、编号和核心属性
+func (w *docxWriter) addRel(attrs string) string {
+	id := fmt.Sprintf("rId%d", len(w.rels)+10)
+	w.rels = append(w.rels, fmt.Sprintf(`<Relationship Id="%s" %s/>`, id, attrs))
+	return id
+}
+
+func (w *docxWriter) documentRels() string {
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>` +
+		strings.Join(w.rels, "") + `</Relationships>`
+}
+
+// numbering 生成编号定义：abstractNum 0 为项目符号，1 为数字；
+// numId 1 是项目符号，之后每个有序列表各占一个 numId 并重设起始值
+func (w *docxWriter) numbering() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">`)
+	bullets := []string{"•", "◦", "▪"}
+	for abs, kind := range []string{"bullet", "decimal"} {
+		fmt.Fprintf(&b, `<w:abstractNum w:abstractNumId="%d"><w:multiLevelType w:val="hybridMultilevel"/>`, abs)
+		for lvl := 0; lvl < 9; lvl++ {
+			text := fmt.Sprintf("%%%d.", lvl+1)
+			if kind == "bullet" {
+				text = bullets[lvl%len(bullets)]
+			}
+			fmt.Fprintf(&b, `<w:lvl w:ilvl="%d"><w:start w:val="1"/><w:numFmt w:val="%s"/><w:lvlText w:val="%s"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="%d" w:hanging="360"/></w:pPr></w:lvl>`,
+				lvl, kind, text, (lvl+1)*indentPerLvl+300)
+		}
+		b.WriteString(`</w:abstractNum>`)
+	}
+	b.WriteString(`<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>`)
+	for i, start := range w.nums {
+		fmt.Fprintf(&b, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/>`, i+2)
+		for lvl := 0; lvl < 9; lvl++ {
+			fmt.Fprintf(&b, `<w:lvlOverride w:ilvl="%d"><w:startOverride w:val="%d"/></w:lvlOverride>`, lvl, start)
+		}
+		b.WriteString(`</w:num>`)
+	}
+	b.WriteString(`</w:numbering>`)
+	return b.String()
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;")
+
+// xmlEscape 转义 XML 特殊字符并去掉 XML 1.0 不允许的控制字符
+func xmlEscape(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	return xmlEscaper.Replace(s)
+}
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+	`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+	`<Default Extension="xml" ContentType="application/xml"/>` +
+	`<Default Extension="png" ContentType="image/png"/>` +
+	`<Default Extension="jpeg" ContentType="image/jpeg"/>` +
+	`<Default Extension="gif" ContentType="image/gif"/>` +
+	`<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>` +
+	`<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>` +
+	`<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>` +
+	`<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>` +
+	`</Types>`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>` +
+	`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>` +
+	`</Relationships>`
+
+const docxCoreProps = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">` +
+	`<dc:title>%s</dc:title><dc:creator>CollabStudio</dc:creator></cp:coreProperties>`
+
+const docxDocumentHead = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"` +
+	` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"` +
+	` xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"` +
+	` xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"` +
+	` xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture"><w:body>`
+
+const docxDocumentTail = `<w:sectPr><w:pgSz w:w="11906" w:h="16838"/>` +
+	`<w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="720" w:footer="720" w:gutter="0"/></w:sectPr></w:body></w:document>`
+
+// docxImageRun 参数依次为：cx, cy, docPr id, 名称序号, 替代文本, cNvPr id, 文件名, 关系 Id, cx, cy
+const docxImageRun = `<w:r><w:drawing><wp:inline distT="0" distB="0" distL="0" distR="0">` +
+	`<wp:extent cx="%d" cy="%d"/><wp:docPr id="%d" name="Picture %d" descr="%s"/>` +
+	`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>` +
+	`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>` +
+	`<pic:nvPicPr><pic:cNvPr id="%d" name="%s"/><pic:cNvPicPr/></pic:nvPicPr>` +
+	`<pic:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>` +
+	`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>` +
+	`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing></w:r>`
+
+const docxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">` +
+	`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Calibri" w:hAnsi="Calibri" w:eastAsia="Microsoft YaHei" w:cs="Calibri"/><w:sz w:val="22"/></w:rPr></w:rPrDefault>` +
+	`<w:pPrDefault><w:pPr><w:spacing w:after="120" w:line="300" w:lineRule="auto"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+	`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading1"><w:name w:val="heading 1"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="360" w:after="120"/><w:outlineLvl w:val="0"/></w:pPr><w:rPr><w:b/><w:sz w:val="36"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="300" w:after="120"/><w:outlineLvl w:val="1"/></w:pPr><w:rPr><w:b/><w:sz w:val="30"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading3"><w:name w:val="heading 3"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="80"/><w:outlineLvl w:val="2"/></w:pPr><w:rPr><w:b/><w:sz w:val="26"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading4"><w:name w:val="heading 4"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:outlineLvl w:val="3"/></w:pPr><w:rPr><w:b/><w:sz w:val="24"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading5"><w:name w:val="heading 5"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:outlineLvl w:val="4"/></w:pPr><w:rPr><w:b/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading6"><w:name w:val="heading 6"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:outlineLvl w:val="5"/></w:pPr><w:rPr><w:b/><w:color w:val="57606A"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Quote"><w:name w:val="Quote"/><w:basedOn w:val="Normal"/><w:pPr><w:pBdr><w:left w:val="single" w:sz="18" w:space="8" w:color="D0D7DE"/></w:pBdr><w:ind w:left="360"/></w:pPr><w:rPr><w:color w:val="57606A"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Code"><w:name w:val="Code"/><w:basedOn w:val="Normal"/><w:pPr><w:shd w:val="clear" w:color="auto" w:fill="F6F8FA"/><w:spacing w:after="0" w:line="240" w:lineRule="auto"/></w:pPr><w:rPr><w:rFonts w:ascii="Consolas" w:hAnsi="Consolas" w:cs="Consolas"/><w:sz w:val="20"/></w:rPr></w:style>` +
+	`<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>` +
+	`</w:styles>`
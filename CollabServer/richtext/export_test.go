@@ -0,0 +1,122 @@
+package richtext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+)
+
+const sampleDoc = `<h2>周会 <em>纪要</em></h2>` +
+	`<p>这是 <strong>加粗</strong>、<s>删除</s> 和 <code>a*b</code>，见 <a href="https://example.com/x">链接</a>。</p>` +
+	`<ul><li><p>一</p><ul><li><p>一.1</p></li></ul></li><li><p>二</p></li></ul>` +
+	`<ol start="3"><li><p>三</p></li><li><p>四</p></li></ol>` +
+	`<ul data-type="taskList"><li data-type="taskItem" data-checked="true"><label><input type="checkbox" checked="checked"><span></span></label><div><p>完成</p></div></li>` +
+	`<li data-type="taskItem" data-checked="false"><label><input type="checkbox"><span></span></label><div><p>待办</p></div></li></ul>` +
+	`<blockquote><p>引用</p></blockquote>` +
+	`<pre><code class="language-go">fmt.Println("hi")
+</code></pre>` +
+	`<p># 不是标题</p><hr><p><img src="/uploads/1.png" alt="图"></p>`
+
+func TestMarkdownConvertsTiptapNodes(t *testing.T) {
+	want := "## 周会 *纪要*\n\n" +
+		"这是 **加粗**、~~删除~~ 和 `a*b`，见 [链接](https://example.com/x)。\n\n" +
+		"- 一\n  - 一.1\n- 二\n\n" +
+		"3. 三\n4. 四\n\n" +
+		"- [x] 完成\n- [ ] 待办\n\n" +
+		"> 引用\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n" +
+		"\\# 不是标题\n\n---\n\n![图](/uploads/1.png)\n"
+	if got := Markdown(sampleDoc); got != want {
+		t.Fatalf("unexpected markdown:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTextKeepsStructureWithoutMarkup(t *testing.T) {
+	got := Text(sampleDoc)
+	for _, want := range []string{"周会 纪要\n\n", "见 链接 (https://example.com/x)。", "• 一\n  • 一.1\n• 二", "3. 三\n4. 四", "[x] 完成\n[ ] 待办", "  引用", "fmt.Println(\"hi\")"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in text export:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "**") || strings.Contains(got, "<") {
+		t.Fatalf("expected no markup in text export:\n%s", got)
+	}
+}
+
+func testPNG(t *testing.T) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 4, 2))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStandaloneHTMLEmbedsImages(t *testing.T) {
+	data := testPNG(t)
+	loader := func(src string) ([]byte, string, bool) {
+		return data, "image/png", src == "/uploads/1.png"
+	}
+	out := StandaloneHTML("<周会>", `<p><img src="/uploads/1.png"><img src="https://cdn.example.com/2.png"></p>`, loader)
+	if !strings.Contains(out, `src="data:image/png;base64,`+base64.StdEncoding.EncodeToString(data)+`"`) {
+		t.Fatal("expected local image to be embedded")
+	}
+	if !strings.Contains(out, `src="https://cdn.example.com/2.png"`) {
+		t.Fatal("expected unreadable image to keep its src")
+	}
+	if !strings.Contains(out, "<title>&lt;周会&gt;</title>") {
+		t.Fatal("expected escaped title")
+	}
+}
+
+func TestDOCXContainsParagraphsListsAndImages(t *testing.T) {
+	data := testPNG(t)
+	loader := func(src string) ([]byte, string, bool) { return data, "image/png", true }
+	out, err := DOCX("周会", sampleDoc, loader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		parts[f.Name] = string(b)
+	}
+
+	doc := parts["word/document.xml"]
+	for _, want := range []string{
+		`<w:pStyle w:val="Heading2"/>`,
+		`<w:i/></w:rPr><w:t xml:space="preserve">纪要</w:t>`,
+		`<w:numPr><w:ilvl w:val="1"/><w:numId w:val="1"/></w:numPr>`,
+		`<w:numId w:val="2"/>`,
+		`☑ `,
+		`<w:pStyle w:val="Code"/>`,
+		`fmt.Println(&quot;hi&quot;)`,
+		`<a:blip r:embed="rId`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Fatalf("expected %q in document.xml", want)
+		}
+	}
+	if !strings.Contains(parts["word/numbering.xml"], `<w:startOverride w:val="3"/>`) {
+		t.Fatal("expected ordered list to restart at 3")
+	}
+	if !strings.Contains(parts["word/_rels/document.xml.rels"], `Target="https://example.com/x" TargetMode="External"`) {
+		t.Fatal("expected hyperlink relationship")
+	}
+	if _, ok := parts["word/media/image1.png"]; !ok {
+		t.Fatal("expected embedded image")
+	}
+}
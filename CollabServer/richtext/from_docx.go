@@ -0,0 +1,503 @@
+package richtext
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"html"
+	"io"
+	"path"
+	"strings"
+)
+
+// =============================================================================
+// DOCX → Tiptap HTML
+// =============================================================================
+// 读取 word/document.xml，按段落样式识别标题、引用与代码，按 numbering.xml 识别
+// 有序/无序列表及层级；表格按单元格顺序展开为段落。图片交给 ImageSaver 保存，
+// 保存失败时以替代文本代替。修订中被删除的内容（w:del）会被忽略。
+// =============================================================================
+
+// ErrInvalidDOCX 表示文件不是有效的 .docx
+var ErrInvalidDOCX = errors.New("不是有效的 DOCX 文件")
+
+// 解压单个部件的上限，防止压缩炸弹
+const maxDOCXPartSize = 64 << 20
+
+// ImageSaver 保存导入文档中的图片，返回可写入文档的地址
+type ImageSaver func(data []byte, name string) (src string, ok bool)
+
+// xnode 是通用的 XML 元素树，只按本地名匹配，忽略命名空间前缀
+type xnode struct {
+	XMLName xml.Name
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []xnode    `xml:",any"`
+	Text    string     `xml:",chardata"`
+}
+
+func (n *xnode) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func (n *xnode) child(local string) *xnode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == local {
+			return &n.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// find 深度优先查找第一个指定本地名的后代
+func (n *xnode) find(local string) *xnode {
+	for i := range n.Nodes {
+		if n.Nodes[i].XMLName.Local == local {
+			return &n.Nodes[i]
+		}
+		if found := n.Nodes[i].find(local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// on 判断 w:b、w:i 等开关属性是否开启（缺省 val 表示开启）
+func (n *xnode) on(local string) bool {
+	c := n.child(local)
+	if c == nil {
+		return false
+	}
+	switch c.attr("val") {
+	case "0", "false", "none":
+		return false
+	}
+	return true
+}
+
+type docxStyle struct {
+	heading int // 1-6，0 表示不是标题
+	quote   bool
+	code    bool
+}
+
+type docxReader struct {
+	files     map[string]*zip.File
+	rels      map[string]string // 关系 Id → 目标
+	styles    map[string]docxStyle
+	numFormat map[string]map[string]string // numId → ilvl → numFmt
+	saver     ImageSaver
+}
+
+// FromDOCX 把 .docx 转换为清洗后的 Tiptap HTML
+func FromDOCX(data []byte, saver ImageSaver) (string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", ErrInvalidDOCX
+	}
+	r := &docxReader{files: map[string]*zip.File{}, saver: saver}
+	for _, f := range zr.File {
+		r.files[f.Name] = f
+	}
+
+	var doc xnode
+	if err := r.parse("word/document.xml", &doc); err != nil {
+		return "", ErrInvalidDOCX
+	}
+	r.loadRels()
+	r.loadStyles()
+	r.loadNumbering()
+
+	body := doc.child("body")
+	if body == nil {
+		return "", ErrInvalidDOCX
+	}
+	var paras []*xnode
+	collectParagraphs(body, &paras)
+
+	w := &docxHTML{}
+	for _, p := range paras {
+		r.paragraph(p, w)
+	}
+	w.closeAll()
+	return Sanitize(w.b.String()), nil
+}
+
+func (r *docxReader) read(name string) ([]byte, bool) {
+	f, ok := r.files[name]
+	if !ok || f.UncompressedSize64 > maxDOCXPartSize {
+		return nil, false
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, false
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxDOCXPartSize))
+	return data, err == nil
+}
+
+func (r *docxReader) parse(name string, v *xnode) error {
+	data, ok := r.read(name)
+	if !ok {
+		return ErrInvalidDOCX
+	}
+	return xml.Unmarshal(data, v)
+}
+
+func (r *docxReader) loadRels() {
+	r.rels = map[string]string{}
+	var rels xnode
+	if r.parse("word/_rels/document.xml.rels", &rels) != nil {
+		return
+	}
+	for _, rel := range rels.Nodes {
+		target := rel.attr("Target")
+		if rel.attr("TargetMode") != "External" {
+			target = path.Join("word", target)
+		}
+		r.rels[rel.attr("Id")] = target
+	}
+}
+
+// loadStyles 按样式名与大纲级别识别标题；中文版 Word 的样式 Id 是 “1”、“2” 这样的数字，不能只看 Id
+func (r *docxReader) loadStyles() {
+	r.styles = map[string]docxStyle{}
+	var styles xnode
+	if r.parse("word/styles.xml", &styles) != nil {
+		return
+	}
+	for i := range styles.Nodes {
+		s := &styles.Nodes[i]
+		if s.XMLName.Local != "style" {
+			continue
+		}
+		name := ""
+		if n := s.child("name"); n != nil {
+			name = strings.ToLower(n.attr("val"))
+		}
+		var st docxStyle
+		switch {
+		case name == "title":
+			st.heading = 1
+		case name == "subtitle":
+			st.heading = 2
+		case strings.HasPrefix(name, "heading ") && len(name) == len("heading 1"):
+			st.heading = int(name[len(name)-1] - '0')
+		}
+		if pPr := s.child("pPr"); pPr != nil && st.heading == 0 {
+			if lvl := pPr.child("outlineLvl"); lvl != nil {
+				if v := lvl.attr("val"); len(v) == 1 && v[0] >= '0' && v[0] <= '5' {
+					st.heading = int(v[0]-'0') + 1
+				}
+			}
+		}
+		if st.heading > 6 || st.heading < 0 {
+			st.heading = 0
+		}
+		st.quote = strings.Contains(name, "quote")
+		st.code = strings.Contains(name, "code") || strings.Contains(name, "preformatted") || strings.Contains(name, "source")
+		r.styles[s.attr("styleId")] = st
+	}
+}
+
+func (r *docxReader) loadNumbering() {
+	r.numFormat = map[string]map[string]string{}
+	var numbering xnode
+	if r.parse("word/numbering.xml", &numbering) != nil {
+		return
+	}
+	abstract := map[string]map[string]string{}
+	for _, n := range numbering.Nodes {
+		if n.XMLName.Local != "abstractNum" {
+			continue
+		}
+		levels := map[string]string{}
+		for _, lvl := range n.Nodes {
+			if lvl.XMLName.Local == "lvl" {
+				if f := lvl.child("numFmt"); f != nil {
+					levels[lvl.attr("ilvl")] = f.attr("val")
+				}
+			}
+		}
+		abstract[n.attr("abstractNumId")] = levels
+	}
+	for _, n := range numbering.Nodes {
+		if n.XMLName.Local == "num" {
+			if a := n.child("abstractNumId"); a != nil {
+				r.numFormat[n.attr("numId")] = abstract[a.attr("val")]
+			}
+		}
+	}
+}
+
+// collectParagraphs 按文档顺序收集段落，表格、内容控件等容器直接展开
+func collectParagraphs(n *xnode, out *[]*xnode) {
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "p":
+			*out = append(*out, c)
+		case "tbl", "tr", "tc", "sdt", "sdtContent", "customXml", "ins", "smartTag":
+			collectParagraphs(c, out)
+		}
+	}
+}
+
+func (r *docxReader) paragraph(p *xnode, w *docxHTML) {
+	var style docxStyle
+	numID, ilvl := "", 0
+	if pPr := p.child("pPr"); pPr != nil {
+		if ps := pPr.child("pStyle"); ps != nil {
+			style = r.styles[ps.attr("val")]
+		}
+		if numPr := pPr.child("numPr"); numPr != nil {
+			if id := numPr.child("numId"); id != nil {
+				numID = id.attr("val")
+			}
+			if lvl := numPr.child("ilvl"); lvl != nil && len(lvl.attr("val")) == 1 {
+				ilvl = int(lvl.attr("val")[0] - '0')
+			}
+		}
+	}
+
+	if style.code {
+		w.codeLine(r.plainText(p))
+		return
+	}
+	content := r.inline(p, docxRun{})
+
+	if numID != "" && numID != "0" && style.heading == 0 {
+		tag := "ul"
+		if f := r.numFormat[numID][string(rune('0'+ilvl))]; f != "" && f != "bullet" && f != "none" {
+			tag = "ol"
+		}
+		w.listItem(ilvl, tag, content)
+		return
+	}
+	if style.heading > 0 {
+		level := string(rune('0' + style.heading))
+		w.block("<h"+level+">"+content+"</h"+level+">", false)
+		return
+	}
+	w.block("<p>"+content+"</p>", style.quote)
+}
+
+// inline 把段落或超链接中的 run 转换为行内 HTML
+func (r *docxReader) inline(n *xnode, inherited docxRun) string {
+	var b strings.Builder
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "r":
+			b.WriteString(r.run(c, inherited))
+		case "hyperlink":
+			run := inherited
+			if target, ok := r.rels[c.attr("id")]; ok && isSafeHref(target) {
+				run.link = target
+			}
+			b.WriteString(r.inline(c, run))
+		case "ins", "smartTag", "customXml", "sdt", "sdtContent", "fldSimple":
+			b.WriteString(r.inline(c, inherited))
+		}
+	}
+	return b.String()
+}
+
+func (r *docxReader) run(n *xnode, run docxRun) string {
+	if rPr := n.child("rPr"); rPr != nil {
+		run.bold = run.bold || rPr.on("b")
+		run.italic = run.italic || rPr.on("i")
+		run.underline = run.underline || rPr.on("u")
+		run.strike = run.strike || rPr.on("strike") || rPr.on("dstrike")
+		if fonts := rPr.child("rFonts"); fonts != nil {
+			font := strings.ToLower(fonts.attr("ascii"))
+			run.code = run.code || strings.Contains(font, "consolas") || strings.Contains(font, "courier") || strings.Contains(font, "mono")
+		}
+	}
+
+	var b strings.Builder
+	for i := range n.Nodes {
+		c := &n.Nodes[i]
+		switch c.XMLName.Local {
+		case "t":
+			b.WriteString(html.EscapeString(c.Text))
+		case "tab":
+			b.WriteString(" ")
+		case "br", "cr":
+			if c.attr("type") != "page" {
+				b.WriteString("<br>")
+			}
+		case "drawing", "pict":
+			b.WriteString(r.image(c))
+		}
+	}
+	if b.Len() == 0 {
+		return ""
+	}
+	return wrapRun(b.String(), run)
+}
+
+func wrapRun(s string, run docxRun) string {
+	if run.code {
+		s = "<code>" + s + "</code>"
+	}
+	if run.strike {
+		s = "<s>" + s + "</s>"
+	}
+	if run.underline {
+		s = "<u>" + s + "</u>"
+	}
+	if run.italic {
+		s = "<em>" + s + "</em>"
+	}
+	if run.bold {
+		s = "<strong>" + s + "</strong>"
+	}
+	if run.link != "" {
+		s = `<a href="` + html.EscapeString(run.link) + `">` + s + "</a>"
+	}
+	return s
+}
+
+// image 处理 w:drawing（a:blip r:embed）与旧式 w:pict（v:imagedata r:id）
+func (r *docxReader) image(n *xnode) string {
+	alt := ""
+	if docPr := n.find("docPr"); docPr != nil {
+		alt = docPr.attr("descr")
+	}
+	id := ""
+	if blip := n.find("blip"); blip != nil {
+		id = blip.attr("embed")
+	} else if data := n.find("imagedata"); data != nil {
+		id = data.attr("id")
+	}
+	target, ok := r.rels[id]
+	if !ok || r.saver == nil {
+		return html.EscapeString(alt)
+	}
+	data, ok := r.read(target)
+	if !ok {
+		return html.EscapeString(alt)
+	}
+	src, ok := r.saver(data, path.Base(target))
+	if !ok {
+		return html.EscapeString(alt)
+	}
+	return `<img src="` + html.EscapeString(src) + `" alt="` + html.EscapeString(alt) + `">`
+}
+
+// plainText 返回段落文字（用于代码块，保留制表符与换行）
+func (r *docxReader) plainText(n *xnode) string {
+	var b strings.Builder
+	var walk func(*xnode)
+	walk = func(n *xnode) {
+		switch n.XMLName.Local {
+		case "t":
+			b.WriteString(n.Text)
+			return
+		case "tab":
+			b.WriteString("\t")
+			return
+		case "br", "cr":
+			b.WriteString("\n")
+			return
+		case "del", "drawing", "pict":
+			return
+		}
+		for i := range n.Nodes {
+			walk(&n.Nodes[i])
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+// docxHTML 把逐段输出的内容组织起来：列表按层级嵌套，连续的代码段落合并为一个代码块，
+// 连续的引用段落合并为一个引用
+type docxHTML struct {
+	b     strings.Builder
+	lists []string // 当前打开的列表标签，每层都有一个未关闭的 <li>
+	code  []string
+	quote []string
+}
+
+func (w *docxHTML) codeLine(line string) {
+	w.closeLists()
+	w.flushQuote()
+	w.code = append(w.code, line)
+}
+
+func (w *docxHTML) block(content string, quote bool) {
+	w.flushCode()
+	w.closeLists()
+	if quote {
+		w.quote = append(w.quote, content)
+		return
+	}
+	w.flushQuote()
+	w.b.WriteString(content)
+}
+
+func (w *docxHTML) listItem(level int, tag, content string) {
+	w.flushCode()
+	w.flushQuote()
+	level = min(level, 8)
+	for len(w.lists) > level+1 {
+		w.closeList()
+	}
+	if len(w.lists) == level+1 && w.lists[level] != tag {
+		w.closeList()
+	}
+	if len(w.lists) == level+1 {
+		w.b.WriteString("</li><li><p>" + content + "</p>")
+		return
+	}
+	// 跳级缩进时补上空的中间层
+	for len(w.lists) < level+1 {
+		if len(w.lists) > 0 && len(w.lists) < level {
+			w.b.WriteString("<" + tag + "><li><p></p>")
+		} else {
+			w.b.WriteString("<" + tag + "><li>")
+		}
+		w.lists = append(w.lists, tag)
+	}
+	w.b.WriteString("<p>" + content + "</p>")
+}
+
+func (w *docxHTML) closeList() {
+	tag := w.lists[len(w.lists)-1]
+	w.lists = w.lists[:len(w.lists)-1]
+	w.b.WriteString("</li></" + tag + ">")
+}
+
+func (w *docxHTML) closeLists() {
+	for len(w.lists) > 0 {
+		w.closeList()
+	}
+}
+
+func (w *docxHTML) flushCode() {
+	if len(w.code) > 0 {
+		w.b.WriteString("<pre><code>" + html.EscapeString(strings.Join(w.code, "\n")) + "</code></pre>")
+		w.code = nil
+	}
+}
+
+func (w *docxHTML) flushQuote() {
+	if len(w.quote) > 0 {
+		w.b.WriteString("<blockquote>" + strings.Join(w.quote, "") + "</blockquote>")
+		w.quote = nil
+	}
+}
+
+func (w *docxHTML) closeAll() {
+	w.flushCode()
+	w.flushQuote()
+	w.closeLists()
+}
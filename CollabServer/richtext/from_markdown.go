@@ -0,0 +1,659 @@
+package richtext
+
+import (
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// Markdown → Tiptap HTML
+// =============================================================================
+// 覆盖编辑器能表示的 CommonMark 子集与 GFM 扩展：标题、段落、引用、有序/无序/任务列表、
+// 围栏与缩进代码块、分隔线、强调、删除线、行内代码、链接、图片、自动链接与硬换行。
+// 行内 HTML 原样保留，最终结果统一经过 Sanitize。列表项内容总是包在 <p> 中，与编辑器一致。
+// =============================================================================
+
+var (
+	atxHeading    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	thematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:\*[ \t]*){3,}|(?:-[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	fenceOpen     = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	listMarker    = regexp.MustCompile(`^( {0,3})([-*+]|\d{1,9}[.)])([ \t]+|$)`)
+	setextH1      = regexp.MustCompile(`^ {0,3}=+[ \t]*$`)
+	setextH2      = regexp.MustCompile(`^ {0,3}-+[ \t]*$`)
+	taskMarker    = regexp.MustCompile(`^\[([ xX])\](?:[ \t]+|$)`)
+	inlineTag     = regexp.MustCompile(`^</?[A-Za-z][A-Za-z0-9-]*(?:\s+[A-Za-z_:][A-Za-z0-9_.:-]*(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s"'=<>` + "`" + `]+))?)*\s*/?>`)
+	autoLink      = regexp.MustCompile(`^<((?:https?|mailto):[^\s<>]*)>`)
+	bareURL       = regexp.MustCompile(`^https?://[^\s<]*[^\s<.,:;"')\]!?]`)
+	blankLine     = regexp.MustCompile(`\n[ \t]*\n`)
+)
+
+// FromMarkdown 把 Markdown 转换为清洗后的 Tiptap HTML
+func FromMarkdown(md string) string {
+	md = strings.ReplaceAll(md, "\r\n", "\n")
+	md = strings.ReplaceAll(md, "\r", "\n")
+	md = strings.TrimPrefix(md, "\ufeff")
+	return Sanitize(markdownBlocks(strings.Split(md, "\n")))
+}
+
+// FromText 把纯文本转换为 HTML：空行分段，段内换行保留为 <br>
+func FromText(text string) string {
+	text = strings.ReplaceAll(strings.TrimPrefix(text, "\ufeff"), "\r\n", "\n")
+	var b strings.Builder
+	for _, para := range blankLine.Split(text, -1) {
+		para = strings.Trim(para, "\n")
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+		lines := strings.Split(para, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// expandTabs 把行首缩进中的制表符展开为 4 列
+func expandTabs(line string) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	col := 0
+	for i, r := range line {
+		if r != ' ' && r != '\t' {
+			b.WriteString(line[i:])
+			return b.String()
+		}
+		if r == '\t' {
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+		} else {
+			b.WriteByte(' ')
+			col++
+		}
+	}
+	return b.String()
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// startsBlock 判断该行能否打断段落
+func startsBlock(line string) bool {
+	if atxHeading.MatchString(line) || thematicBreak.MatchString(line) || fenceOpen.MatchString(line) {
+		return true
+	}
+	if t := strings.TrimLeft(line, " "); indentOf(line) < 4 && strings.HasPrefix(t, ">") {
+		return true
+	}
+	// 有序列表只有从 1 开始时才能打断段落，避免把正文里的 “2020. 年” 误判为列表
+	if m := listMarker.FindStringSubmatch(line); m != nil && !isBlank(line[len(m[0]):]) {
+		marker := m[2]
+		return !isDigit(marker[0]) || strings.TrimRight(marker, ".)") == "1"
+	}
+	return false
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func markdownBlocks(lines []string) string {
+	for i := range lines {
+		lines[i] = expandTabs(lines[i])
+	}
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case fenceOpen.MatchString(line):
+			m := fenceOpen.FindStringSubmatch(line)
+			indent, fence := len(m[1]), m[2]
+			lang := strings.Fields(html.UnescapeString(m[3]))
+			var code []string
+			i++
+			for ; i < len(lines); i++ {
+				t := strings.TrimLeft(lines[i], " ")
+				if indentOf(lines[i]) < 4 && strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]+" \t") == "" {
+					i++
+					break
+				}
+				l := lines[i]
+				l = l[min(indent, indentOf(l)):]
+				code = append(code, l)
+			}
+			b.WriteString("<pre><code")
+			if len(lang) > 0 {
+				b.WriteString(` class="language-` + html.EscapeString(lang[0]) + `"`)
+			}
+			b.WriteString(">" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case indentOf(line) >= 4:
+			var code []string
+			for ; i < len(lines) && (indentOf(lines[i]) >= 4 || isBlank(lines[i])); i++ {
+				l := lines[i]
+				if len(l) >= 4 {
+					l = l[4:]
+				} else {
+					l = ""
+				}
+				code = append(code, l)
+			}
+			for len(code) > 0 && code[len(code)-1] == "" {
+				code = code[:len(code)-1]
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>")
+
+		case atxHeading.MatchString(line):
+			m := atxHeading.FindStringSubmatch(line)
+			level := strconv.Itoa(len(m[1]))
+			b.WriteString("<h" + level + ">" + markdownInline(m[2]) + "</h" + level + ">")
+			i++
+
+		case thematicBreak.MatchString(line):
+			b.WriteString("<hr>")
+			i++
+
+		case strings.HasPrefix(strings.TrimLeft(line, " "), ">"):
+			var inner []string
+			for ; i < len(lines); i++ {
+				t := strings.TrimLeft(lines[i], " ")
+				if strings.HasPrefix(t, ">") && indentOf(lines[i]) < 4 {
+					t = strings.TrimPrefix(t, ">")
+					t = strings.TrimPrefix(t, " ")
+					inner = append(inner, t)
+					continue
+				}
+				// 懒惰续行：引用中的段落可以省略后续行的 >
+				if !isBlank(lines[i]) && len(inner) > 0 && !isBlank(inner[len(inner)-1]) && !startsBlock(lines[i]) {
+					inner = append(inner, lines[i])
+					continue
+				}
+				break
+			}
+			b.WriteString("<blockquote>" + markdownBlocks(inner) + "</blockquote>")
+
+		case listMarker.MatchString(line):
+			var list string
+			list, i = markdownList(lines, i)
+			b.WriteString(list)
+
+		default:
+			var para []string
+			for ; i < len(lines); i++ {
+				if isBlank(lines[i]) || (len(para) > 0 && startsBlock(lines[i])) {
+					break
+				}
+				if len(para) > 0 && setextH1.MatchString(lines[i]) {
+					b.WriteString("<h1>" + markdownInline(strings.Join(para, "\n")) + "</h1>")
+					para = nil
+					i++
+					break
+				}
+				if len(para) > 0 && setextH2.MatchString(lines[i]) {
+					b.WriteString("<h2>" + markdownInline(strings.Join(para, "\n")) + "</h2>")
+					para = nil
+					i++
+					break
+				}
+				para = append(para, strings.TrimLeft(lines[i], " "))
+			}
+			if len(para) > 0 {
+				b.WriteString("<p>" + markdownInline(strings.Join(para, "\n")) + "</p>")
+			}
+		}
+	}
+	return b.String()
+}
+
+// markdownList 解析从 lines[start] 开始的一个列表，返回 HTML 与下一行的位置
+func markdownList(lines []string, start int) (string, int) {
+	first := listMarker.FindStringSubmatch(lines[start])
+	ordered := isDigit(first[2][0])
+	delim := first[2][len(first[2])-1:]
+
+	type item struct {
+		body    []string
+		task    bool
+		checked bool
+	}
+	var items []item
+	i := start
+	for i < len(lines) {
+		m := listMarker.FindStringSubmatch(lines[i])
+		if m == nil || isDigit(m[2][0]) != ordered || m[2][len(m[2])-1:] != delim {
+			break
+		}
+		// 内容缩进：标记宽度 + 空格（超过 4 个空格时视为 1 个，其余属于缩进代码）
+		spaces := len(m[3])
+		if spaces > 4 || isBlank(lines[i][len(m[0]):]) {
+			spaces = 1
+		}
+		contentIndent := len(m[1]) + len(m[2]) + spaces
+		firstLine := lines[i][min(len(lines[i]), len(m[1])+len(m[2])+spaces):]
+
+		it := item{body: []string{firstLine}}
+		if tm := taskMarker.FindStringSubmatch(firstLine); tm != nil {
+			it.task = true
+			it.checked = tm[1] != " "
+			it.body[0] = firstLine[len(tm[0]):]
+		}
+		i++
+		for i < len(lines) {
+			l := lines[i]
+			switch {
+			case isBlank(l):
+				// 空行之后没有缩进内容则列表项结束
+				j := i
+				for j < len(lines) && isBlank(lines[j]) {
+					j++
+				}
+				if j < len(lines) && indentOf(lines[j]) >= contentIndent {
+					for ; i < j; i++ {
+						it.body = append(it.body, "")
+					}
+					continue
+				}
+				goto itemDone
+			case indentOf(l) >= contentIndent:
+				it.body = append(it.body, l[contentIndent:])
+			case !isBlank(it.body[len(it.body)-1]) && !startsBlock(l) && !listMarker.MatchString(l):
+				// 懒惰续行
+				it.body = append(it.body, strings.TrimLeft(l, " "))
+			default:
+				goto itemDone
+			}
+			i++
+		}
+	itemDone:
+		items = append(items, it)
+		// 列表项之间的空行
+		j := i
+		for j < len(lines) && isBlank(lines[j]) {
+			j++
+		}
+		if j < len(lines) {
+			if m := listMarker.FindStringSubmatch(lines[j]); m != nil && isDigit(m[2][0]) == ordered && m[2][len(m[2])-1:] == delim {
+				i = j
+				continue
+			}
+		}
+		break
+	}
+
+	allTasks := len(items) > 0
+	for _, it := range items {
+		allTasks = allTasks && it.task
+	}
+
+	var b strings.Builder
+	switch {
+	case allTasks:
+		b.WriteString(`<ul data-type="taskList">`)
+	case ordered:
+		n, _ := strconv.Atoi(strings.TrimRight(first[2], ".)"))
+		if n != 1 {
+			b.WriteString(`<ol start="` + strconv.Itoa(n) + `">`)
+		} else {
+			b.WriteString("<ol>")
+		}
+	default:
+		b.WriteString("<ul>")
+	}
+	for _, it := range items {
+		body := it.body
+		if !allTasks && it.task {
+			// 混合列表中的任务标记按原文保留
+			mark := " "
+			if it.checked {
+				mark = "x"
+			}
+			body = append([]string{"[" + mark + "] " + body[0]}, body[1:]...)
+		}
+		inner := markdownBlocks(body)
+		// 编辑器的列表项必须以段落开头
+		if !strings.HasPrefix(inner, "<p>") {
+			inner = "<p></p>" + inner
+		}
+		if allTasks {
+			b.WriteString(`<li data-type="taskItem" data-checked="` + strconv.FormatBool(it.checked) + `">` + inner + "</li>")
+		} else {
+			b.WriteString("<li>" + inner + "</li>")
+		}
+	}
+	if ordered && !allTasks {
+		b.WriteString("</ol>")
+	} else {
+		b.WriteString("</ul>")
+	}
+	return b.String(), i
+}
+
+// markdownInline 解析行内语法
+func markdownInline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			b.WriteString("<br>")
+			i += 2
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			fence := s[i : i+n]
+			end := findCodeClose(s, i+n, fence)
+			if end < 0 {
+				b.WriteString(fence)
+				i += n
+				continue
+			}
+			code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+			if len(code) >= 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			i = end + n
+
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if text, dest, title, next, ok := parseLink(s, i+1); ok {
+				b.WriteString(`<img src="` + html.EscapeString(dest) + `" alt="` + html.EscapeString(PlainText(markdownInline(text))) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">")
+				i = next
+				continue
+			}
+			b.WriteString("!")
+			i++
+
+		case c == '[':
+			if text, dest, title, next, ok := parseLink(s, i); ok {
+				b.WriteString(`<a href="` + html.EscapeString(dest) + `"`)
+				if title != "" {
+					b.WriteString(` title="` + html.EscapeString(title) + `"`)
+				}
+				b.WriteString(">" + markdownInline(text) + "</a>")
+				i = next
+				continue
+			}
+			b.WriteString("[")
+			i++
+
+		case c == '<':
+			if m := autoLink.FindStringSubmatch(s[i:]); m != nil {
+				b.WriteString(`<a href="` + html.EscapeString(m[1]) + `">` + html.EscapeString(m[1]) + "</a>")
+				i += len(m[0])
+				continue
+			}
+			if m := inlineTag.FindString(s[i:]); m != "" {
+				b.WriteString(m)
+				i += len(m)
+				continue
+			}
+			b.WriteString("&lt;")
+			i++
+
+		case c == 'h' && (i == 0 || !isWordByte(s[i-1])) && bareURL.MatchString(s[i:]):
+			u := bareURL.FindString(s[i:])
+			b.WriteString(`<a href="` + html.EscapeString(u) + `">` + html.EscapeString(u) + "</a>")
+			i += len(u)
+
+		case c == '*' || c == '_' || c == '~':
+			out, next, ok := parseEmphasis(s, i)
+			if ok {
+				b.WriteString(out)
+				i = next
+				continue
+			}
+			n := runLength(s, i, c)
+			b.WriteString(s[i : i+n])
+			i += n
+
+		case c == '\n':
+			// 行尾两个以上空格表示硬换行
+			if strings.HasSuffix(b.String(), "  ") {
+				trimmed := strings.TrimRight(b.String(), " ")
+				b.Reset()
+				b.WriteString(trimmed + "<br>")
+			} else {
+				b.WriteString("\n")
+			}
+			i++
+
+		default:
+			j := i + 1
+			for j < len(s) && !strings.ContainsRune("\\`![<*_~\nh", rune(s[j])) {
+				j++
+			}
+			b.WriteString(html.EscapeString(s[i:j]))
+			i = j
+		}
+	}
+	return b.String()
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// findCodeClose 查找长度完全相同的反引号串
+func findCodeClose(s string, from int, fence string) int {
+	for j := from; j < len(s); {
+		k := strings.Index(s[j:], fence)
+		if k < 0 {
+			return -1
+		}
+		k += j
+		if runLength(s, k, '`') == len(fence) {
+			return k
+		}
+		j = k + runLength(s, k, '`')
+	}
+	return -1
+}
+
+// parseLink 解析 [text](dest "title")，i 指向 '['
+func parseLink(s string, i int) (text, dest, title string, next int, ok bool) {
+	depth := 0
+	j := i
+	for ; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			n := runLength(s, j, '`')
+			if end := findCodeClose(s, j+n, s[j:j+n]); end >= 0 {
+				j = end + n - 1
+			} else {
+				j += n - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+		}
+		if depth == 0 {
+			break
+		}
+	}
+	if j >= len(s) || j+1 >= len(s) || s[j+1] != '(' {
+		return
+	}
+	text = s[i+1 : j]
+
+	k := j + 2
+	for k < len(s) && (s[k] == ' ' || s[k] == '\n') {
+		k++
+	}
+	if k < len(s) && s[k] == '<' {
+		end := strings.IndexAny(s[k+1:], ">\n")
+		if end < 0 || s[k+1+end] != '>' {
+			return
+		}
+		dest = s[k+1 : k+1+end]
+		k += end + 2
+	} else {
+		parens := 0
+		start := k
+		for ; k < len(s); k++ {
+			ch := s[k]
+			if ch == '\\' && k+1 < len(s) {
+				k++
+				continue
+			}
+			if ch == ' ' || ch == '\n' || ch < 0x20 {
+				break
+			}
+			if ch == '(' {
+				parens++
+			}
+			if ch == ')' {
+				if parens == 0 {
+					break
+				}
+				parens--
+			}
+		}
+		dest = s[start:k]
+	}
+	for k < len(s) && (s[k] == ' ' || s[k] == '\n') {
+		k++
+	}
+	if k < len(s) && (s[k] == '"' || s[k] == '\'' || s[k] == '(') {
+		closer := s[k]
+		if closer == '(' {
+			closer = ')'
+		}
+		end := strings.IndexByte(s[k+1:], closer)
+		if end < 0 {
+			return
+		}
+		title = s[k+1 : k+1+end]
+		k += end + 2
+		for k < len(s) && (s[k] == ' ' || s[k] == '\n') {
+			k++
+		}
+	}
+	if k >= len(s) || s[k] != ')' {
+		return
+	}
+	return text, unescapeMarkdown(dest), unescapeMarkdown(title), k + 1, true
+}
+
+// parseEmphasis 解析 *、_ 强调与 ~~ 删除线；找不到闭合标记时 ok 为 false
+func parseEmphasis(s string, i int) (string, int, bool) {
+	c := s[i]
+	n := runLength(s, i, c)
+	if c == '~' && n != 2 {
+		return "", 0, false
+	}
+	// 左侧定界：标记后不能是空白；下划线不能出现在单词中间
+	if i+n >= len(s) || isSpaceByte(s[i+n]) {
+		return "", 0, false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return "", 0, false
+	}
+	use := min(n, 3)
+	if c == '~' {
+		use = 2
+	}
+
+	for use > 0 {
+		if end := findEmphasisClose(s, i+n, c, use); end >= 0 {
+			inner := markdownInline(s[i+use : end])
+			prefix := strings.Repeat(string(c), n-use)
+			var out string
+			switch {
+			case c == '~':
+				out = "<s>" + inner + "</s>"
+			case use == 3:
+				out = "<em><strong>" + inner + "</strong></em>"
+			case use == 2:
+				out = "<strong>" + inner + "</strong>"
+			default:
+				out = "<em>" + inner + "</em>"
+			}
+			return html.EscapeString(prefix) + out, end + use, true
+		}
+		if c == '~' {
+			break
+		}
+		use--
+	}
+	return "", 0, false
+}
+
+// findEmphasisClose 查找长度为 use 的闭合标记：前面不能是空白，跳过行内代码和更长的标记串
+func findEmphasisClose(s string, from int, c byte, use int) int {
+	for j := from; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			n := runLength(s, j, '`')
+			if end := findCodeClose(s, j+n, s[j:j+n]); end >= 0 {
+				j = end + n - 1
+			}
+			continue
+		}
+		if s[j] != c {
+			continue
+		}
+		n := runLength(s, j, c)
+		if isSpaceByte(s[j-1]) || (c == '_' && j+n < len(s) && isWordByte(s[j+n])) {
+			j += n - 1
+			continue
+		}
+		switch {
+		case n == use, use == 3 && n > 3:
+			return j
+		case n == 3:
+			// “*a **b***”：三连标记先闭合内层，剩下的部分闭合外层
+			return j + 3 - use
+		}
+		// 长度不同的标记串（例如找 * 时遇到 **）属于其他强调
+		j += n - 1
+	}
+	return -1
+}
+
+func isSpaceByte(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+var markdownUnescaper = regexp.MustCompile("\\\\([!\"#$%&'()*+,\\-./:;<=>?@\\[\\\\\\]^_`{|}~])")
+
+func unescapeMarkdown(s string) string {
+	return html.UnescapeString(markdownUnescaper.ReplaceAllString(s, "$1"))
+}
@@ -0,0 +1,94 @@
+package richtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFromMarkdownProducesTiptapHTML(t *testing.T) {
+	md := "# 标题\n\n" +
+		"一段 **粗体**、*斜体*、~~删除~~、`code` 和 [链接](https://example.com \"t\")。\n" +
+		"第二行  \n硬换行\n\n" +
+		"- 一\n  - 一.1\n- 二\n\n" +
+		"3. 三\n4. 四\n\n" +
+		"- [x] 完成\n- [ ] 待办\n\n" +
+		"> 引用\n\n" +
+		"```go\nfmt.Println(\"<hi>\")\n```\n\n" +
+		"---\n\n![图](/uploads/1.png) <u>下划线</u> <script>alert(1)</script>\n"
+
+	want := "<h1>标题</h1>" +
+		`<p>一段 <strong>粗体</strong>、<em>斜体</em>、<s>删除</s>、<code>code</code> 和 <a href="https://example.com">链接</a>。` + "\n第二行<br/>硬换行</p>" +
+		"<ul><li><p>一</p><ul><li><p>一.1</p></li></ul></li><li><p>二</p></li></ul>" +
+		`<ol start="3"><li><p>三</p></li><li><p>四</p></li></ol>` +
+		`<ul data-type="taskList"><li data-type="taskItem" data-checked="true"><p>完成</p></li><li data-type="taskItem" data-checked="false"><p>待办</p></li></ul>` +
+		"<blockquote><p>引用</p></blockquote>" +
+		`<pre><code class="language-go">fmt.Println(&#34;&lt;hi&gt;&#34;)</code></pre>` +
+		`<hr/><p><img src="/uploads/1.png" alt="图"/> <u>下划线</u> </p>`
+	if got := FromMarkdown(md); got != want {
+		t.Fatalf("unexpected html:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFromMarkdownInlineEdgeCases(t *testing.T) {
+	cases := map[string]string{
+		`\*不是强调\*`:                 `<p>*不是强调*</p>`,
+		"snake_case_name":          `<p>snake_case_name</p>`,
+		"***粗斜体***":                `<p><em><strong>粗斜体</strong></em></p>`,
+		"*外 **内***":                `<p><em>外 <strong>内</strong></em></p>`,
+		"`` a`b ``":                "<p><code>a`b</code></p>",
+		"见 https://example.com.":   `<p>见 <a href="https://example.com">https://example.com</a>.</p>`,
+		"[x](javascript:alert(1))": `<p>x</p>`,
+		"正文\n2. 不是列表":              "<p>正文\n2. 不是列表</p>",
+		"标题\n===":                  `<h1>标题</h1>`,
+	}
+	for md, want := range cases {
+		if got := FromMarkdown(md); got != want {
+			t.Errorf("FromMarkdown(%q) = %q, want %q", md, got, want)
+		}
+	}
+}
+
+func TestFromTextEscapesAndSplitsParagraphs(t *testing.T) {
+	got := FromText("a <b>\nc\n\n\nd")
+	if got != "<p>a &lt;b&gt;<br>c</p><p>d</p>" {
+		t.Fatalf("unexpected html %q", got)
+	}
+}
+
+func TestDOCXRoundTrip(t *testing.T) {
+	data, err := DOCX("t", sampleDoc, func(string) ([]byte, string, bool) { return testPNG(t), "image/png", true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved []string
+	got, err := FromDOCX(data, func(data []byte, name string) (string, bool) {
+		saved = append(saved, name)
+		return "/uploads/imported.png", true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<h2>周会 <em>纪要</em></h2>",
+		`<strong>加粗</strong>`,
+		`<a href="https://example.com/x">链接</a>`,
+		"<ul><li><p>一</p><ul><li><p>一.1</p></li></ul></li><li><p>二</p></li></ul>",
+		"<ol><li><p>三</p></li><li><p>四</p></li></ol>",
+		"<blockquote><p>引用</p></blockquote>",
+		"<pre><code>fmt.Println(&#34;hi&#34;)</code></pre>",
+		`<img src="/uploads/imported.png" alt="图"/>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("expected %q in imported html:\n%s", want, got)
+		}
+	}
+	if len(saved) != 1 || saved[0] != "image1.png" {
+		t.Fatalf("expected one saved image, got %v", saved)
+	}
+}
+
+func TestFromDOCXRejectsGarbage(t *testing.T) {
+	if _, err := FromDOCX([]byte("not a zip"), nil); err != ErrInvalidDOCX {
+		t.Fatalf("expected ErrInvalidDOCX, got %v", err)
+	}
+}
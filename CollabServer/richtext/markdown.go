@@ -0,0 +1,309 @@
+package richtext
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Markdown 把 Tiptap HTML 转换为 Markdown（CommonMark + 任务列表、删除线）
+func Markdown(content string) string {
+	return render(content, false)
+}
+
+// Text 把 Tiptap HTML 转换为保留段落、列表结构的纯文本，用于导出；
+// PlainText 则只用于索引与摘要
+func Text(content string) string {
+	return render(content, true)
+}
+
+func render(content string, plain bool) string {
+	r := &textRenderer{plain: plain}
+	out := r.blocks(parseFragment(content))
+	if out == "" {
+		return ""
+	}
+	return out + "\n"
+}
+
+type textRenderer struct {
+	plain bool
+}
+
+// blocks 渲染同级节点，块之间以空行分隔
+func (r *textRenderer) blocks(nodes []*html.Node) string {
+	var parts []string
+	for _, b := range blocksOf(nodes) {
+		if s := r.renderBlock(b); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+func (r *textRenderer) renderBlock(b block) string {
+	if b.el == nil {
+		return r.paragraph(b.inline)
+	}
+	return r.block(b.el)
+}
+
+// paragraph 渲染段落；Markdown 中行首的 #、>、- 等会被当作语法，需要转义
+func (r *textRenderer) paragraph(nodes []*html.Node) string {
+	text := strings.TrimSpace(r.inline(nodes))
+	if r.plain || text == "" {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = escapeLineStart(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *textRenderer) block(n *html.Node) string {
+	if level := headingLevel(n); level > 0 {
+		text := strings.TrimSpace(r.inline(children(n)))
+		if r.plain || text == "" {
+			return text
+		}
+		return strings.Repeat("#", level) + " " + text
+	}
+
+	switch n.DataAtom {
+	case atom.P:
+		return r.paragraph(children(n))
+	case atom.Hr:
+		return "---"
+	case atom.Pre:
+		code := strings.TrimSuffix(textContent(n), "\n")
+		if r.plain {
+			return code
+		}
+		fence := "```"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		return fence + codeLanguage(n) + "\n" + code + "\n" + fence
+	case atom.Blockquote:
+		inner := r.blocks(children(n))
+		if r.plain {
+			return prefixLines(inner, "  ", "  ")
+		}
+		return prefixLines(inner, "> ", "> ")
+	case atom.Ul, atom.Ol:
+		return r.list(n)
+	case atom.Tr:
+		var cells []string
+		for _, c := range children(n) {
+			if c.Type == html.ElementNode {
+				cells = append(cells, strings.TrimSpace(r.inline(children(c))))
+			}
+		}
+		return strings.Join(cells, " | ")
+	}
+	// div、table 等容器直接展开
+	return r.blocks(children(n))
+}
+
+// list 渲染列表；每项只有一个段落时列表保持紧凑
+func (r *textRenderer) list(n *html.Node) string {
+	start := 1
+	if s, err := strconv.Atoi(attr(n, "start")); err == nil {
+		start = s
+	}
+	var items []string
+	loose := false
+	i := start
+	for _, li := range children(n) {
+		if li.Type != html.ElementNode || li.DataAtom != atom.Li {
+			continue
+		}
+		marker := "- "
+		if r.plain {
+			marker = "• "
+		}
+		switch {
+		case isTaskItem(li):
+			mark := " "
+			if isChecked(li) {
+				mark = "x"
+			}
+			if r.plain {
+				marker = "[" + mark + "] "
+			} else {
+				marker = "- [" + mark + "] "
+			}
+		case n.DataAtom == atom.Ol:
+			marker = fmt.Sprintf("%d. ", i)
+			i++
+		}
+		var body string
+		if blocks := blocksOf(children(li)); isNestedListItem(blocks) {
+			body = r.renderBlock(blocks[0]) + "\n" + r.renderBlock(blocks[1])
+		} else {
+			body = r.blocks(children(li))
+			loose = loose || len(blocks) > 1
+		}
+		items = append(items, prefixLines(body, marker, strings.Repeat(" ", len([]rune(marker)))))
+	}
+	if loose {
+		return strings.Join(items, "\n\n")
+	}
+	return strings.Join(items, "\n")
+}
+
+// isNestedListItem 判断列表项是否只是“一段文字 + 嵌套列表”，这种情况仍按紧凑列表输出
+func isNestedListItem(blocks []block) bool {
+	if len(blocks) != 2 || blocks[1].el == nil {
+		return false
+	}
+	return blocks[1].el.DataAtom == atom.Ul || blocks[1].el.DataAtom == atom.Ol
+}
+
+// prefixLines 给第一行加 first 前缀，其余行加 rest 前缀（空行只加去掉尾部空格的前缀）
+func prefixLines(s, first, rest string) string {
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		p := rest
+		if i == 0 {
+			p = first
+		}
+		if line == "" {
+			lines[i] = strings.TrimRight(p, " ")
+			continue
+		}
+		lines[i] = p + line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *textRenderer) inline(nodes []*html.Node) string {
+	var b strings.Builder
+	for _, n := range nodes {
+		b.WriteString(r.inlineNode(n))
+	}
+	return b.String()
+}
+
+func (r *textRenderer) inlineNode(n *html.Node) string {
+	if n.Type == html.TextNode {
+		text := collapseSpace(n.Data)
+		if r.plain {
+			return text
+		}
+		return escapeMarkdown(text)
+	}
+	if n.Type != html.ElementNode {
+		return ""
+	}
+
+	inner := func() string { return r.inline(children(n)) }
+	switch n.DataAtom {
+	case atom.Br:
+		if r.plain {
+			return "\n"
+		}
+		return "\\\n"
+	case atom.Strong, atom.B:
+		return r.wrap(inner(), "**")
+	case atom.Em, atom.I:
+		return r.wrap(inner(), "*")
+	case atom.S, atom.Del, atom.Strike:
+		return r.wrap(inner(), "~~")
+	case atom.U:
+		if r.plain {
+			return inner()
+		}
+		return "<u>" + inner() + "</u>"
+	case atom.Code:
+		code := textContent(n)
+		if r.plain {
+			return code
+		}
+		fence := "`"
+		for strings.Contains(code, fence) {
+			fence += "`"
+		}
+		if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+			return fence + " " + code + " " + fence
+		}
+		return fence + code + fence
+	case atom.A:
+		text := inner()
+		href := attr(n, "href")
+		if href == "" || !isSafeHref(href) {
+			return text
+		}
+		if r.plain {
+			if strings.TrimSpace(text) == "" || text == href {
+				return href
+			}
+			return text + " (" + href + ")"
+		}
+		return "[" + text + "](" + markdownURL(href) + ")"
+	case atom.Img:
+		alt := attr(n, "alt")
+		src := attr(n, "src")
+		if r.plain {
+			return alt
+		}
+		if strings.HasPrefix(src, "data:") {
+			// 内嵌图片在 Markdown 中过长，只保留替代文本
+			return alt
+		}
+		return "![" + escapeMarkdown(alt) + "](" + markdownURL(src) + ")"
+	case atom.Input, atom.Script, atom.Style:
+		return ""
+	}
+	return inner()
+}
+
+// wrap 把标记放在首尾空白之内，避免生成 "** text**" 这样无效的强调
+func (r *textRenderer) wrap(s, mark string) string {
+	if r.plain {
+		return s
+	}
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" {
+		return s
+	}
+	lead := s[:strings.Index(s, trimmed)]
+	trail := s[len(lead)+len(trimmed):]
+	return lead + mark + trimmed + mark + trail
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, "~", `\~`,
+)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+var orderedMarker = regexp.MustCompile(`^(\d+)([.)])(\s|$)`)
+
+// escapeLineStart 转义行首会被识别为标题、引用、列表或分隔线的字符
+func escapeLineStart(line string) string {
+	if m := orderedMarker.FindStringSubmatch(line); m != nil {
+		return m[1] + "\\" + line[len(m[1]):]
+	}
+	for _, p := range []string{"#", ">", "- ", "+ ", "=", "---"} {
+		if strings.HasPrefix(line, p) {
+			return "\\" + line
+		}
+	}
+	return line
+}
+
+// markdownURL 链接地址含空格或括号时用尖括号包起来
+func markdownURL(u string) string {
+	if strings.ContainsAny(u, " ()") {
+		return "<" + strings.ReplaceAll(u, ">", "%3E") + ">"
+	}
+	return u
+}
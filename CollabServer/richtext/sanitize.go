@@ -0,0 +1,227 @@
+package richtext
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// =============================================================================
+// HTML 白名单清洗
+// =============================================================================
+// 只保留编辑器（StarterKit + Image + TaskList/TaskItem + CodeBlock）能表示的元素和属性：
+//   - 不在白名单中的元素去掉标签、保留内容；script/style/iframe 等连同内容一起删除
+//   - 属性逐个校验，on* 事件、style、class（代码块语言除外）一律丢弃
+//   - 链接只允许相对地址与 http/https/mailto，图片另外允许 data:image/* 的 base64
+// =============================================================================
+
+// allowedAttrs 是各元素允许的属性；不在表中的元素会被展开
+var allowedAttrs = map[atom.Atom][]string{
+	atom.P: nil, atom.H1: nil, atom.H2: nil, atom.H3: nil, atom.H4: nil, atom.H5: nil, atom.H6: nil,
+	atom.Blockquote: nil, atom.Pre: nil, atom.Hr: nil, atom.Br: nil,
+	atom.Ul: {"data-type"}, atom.Ol: {"start"}, atom.Li: {"data-type", "data-checked"},
+	atom.Strong: nil, atom.B: nil, atom.Em: nil, atom.I: nil, atom.U: nil, atom.S: nil, atom.Strike: nil, atom.Del: nil,
+	atom.Code: {"class"},
+	atom.A:    {"href", "target", "rel"},
+	atom.Img:  {"src", "alt", "title", "width", "height"},
+	// 任务项渲染结构：<label><input type="checkbox"><span></span></label><div>…</div>
+	atom.Label: nil, atom.Input: {"type", "checked"}, atom.Span: nil, atom.Div: nil,
+}
+
+// droppedTags 连同内容一起删除
+var droppedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Noscript: true, atom.Template: true, atom.Svg: true, atom.Math: true, atom.Head: true,
+	atom.Title: true, atom.Textarea: true, atom.Select: true, atom.Frameset: true, atom.Frame: true,
+	atom.Applet: true, atom.Audio: true, atom.Video: true, atom.Canvas: true, atom.Link: true, atom.Meta: true, atom.Base: true,
+}
+
+var (
+	languageClass = regexp.MustCompile(`^language-[A-Za-z0-9_+#.-]{1,40}$`)
+	dataImage     = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,[A-Za-z0-9+/=\s]*$`)
+)
+
+// Sanitize 按白名单清洗 HTML，返回可安全存储并下发给所有客户端的内容
+func Sanitize(content string) string {
+	if content == "" {
+		return ""
+	}
+	var b strings.Builder
+	for _, n := range parseFragment(content) {
+		for _, clean := range sanitizeNode(n, false) {
+			html.Render(&b, clean)
+		}
+	}
+	return b.String()
+}
+
+// sanitizeNode 返回清洗后的节点（展开的元素会返回多个子节点）；inPre 表示位于代码块内
+func sanitizeNode(n *html.Node, inPre bool) []*html.Node {
+	switch n.Type {
+	case html.TextNode:
+		return []*html.Node{{Type: html.TextNode, Data: n.Data}}
+	case html.ElementNode:
+	default:
+		// 注释、DOCTYPE 等直接丢弃
+		return nil
+	}
+
+	if droppedTags[n.DataAtom] || n.DataAtom == 0 && isDroppedCustomTag(n.Data) {
+		return nil
+	}
+
+	var kids []*html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		kids = append(kids, sanitizeNode(c, inPre || n.DataAtom == atom.Pre)...)
+	}
+
+	allowed, ok := allowedAttrs[n.DataAtom]
+	if !ok || n.Namespace != "" {
+		// 表格单元格之间补一个空格，避免展开后文字粘连
+		if n.DataAtom == atom.Td || n.DataAtom == atom.Th {
+			kids = append(kids, &html.Node{Type: html.TextNode, Data: " "})
+		}
+		return kids
+	}
+
+	el := &html.Node{Type: html.ElementNode, Data: n.DataAtom.String(), DataAtom: n.DataAtom}
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) {
+			continue
+		}
+		if val, ok := sanitizeAttr(n.DataAtom, a.Key, a.Val, inPre); ok {
+			el.Attr = append(el.Attr, html.Attribute{Key: a.Key, Val: val})
+		}
+	}
+
+	switch n.DataAtom {
+	case atom.A:
+		if !hasAttr(el, "href") {
+			return kids
+		}
+		// 新窗口打开的链接强制加 rel，防止 window.opener 被利用
+		el.Attr = withoutAttr(el.Attr, "rel")
+		if hasAttr(el, "target") {
+			el.Attr = append(el.Attr, html.Attribute{Key: "rel", Val: "noopener noreferrer nofollow"})
+		}
+	case atom.Img:
+		if !hasAttr(el, "src") {
+			return nil
+		}
+	case atom.Input:
+		if attr(el, "type") != "checkbox" {
+			return nil
+		}
+	}
+
+	for _, k := range kids {
+		el.AppendChild(k)
+	}
+	return []*html.Node{el}
+}
+
+// isDroppedCustomTag 处理 atom 表以外、但同样需要连内容删除的元素
+func isDroppedCustomTag(tag string) bool {
+	switch strings.ToLower(tag) {
+	case "xml", "portal", "fencedframe":
+		return true
+	}
+	return false
+}
+
+func sanitizeAttr(tag atom.Atom, key, val string, inPre bool) (string, bool) {
+	switch key {
+	case "href":
+		if !isSafeHref(val) || !isSafeURL(val, false) {
+			return "", false
+		}
+		return strings.TrimSpace(val), true
+	case "src":
+		if !isSafeURL(val, true) {
+			return "", false
+		}
+		return strings.TrimSpace(val), true
+	case "target":
+		return "_blank", val == "_blank"
+	case "rel":
+		return "", false
+	case "class":
+		// 只保留代码块的语言标记
+		return val, inPre && tag == atom.Code && languageClass.MatchString(val)
+	case "data-type":
+		return val, (tag == atom.Ul && val == "taskList") || (tag == atom.Li && val == "taskItem")
+	case "checked":
+		return "checked", true
+	case "data-checked":
+		return val, val == "true" || val == "false"
+	case "type":
+		return val, val == "checkbox"
+	case "start", "width", "height":
+		n, err := strconv.Atoi(val)
+		return val, err == nil && n >= 0 && n <= 100000
+	case "alt", "title":
+		return val, len(val) <= 1000
+	}
+	return "", false
+}
+
+// isSafeURL 校验链接协议。浏览器会忽略协议中的空白和控制字符（如 "java\tscript:"），
+// 因此先去掉它们再判断
+func isSafeURL(raw string, image bool) bool {
+	cleaned := strings.Map(func(r rune) rune {
+		if r <= 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, raw)
+	if cleaned == "" {
+		return false
+	}
+	lower := strings.ToLower(cleaned)
+	if image && strings.HasPrefix(lower, "data:") {
+		return dataImage.MatchString(strings.TrimSpace(raw))
+	}
+
+	colon := strings.IndexByte(lower, ':')
+	if colon < 0 || strings.ContainsAny(lower[:colon], "/?#") {
+		return true // 相对地址
+	}
+	switch lower[:colon] {
+	case "http", "https":
+		return true
+	case "mailto":
+		return !image
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func withoutAttr(attrs []html.Attribute, key string) []html.Attribute {
+	out := attrs[:0]
+	for _, a := range attrs {
+		if a.Key != key {
+			out = append(out, a)
+		}
+	}
+	return out
+}
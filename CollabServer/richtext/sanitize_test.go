@@ -0,0 +1,64 @@
+package richtext
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeKeepsTiptapSchema(t *testing.T) {
+	doc := `<h2>标题</h2><p><strong>粗</strong><em>斜</em><s>删</s><code>c</code>` +
+		`<a target="_blank" rel="noopener noreferrer nofollow" href="https://example.com/?a=1&amp;b=2">链接</a><br>` +
+		`<img src="/uploads/1.png?exp=1&amp;sig=ab" alt="图"></p>` +
+		`<ul data-type="taskList"><li data-checked="true" data-type="taskItem"><label><input type="checkbox" checked="checked"><span></span></label><div><p>完成</p></div></li></ul>` +
+		`<ol start="3"><li><p>三</p></li></ol><blockquote><p>引用</p></blockquote>` +
+		`<pre><code class="language-go">a &lt; b</code></pre><hr>`
+	want := `<h2>标题</h2><p><strong>粗</strong><em>斜</em><s>删</s><code>c</code>` +
+		`<a target="_blank" href="https://example.com/?a=1&amp;b=2" rel="noopener noreferrer nofollow">链接</a><br/>` +
+		`<img src="/uploads/1.png?exp=1&amp;sig=ab" alt="图"/></p>` +
+		`<ul data-type="taskList"><li data-checked="true" data-type="taskItem"><label><input type="checkbox" checked="checked"/><span></span></label><div><p>完成</p></div></li></ul>` +
+		`<ol start="3"><li><p>三</p></li></ol><blockquote><p>引用</p></blockquote>` +
+		`<pre><code class="language-go">a &lt; b</code></pre><hr/>`
+	if got := Sanitize(doc); got != want {
+		t.Fatalf("unexpected sanitized html:\n%s\nwant:\n%s", got, want)
+	}
+	if Sanitize(want) != want {
+		t.Fatal("expected sanitize to be idempotent")
+	}
+}
+
+func TestSanitizeRemovesXSSVectors(t *testing.T) {
+	cases := map[string]string{
+		`<script>alert(1)</script><p>ok</p>`:                                       `<p>ok</p>`,
+		`<p onclick="alert(1)" style="color:red" class="x">ok</p>`:                 `<p>ok</p>`,
+		`<img src=x onerror=alert(1)>`:                                             `<img src="x"/>`,
+		`<img src="javascript:alert(1)">`:                                          ``,
+		`<a href="javascript:alert(1)">x</a>`:                                      `x`,
+		`<a href="JaVa&#x09;Script:alert(1)">x</a>`:                                `x`,
+		`<a href=" &#14; javascript:alert(1)">x</a>`:                               `x`,
+		`<a href="vbscript:msgbox(1)">x</a>`:                                       `x`,
+		`<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`:                       `x`,
+		`<img src="data:image/svg+xml;base64,PHN2Zz4=">`:                           ``,
+		`<img src="data:image/png;base64,iVBORw0K">`:                               `<img src="data:image/png;base64,iVBORw0K"/>`,
+		`<a href="mailto:a@b.c">m</a>`:                                             `<a href="mailto:a@b.c">m</a>`,
+		`<a href="https://x" target="_top">x</a>`:                                  `<a href="https://x">x</a>`,
+		`<iframe src="https://evil"></iframe>ok`:                                   `ok`,
+		`<svg><script>alert(1)</script></svg>ok`:                                   `ok`,
+		`<math><mtext><img src=x onerror=alert(1)></mtext></math>`:                 ``,
+		`<style>*{}</style><object data=x></object>ok`:                             `ok`,
+		`<form action="https://evil"><button>go</button></form>`:                   `go`,
+		`<input type="text" value="x" onfocus="alert(1)" autofocus>`:               ``,
+		`<code class="language-go" onmouseover="x">c</code>`:                       `<code>c</code>`,
+		`<!-- <img src=x onerror=alert(1)> -->ok`:                                  `ok`,
+		`<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`:                             `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+		`<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`: `<img src="x"/>&#34;&gt;`,
+	}
+	for in, want := range cases {
+		got := Sanitize(in)
+		if got != want {
+			t.Errorf("Sanitize(%q) = %q, want %q", in, got, want)
+		}
+		if strings.Contains(strings.ToLower(got), "onerror") || strings.Contains(strings.ToLower(got), "javascript:") {
+			t.Errorf("Sanitize(%q) kept an executable payload: %q", in, got)
+		}
+	}
+}
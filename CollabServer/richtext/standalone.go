@@ -0,0 +1,75 @@
+package richtext
+
+import (
+	"encoding/base64"
+	"html/template"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// standaloneTemplate 是导出 HTML 的外壳，样式与编辑器大致一致，离线打开也能正常阅读
+var standaloneTemplate = template.Must(template.New("doc").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body { max-width: 800px; margin: 40px auto; padding: 0 20px; font-family: -apple-system, "Segoe UI", "PingFang SC", "Microsoft YaHei", sans-serif; line-height: 1.7; color: #1f2328; }
+img { max-width: 100%; height: auto; }
+pre { background: #f6f8fa; padding: 12px 16px; border-radius: 6px; overflow-x: auto; }
+code { font-family: Consolas, "SFMono-Regular", Menlo, monospace; background: #f6f8fa; padding: 0.1em 0.3em; border-radius: 4px; }
+pre code { background: none; padding: 0; }
+blockquote { margin: 0; padding-left: 1em; border-left: 4px solid #d0d7de; color: #57606a; }
+ul[data-type="taskList"] { list-style: none; padding-left: 0.5em; }
+ul[data-type="taskList"] li { display: flex; gap: 0.5em; }
+ul[data-type="taskList"] li > label { flex: 0 0 auto; }
+hr { border: none; border-top: 1px solid #d0d7de; }
+</style>
+</head>
+<body>
+<article>
+{{.Body}}
+</article>
+</body>
+</html>
+`))
+
+// StandaloneHTML 生成可离线打开的完整 HTML 文档：图片内联为 data: URI，
+// 无法读取的图片保留原地址
+func StandaloneHTML(title, content string, loader ImageLoader) string {
+	nodes := parseFragment(content)
+	for _, n := range nodes {
+		embedImages(n, loader)
+	}
+
+	var body strings.Builder
+	for _, n := range nodes {
+		html.Render(&body, n)
+	}
+
+	var out strings.Builder
+	standaloneTemplate.Execute(&out, struct {
+		Title string
+		Body  template.HTML
+	}{title, template.HTML(body.String())})
+	return out.String()
+}
+
+func embedImages(n *html.Node, loader ImageLoader) {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Img {
+		for i, a := range n.Attr {
+			if a.Key != "src" || strings.HasPrefix(a.Val, "data:") {
+				continue
+			}
+			if data, contentType, ok := loadImage(a.Val, loader); ok {
+				n.Attr[i].Val = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+			}
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		embedImages(c, loader)
+	}
+}
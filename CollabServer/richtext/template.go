@@ -0,0 +1,22 @@
+package richtext
+
+import (
+	"html"
+	"regexp"
+)
+
+// templateVar 匹配 {{date}}、{{ room }} 这类模板变量
+var templateVar = regexp.MustCompile(`\{\{\s*([A-Za-z_]+)\s*\}\}`)
+
+// FillTemplate 把文档 HTML 中的模板变量替换为 vars 中的值（值会做 HTML 转义），
+// 未知变量原样保留
+func FillTemplate(content string, vars map[string]string) string {
+	return templateVar.ReplaceAllStringFunc(content, func(m string) string {
+		name := templateVar.FindStringSubmatch(m)[1]
+		val, ok := vars[name]
+		if !ok {
+			return m
+		}
+		return html.EscapeString(val)
+	})
+}
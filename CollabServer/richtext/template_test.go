@@ -0,0 +1,15 @@
+package richtext
+
+import "testing"
+
+func TestFillTemplateReplacesKnownVariables(t *testing.T) {
+	got := FillTemplate(`<h1>{{room}} 复盘</h1><p>日期：{{ date }}</p><p>参会：{{attendees}}</p><p>{{unknown}}</p>`, map[string]string{
+		"room":      "<周会>",
+		"date":      "2026-10-19",
+		"attendees": "alice、bob",
+	})
+	want := `<h1>&lt;周会&gt; 复盘</h1><p>日期：2026-10-19</p><p>参会：alice、bob</p><p>{{unknown}}</p>`
+	if got != want {
+		t.Fatalf("unexpected template output:\n%s\nwant:\n%s", got, want)
+	}
+}
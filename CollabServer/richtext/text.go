@@ -0,0 +1,19 @@
+// Package richtext 处理编辑器产生的 Tiptap HTML：提取纯文本等
+package richtext
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// tagPattern 用于把 Tiptap HTML 粗略转换为纯文本
+var tagPattern = regexp.MustCompile(`<[^>]*>`)
+
+// PlainText 去掉标签并还原实体，标签替换为空格以保留段落边界
+func PlainText(content string) string {
+	if !strings.Contains(content, "<") && !strings.Contains(content, "&") {
+		return content
+	}
+	return html.UnescapeString(tagPattern.ReplaceAllString(content, " "))
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage 把对象保存为 Root 目录下的普通文件
+type LocalStorage struct {
+	Root string
+}
+
+// NewLocalStorage 创建本地存储，目录不存在时自动创建
+func NewLocalStorage(root string) (*LocalStorage, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &LocalStorage{Root: root}, nil
+}
+
+func (s *LocalStorage) path(key string) (string, string, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return cleaned, filepath.Join(s.Root, filepath.FromSlash(cleaned)), nil
+}
+
+// Put 先写临时文件再重命名，避免读到写了一半的文件
+func (s *LocalStorage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	_, p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".put-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp 默认 0600，与原先 r.Static 时期保持一致
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func (s *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	obj, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, obj, err
+	}
+	_, p, _ := s.path(key)
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, obj, mapLocalError(err)
+	}
+	return f, obj, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	_, p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	return mapLocalError(os.Remove(p))
+}
+
+func (s *LocalStorage) Stat(ctx context.Context, key string) (Object, error) {
+	cleaned, p, err := s.path(key)
+	if err != nil {
+		return Object{}, err
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return Object{}, mapLocalError(err)
+	}
+	if info.IsDir() {
+		return Object{}, ErrNotFound
+	}
+	return localObject(cleaned, info), nil
+}
+
+func (s *LocalStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	err := filepath.WalkDir(s.Root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".put-") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		objects = append(objects, localObject(key, info))
+		return nil
+	})
+	return objects, err
+}
+
+// localObject 本地文件没有保存 Content-Type，按扩展名推断
+func localObject(key string, info fs.FileInfo) Object {
+	return Object{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ModTime:     info.ModTime(),
+	}
+}
+
+func mapLocalError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
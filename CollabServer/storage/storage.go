@@ -0,0 +1,97 @@
+// Package storage 抽象上传文件的存储后端（本地磁盘或 S3 兼容对象存储）
+package storage
+
+import (
+	"collab-server/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 存储后端接口
+// =============================================================================
+// 上传与下载统一通过 Default 访问，后端由 .env 的 STORAGE_BACKEND 决定：
+//   - local（默认）：写入 UPLOAD_DIR
+//   - s3：任意 S3 兼容服务（AWS S3、MinIO、腾讯云 COS 等），见 NewS3Storage
+//
+// Key 一律使用正斜杠分隔的相对路径，例如 "1700000000.png"、"files/ab/abcd..."。
+// =============================================================================
+
+// ErrNotFound 表示对象不存在
+var ErrNotFound = errors.New("对象不存在")
+
+// Object 是存储对象的元信息
+type Object struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Storage 是上传文件存储后端需要实现的最小接口
+type Storage interface {
+	// Put 写入对象，size 未知时传 -1
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get 读取对象，调用方负责关闭返回的 ReadCloser
+	Get(ctx context.Context, key string) (io.ReadCloser, Object, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (Object, error)
+	// List 返回 Key 以 prefix 开头的所有对象
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Default 是全局存储后端，由 Init 根据配置创建
+var Default Storage
+
+// Init 根据 STORAGE_BACKEND 初始化全局存储后端
+func Init() error {
+	backend := strings.ToLower(strings.TrimSpace(config.GetEnv("STORAGE_BACKEND", "local")))
+	switch backend {
+	case "", "local":
+		dir := config.GetEnv("UPLOAD_DIR", "uploads")
+		s, err := NewLocalStorage(dir)
+		if err != nil {
+			return err
+		}
+		Default = s
+		log.Printf("📂 存储后端: 本地目录 %s", dir)
+	case "s3":
+		s, err := NewS3Storage(S3Config{
+			Endpoint:  config.GetEnv("S3_ENDPOINT", ""),
+			Region:    config.GetEnv("S3_REGION", "us-east-1"),
+			Bucket:    config.GetEnv("S3_BUCKET", ""),
+			AccessKey: config.GetEnv("S3_ACCESS_KEY", ""),
+			SecretKey: config.GetEnv("S3_SECRET_KEY", ""),
+			PathStyle: config.GetEnv("S3_PATH_STYLE", "true") != "false",
+		})
+		if err != nil {
+			return err
+		}
+		Default = s
+		log.Printf("☁️ 存储后端: S3 兼容存储 %s/%s", s.cfg.Endpoint, s.cfg.Bucket)
+	default:
+		return fmt.Errorf("未知的 STORAGE_BACKEND: %s", backend)
+	}
+	return nil
+}
+
+// CleanKey 规范化对象 Key，拒绝空 Key 和含 ".." 路径段的越界 Key（文件名中的 ".." 不受影响）
+func CleanKey(key string) (string, error) {
+	key = strings.ReplaceAll(key, "\\", "/")
+	for _, seg := range strings.Split(key, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("非法的对象 Key: %q", key)
+		}
+	}
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" {
+		return "", fmt.Errorf("非法的对象 Key: %q", key)
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
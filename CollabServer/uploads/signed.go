@@ -0,0 +1,267 @@
+// Package uploads 负责 /uploads 链接的 HMAC 签名、校验与吊销
+package uploads
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 签名链接
+// =============================================================================
+// 文档和聊天里保存的是不带签名的规范路径 /uploads/<key>，服务器在把内容发给
+// 房间成员时（入房同步、聊天广播、聊天记录）才把它们改写为
+//   /uploads/<key>?sig=<过期时间戳>.<HMAC>
+// 签名覆盖 key、过期时间和 Upload.SignVersion，版本号递增即吊销已签发的链接。
+// 过期时间向上取整到 5 分钟，同一时段内重复签名得到相同的链接，避免文档内容抖动。
+// =============================================================================
+
+// linkPattern 匹配相对或绝对地址中的 /uploads/<key>，以及可能已有的签名参数
+var linkPattern = regexp.MustCompile(`/uploads/([A-Za-z0-9_\-./]*[A-Za-z0-9])(\?sig=[0-9]+\.[0-9a-f]+)?`)
+
+const expiryStep = 5 * time.Minute
+
+// TTL 返回签名链接的有效期（UPLOAD_URL_TTL_MINUTES，默认 120 分钟）
+func TTL() time.Duration {
+	minutes := config.GetEnvInt("UPLOAD_URL_TTL_MINUTES", 120)
+	if minutes <= 0 {
+		minutes = 120
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Expiry 返回从 now 起算、取整后的过期时间
+func Expiry(now time.Time) time.Time {
+	return now.Add(TTL() + expiryStep - 1).Truncate(expiryStep)
+}
+
+func secret() []byte {
+	if s := config.GetEnv("UPLOAD_SIGNING_SECRET", ""); s != "" {
+		return []byte(s)
+	}
+	return []byte(config.GetEnv("JWT_SECRET", ""))
+}
+
+func signature(key string, version uint, exp int64) string {
+	mac := hmac.New(sha256.New, secret())
+	fmt.Fprintf(mac, "uploads\n%s\n%d\n%d", key, version, exp)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// SignedPath 返回带签名的相对地址
+func SignedPath(key string, version uint, exp time.Time) string {
+	return fmt.Sprintf("/uploads/%s?sig=%d.%s", key, exp.Unix(), signature(key, version, exp.Unix()))
+}
+
+// Verify 校验 sig 参数（"<过期时间戳>.<HMAC>"）是否对 key 的当前版本有效且未过期
+func Verify(key string, version uint, sig string, now time.Time) bool {
+	expRaw, mac, ok := strings.Cut(sig, ".")
+	if !ok {
+		return false
+	}
+	exp, err := strconv.ParseInt(expRaw, 10, 64)
+	if err != nil || now.Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(mac), []byte(signature(key, version, exp)))
+}
+
+// KeyFromURL 从相对或绝对地址中提取 /uploads 后面的对象 Key
+func KeyFromURL(raw string) (string, bool) {
+	m := linkPattern.FindStringSubmatch(raw)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// Keys 返回内容中引用的全部 /uploads 对象 Key（去重，保持首次出现的顺序）
+func Keys(content string) []string {
+	if !strings.Contains(content, "/uploads/") {
+		return nil
+	}
+	var keys []string
+	seen := map[string]bool{}
+	for _, m := range linkPattern.FindAllStringSubmatch(content, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			keys = append(keys, m[1])
+		}
+	}
+	return keys
+}
+
+// Lookup 读取上传记录
+func Lookup(key string) (models.Upload, bool) {
+	var upload models.Upload
+	err := database.DB.Where("storage_key = ?", key).First(&upload).Error
+	return upload, err == nil
+}
+
+// IsAvatar 判断图片（或其原图）是否为某个用户的头像，头像对所有登录用户可见
+func IsAvatar(upload models.Upload) bool {
+	return len(avatarKeys([]models.Upload{upload})) > 0
+}
+
+// avatarKeys 返回这些上传中被用作头像的 Key（按原图判断）
+func avatarKeys(rows []models.Upload) map[string]bool {
+	result := map[string]bool{}
+	if len(rows) == 0 {
+		return result
+	}
+	paths := make([]string, 0, len(rows))
+	for _, row := range rows {
+		paths = append(paths, "/uploads/"+originalKey(row))
+	}
+	var avatars []string
+	database.DB.Model(&models.User{}).Where("avatar IN ?", paths).Pluck("avatar", &avatars)
+	used := make(map[string]bool, len(avatars))
+	for _, avatar := range avatars {
+		used[avatar] = true
+	}
+	for _, row := range rows {
+		if used["/uploads/"+originalKey(row)] {
+			result[row.StorageKey] = true
+		}
+	}
+	return result
+}
+
+func originalKey(upload models.Upload) string {
+	if upload.OriginalKey != "" {
+		return upload.OriginalKey
+	}
+	return upload.StorageKey
+}
+
+// signableVersions 返回可在房间 roomID 中、以 author 为作者签名的 Key 及其签名版本：
+// 归属该房间的文件、作者本人上传且未指定房间的文件、以及头像。
+// 其他房间的文件和没有上传记录的 Key 不签名，读者只能凭自身权限访问
+func signableVersions(keys []string, roomID, author string) map[string]uint {
+	versions := make(map[string]uint, len(keys))
+	if len(keys) == 0 {
+		return versions
+	}
+	var rows []models.Upload
+	database.DB.Select("storage_key", "room_id", "uploader", "original_key", "sign_version").
+		Where("storage_key IN ?", keys).Find(&rows)
+
+	var personal []models.Upload
+	for _, row := range rows {
+		switch {
+		case row.RoomID != "" && row.RoomID == roomID:
+			versions[row.StorageKey] = row.SignVersion
+		case row.RoomID == "" && author != "" && row.Uploader == author:
+			versions[row.StorageKey] = row.SignVersion
+		case row.RoomID == "":
+			personal = append(personal, row)
+		}
+	}
+	avatars := avatarKeys(personal)
+	for _, row := range personal {
+		if avatars[row.StorageKey] {
+			versions[row.StorageKey] = row.SignVersion
+		}
+	}
+	return versions
+}
+
+// SignableVersion 判断单个 Key 能否按 SignLinks 的规则签名，返回其签名版本
+func SignableVersion(key, roomID, author string) (uint, bool) {
+	version, ok := signableVersions([]string{key}, roomID, author)[key]
+	return version, ok
+}
+
+// SignLinks 把内容中的 /uploads 链接改写为新签发的签名链接。
+// roomID 是内容展示所在的房间，author 是内容作者（头像传本人）；
+// 无权在此签名的链接去掉签名参数原样保留
+func SignLinks(content, roomID, author string) string {
+	return signLinks(content, func(keys []string) map[string]uint {
+		return signableVersions(keys, roomID, author)
+	}, time.Now())
+}
+
+// signLinks 为 lookup 返回的 Key 签名，其余链接只去掉签名参数
+func signLinks(content string, lookup func([]string) map[string]uint, now time.Time) string {
+	if !strings.Contains(content, "/uploads/") {
+		return content
+	}
+	matches := linkPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return content
+	}
+	keys := make([]string, 0, len(matches))
+	for _, m := range matches {
+		keys = append(keys, m[1])
+	}
+	versions := lookup(keys)
+	exp := Expiry(now)
+	return linkPattern.ReplaceAllStringFunc(content, func(link string) string {
+		key := linkPattern.FindStringSubmatch(link)[1]
+		version, ok := versions[key]
+		if !ok {
+			return "/uploads/" + key
+		}
+		return SignedPath(key, version, exp)
+	})
+}
+
+// imgOrLinkPattern 匹配整个 <img> 标签或标签外的 /uploads 链接
+var imgOrLinkPattern = regexp.MustCompile(`(?i:<img\b[^>]*>)|` + linkPattern.String())
+
+// RewriteLinks 逐个处理内容中的 /uploads 链接（同一 Key 只调用一次 rewrite）：
+// 返回 ok 时改写为新 Key 的规范地址，否则删除该链接，所在的 <img> 标签整个删除
+func RewriteLinks(content string, rewrite func(key string) (string, bool)) string {
+	if !strings.Contains(content, "/uploads/") {
+		return content
+	}
+	type result struct {
+		key string
+		ok  bool
+	}
+	cache := map[string]result{}
+	resolve := func(key string) result {
+		if r, seen := cache[key]; seen {
+			return r
+		}
+		newKey, ok := rewrite(key)
+		cache[key] = result{newKey, ok}
+		return cache[key]
+	}
+	replace := func(link string) string {
+		r := resolve(linkPattern.FindStringSubmatch(link)[1])
+		if !r.ok {
+			return ""
+		}
+		return "/uploads/" + r.key
+	}
+
+	return imgOrLinkPattern.ReplaceAllStringFunc(content, func(match string) string {
+		if !strings.HasPrefix(match, "<") {
+			return replace(match)
+		}
+		for _, m := range linkPattern.FindAllStringSubmatch(match, -1) {
+			if !resolve(m[1]).ok {
+				return ""
+			}
+		}
+		return linkPattern.ReplaceAllStringFunc(match, replace)
+	})
+}
+
+// StripSignatures 去掉内容中 /uploads 链接的签名参数，持久化前调用
+func StripSignatures(content string) string {
+	if !strings.Contains(content, "?sig=") {
+		return content
+	}
+	return linkPattern.ReplaceAllString(content, "/uploads/$1")
+}
@@ -0,0 +1,89 @@
+package uploads
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyRejectsExpiredAndRevokedSignatures(t *testing.T) {
+	t.Setenv("UPLOAD_SIGNING_SECRET", "test-secret")
+	now := time.Unix(1_700_000_000, 0)
+	exp := Expiry(now)
+
+	link := SignedPath("123.png", 0, exp)
+	_, sig, _ := strings.Cut(link, "?sig=")
+
+	if !Verify("123.png", 0, sig, now) {
+		t.Fatal("expected fresh signature to verify")
+	}
+	if Verify("456.png", 0, sig, now) {
+		t.Fatal("expected signature to be bound to the key")
+	}
+	if Verify("123.png", 1, sig, now) {
+		t.Fatal("expected bumped version to revoke the signature")
+	}
+	if Verify("123.png", 0, sig, exp.Add(time.Second)) {
+		t.Fatal("expected expired signature to be rejected")
+	}
+	if Verify("123.png", 0, "garbage", now) {
+		t.Fatal("expected malformed signature to be rejected")
+	}
+}
+
+func TestSignLinksRewritesAndStripRestores(t *testing.T) {
+	t.Setenv("UPLOAD_SIGNING_SECRET", "test-secret")
+	now := time.Unix(1_700_000_000, 0)
+	content := `<p>见图 <img src="http://10.0.0.2/uploads/1.png"> 和 /uploads/2.jpg?sig=1.deadbeef，/uploads/3.gif?sig=1.cafe。</p>`
+
+	lookup := func(keys []string) map[string]uint { return map[string]uint{"1.png": 0, "2.jpg": 3} }
+	signed := signLinks(content, lookup, now)
+
+	exp := Expiry(now)
+	for _, want := range []string{SignedPath("1.png", 0, exp), SignedPath("2.jpg", 3, exp), "/uploads/3.gif。"} {
+		if !strings.Contains(signed, want) {
+			t.Fatalf("expected %q in %q", want, signed)
+		}
+	}
+	if strings.Contains(signed, "deadbeef") || strings.Contains(signed, "cafe") {
+		t.Fatalf("expected stale signatures to be replaced or dropped: %q", signed)
+	}
+
+	want := `<p>见图 <img src="http://10.0.0.2/uploads/1.png"> 和 /uploads/2.jpg，/uploads/3.gif。</p>`
+	if got := StripSignatures(signed); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestKeysFindsRelativeAbsoluteAndSignedLinks(t *testing.T) {
+	content := `<img src="/uploads/1.png"><img src="https://example.com/uploads/2_w320.webp?sig=1.abc">` +
+		`<a href="/uploads/1.png">again</a> /uploads/ /download/3.png`
+	keys := Keys(content)
+	if len(keys) != 2 || keys[0] != "1.png" || keys[1] != "2_w320.webp" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+	if Keys("no links here") != nil {
+		t.Fatal("expected nil for content without links")
+	}
+}
+
+func TestRewriteLinksReplacesOrDropsImages(t *testing.T) {
+	content := `<p><img src="/uploads/a.png?sig=1.abc" alt="a"><img alt="b" src="https://host/uploads/b.png"></p>` +
+		`<p><a href="/uploads/b.png">b</a> <a href="/uploads/a.png">a</a></p>`
+	calls := map[string]int{}
+	got := RewriteLinks(content, func(key string) (string, bool) {
+		calls[key]++
+		if key == "a.png" {
+			return "copy_a.png", true
+		}
+		return "", false
+	})
+
+	want := `<p><img src="/uploads/copy_a.png" alt="a"></p><p><a href="">b</a> <a href="/uploads/copy_a.png">a</a></p>`
+	if got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	if calls["a.png"] != 1 || calls["b.png"] != 1 {
+		t.Fatalf("expected each key to be resolved once, got %v", calls)
+	}
+}
@@ -0,0 +1,287 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/uploads"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// =============================================================================
+// 聊天协议：回复线程、编辑、删除与表情回应
+// =============================================================================
+// 客户端消息：
+//   - chat        { message, replyTo? }
+//   - chat_edit   { messageId, message }   仅作者
+//   - chat_delete { messageId }            作者或房主，软删除并写审计
+//   - chat_react  { messageId, emoji }     同一表情再次发送即取消
+//
+// 这些操作都需要先落库拿到消息 ID / 校验作者，为了不阻塞 Hub 事件循环，
+// 它们被投递到单独的 chatWorker 串行执行（保证同一房间的消息顺序），
+// 执行完成后再以服务端身份（Sender 为 nil）回灌到 broadcast 通道广播。
+// =============================================================================
+
+const maxEmojiRunes = 8
+
+// chatOp 是投递给 chatWorker 的一次聊天操作
+type chatOp struct {
+	Client *Client
+	RoomID string
+	Actor  string
+	IsHost bool
+	Msg    WSMessage
+}
+
+// clientMessage 是定向发给某个连接的消息，由 Hub 确认连接仍然有效后再发送
+type clientMessage struct {
+	Client  *Client
+	Message []byte
+}
+
+func isChatOp(msgType string) bool {
+	switch msgType {
+	case "chat", "chat_edit", "chat_delete", "chat_react":
+		return true
+	}
+	return false
+}
+
+// enqueueChatOp 在 Hub goroutine 中调用，通道满时直接告知客户端而不是阻塞
+func (h *Hub) enqueueChatOp(op chatOp) {
+	select {
+	case h.chatOps <- op:
+	default:
+		h.sendErrorToClient(op.Client, "服务器繁忙，请稍后重试")
+	}
+}
+
+func (h *Hub) runChatWorker() {
+	for op := range h.chatOps {
+		h.applyChatOp(op)
+	}
+}
+
+func (h *Hub) applyChatOp(op chatOp) {
+	var (
+		out *WSMessage
+		err string
+	)
+	switch op.Msg.Type {
+	case "chat":
+		out, err = h.createChatMessage(op)
+	case "chat_edit":
+		out, err = h.editChatMessage(op)
+	case "chat_delete":
+		out, err = h.deleteChatMessage(op)
+	case "chat_react":
+		out, err = h.toggleReaction(op)
+	}
+
+	if err != "" {
+		h.replyError(op.Client, err)
+		return
+	}
+	if out == nil {
+		return
+	}
+
+	// 库里保存规范地址，发给房间成员时再签名 /uploads 链接
+	out.RoomID = op.RoomID
+	// 只签名本房间的文件和发送者本人的文件，贴入其他房间的链接不会因此变得可读
+	out.Message = uploads.SignLinks(out.Message, op.RoomID, op.Actor)
+	if out.ChatMessage != nil {
+		out.ChatMessage.Content = uploads.SignLinks(out.ChatMessage.Content, op.RoomID, out.ChatMessage.Sender)
+	}
+	b, marshalErr := json.Marshal(out)
+	if marshalErr != nil {
+		log.Printf("⚠️ 序列化聊天消息失败: %v", marshalErr)
+		return
+	}
+	h.broadcast <- BroadcastMessage{RoomID: op.RoomID, Message: b}
+}
+
+func (h *Hub) createChatMessage(op chatOp) (*WSMessage, string) {
+	if strings.TrimSpace(op.Msg.Message) == "" {
+		return nil, ""
+	}
+
+	msg := models.Message{RoomID: op.RoomID, Sender: op.Actor, Content: uploads.StripSignatures(op.Msg.Message)}
+	if op.Msg.ReplyTo != 0 {
+		var parent models.Message
+		if err := database.DB.Where("id = ? AND room_id = ?", op.Msg.ReplyTo, op.RoomID).First(&parent).Error; err != nil {
+			return nil, "回复的消息不存在"
+		}
+		msg.ReplyToID = parent.ID
+	}
+
+	if err := database.DB.Create(&msg).Error; err != nil {
+		log.Printf("⚠️ 保存聊天消息失败: %v", err)
+		return nil, "消息保存失败"
+	}
+
+	if mentions := extractMentions(msg.Content); len(mentions) > 0 {
+		go h.notifyMentions(op.RoomID, op.Actor, "chat", msg.Content, mentions)
+	}
+
+	return &WSMessage{
+		Type:        "chat",
+		Message:     msg.Content,
+		Sender:      msg.Sender,
+		MessageID:   msg.ID,
+		ReplyTo:     msg.ReplyToID,
+		ChatMessage: &msg,
+	}, ""
+}
+
+// loadRoomMessage 读取同一房间内的消息，避免跨房间操作
+func loadRoomMessage(roomID string, id uint) (models.Message, bool) {
+	var msg models.Message
+	if id == 0 {
+		return msg, false
+	}
+	if err := database.DB.Where("id = ? AND room_id = ?", id, roomID).First(&msg).Error; err != nil {
+		return msg, false
+	}
+	return msg, true
+}
+
+func (h *Hub) editChatMessage(op chatOp) (*WSMessage, string) {
+	msg, ok := loadRoomMessage(op.RoomID, op.Msg.MessageID)
+	if !ok || msg.Deleted {
+		return nil, "消息不存在或已删除"
+	}
+	if msg.Sender != op.Actor {
+		return nil, "只能编辑自己发送的消息"
+	}
+	newContent := uploads.StripSignatures(op.Msg.Message)
+	if strings.TrimSpace(newContent) == "" {
+		return nil, "消息内容不能为空"
+	}
+	if newContent == msg.Content {
+		return nil, ""
+	}
+
+	oldContent := msg.Content
+	now := time.Now()
+	msg.Content = newContent
+	msg.EditedAt = &now
+	if err := database.DB.Model(&msg).Updates(map[string]interface{}{"content": newContent, "edited_at": now}).Error; err != nil {
+		log.Printf("⚠️ 编辑聊天消息失败: %v", err)
+		return nil, "消息编辑失败"
+	}
+	database.DB.Create(&models.MessageAudit{
+		MessageID:  msg.ID,
+		RoomID:     op.RoomID,
+		Action:     "edit",
+		Actor:      op.Actor,
+		OldContent: oldContent,
+		NewContent: newContent,
+	})
+
+	if mentions := newMentions(oldContent, newContent); len(mentions) > 0 {
+		go h.notifyMentions(op.RoomID, op.Actor, "chat", newContent, mentions)
+	}
+
+	msg.Reactions = loadReactionSummaries([]uint{msg.ID})[msg.ID]
+	return &WSMessage{Type: "chat_edit", Sender: op.Actor, MessageID: msg.ID, Message: newContent, ChatMessage: &msg}, ""
+}
+
+func (h *Hub) deleteChatMessage(op chatOp) (*WSMessage, string) {
+	msg, ok := loadRoomMessage(op.RoomID, op.Msg.MessageID)
+	if !ok || msg.Deleted {
+		return nil, "消息不存在或已删除"
+	}
+	if msg.Sender != op.Actor && !op.IsHost {
+		return nil, "只有作者或房主可以删除消息"
+	}
+
+	oldContent := msg.Content
+	msg.Content = ""
+	msg.Deleted = true
+	msg.DeletedBy = op.Actor
+	if err := database.DB.Model(&msg).Updates(map[string]interface{}{"content": "", "deleted": true, "deleted_by": op.Actor}).Error; err != nil {
+		log.Printf("⚠️ 删除聊天消息失败: %v", err)
+		return nil, "消息删除失败"
+	}
+	database.DB.Create(&models.MessageAudit{
+		MessageID:  msg.ID,
+		RoomID:     op.RoomID,
+		Action:     "delete",
+		Actor:      op.Actor,
+		OldContent: oldContent,
+	})
+	// 墓碑消息不再保留表情回应
+	database.DB.Where("message_id = ?", msg.ID).Delete(&models.MessageReaction{})
+
+	return &WSMessage{Type: "chat_delete", Sender: op.Actor, MessageID: msg.ID, ChatMessage: &msg}, ""
+}
+
+func (h *Hub) toggleReaction(op chatOp) (*WSMessage, string) {
+	emoji := strings.TrimSpace(op.Msg.Emoji)
+	if emoji == "" || utf8.RuneCountInString(emoji) > maxEmojiRunes || strings.ContainsAny(emoji, " <>") {
+		return nil, "表情不合法"
+	}
+	msg, ok := loadRoomMessage(op.RoomID, op.Msg.MessageID)
+	if !ok || msg.Deleted {
+		return nil, "消息不存在或已删除"
+	}
+
+	var existing models.MessageReaction
+	err := database.DB.Where("message_id = ? AND username = ? AND emoji = ?", msg.ID, op.Actor, emoji).First(&existing).Error
+	if err == nil {
+		database.DB.Delete(&existing)
+	} else if err := database.DB.Create(&models.MessageReaction{MessageID: msg.ID, Username: op.Actor, Emoji: emoji}).Error; err != nil {
+		log.Printf("⚠️ 保存表情回应失败: %v", err)
+		return nil, "表情回应失败"
+	}
+
+	msg.Reactions = loadReactionSummaries([]uint{msg.ID})[msg.ID]
+	return &WSMessage{Type: "chat_reaction", Sender: op.Actor, MessageID: msg.ID, Emoji: emoji, ChatMessage: &msg}, ""
+}
+
+// summarizeReactions 按消息和表情聚合，表情顺序以首次出现为准
+func summarizeReactions(reactions []models.MessageReaction) map[uint][]models.ReactionSummary {
+	result := map[uint][]models.ReactionSummary{}
+	for _, r := range reactions {
+		summaries := result[r.MessageID]
+		found := false
+		for i := range summaries {
+			if summaries[i].Emoji == r.Emoji {
+				summaries[i].Count++
+				summaries[i].Users = append(summaries[i].Users, r.Username)
+				found = true
+				break
+			}
+		}
+		if !found {
+			summaries = append(summaries, models.ReactionSummary{Emoji: r.Emoji, Count: 1, Users: []string{r.Username}})
+		}
+		result[r.MessageID] = summaries
+	}
+	return result
+}
+
+func loadReactionSummaries(messageIDs []uint) map[uint][]models.ReactionSummary {
+	if len(messageIDs) == 0 {
+		return map[uint][]models.ReactionSummary{}
+	}
+	var reactions []models.MessageReaction
+	database.DB.Where("message_id IN ?", messageIDs).Order("id asc").Find(&reactions)
+	return summarizeReactions(reactions)
+}
+
+// attachReactions 为一批消息填充表情回应聚合
+func attachReactions(messages []models.Message) {
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	summaries := loadReactionSummaries(ids)
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+}
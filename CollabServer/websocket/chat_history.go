@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"collab-server/config"
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/uploads"
+	"encoding/json"
+	"time"
+)
+
+// =============================================================================
+// 聊天记录分页
+// =============================================================================
+// 以消息 ID 作为游标向前翻页：客户端拿当前最早一条消息的 ID 作为 before，
+// 服务端返回比它更早的一页。ID 单调递增，比 OFFSET 分页在新消息不断写入时更稳定。
+// 入房时的 chat_history、WebSocket 的 chat_history_before 和 REST 接口共用这里的查询。
+// =============================================================================
+
+const maxChatHistoryPageSize = 200
+
+// ChatHistoryQuery 描述一次向前翻页的聊天记录查询
+type ChatHistoryQuery struct {
+	RoomID string
+	Before uint // 只返回 ID 小于它的消息，0 表示从最新一条开始
+	Limit  int  // <= 0 时使用 CHAT_HISTORY_PAGE_SIZE
+	From   time.Time
+	To     time.Time
+}
+
+// ChatHistoryPage 是一页按时间正序排列的消息
+type ChatHistoryPage struct {
+	Messages   []models.Message `json:"messages"`
+	HasMore    bool             `json:"has_more"`
+	NextBefore uint             `json:"next_before,omitempty"` // 加载更早一页时使用的游标
+}
+
+// ChatHistoryPageSize 把请求的条数规范到 [1, 200]，未指定时读取 CHAT_HISTORY_PAGE_SIZE
+func ChatHistoryPageSize(requested int) int {
+	if requested <= 0 {
+		requested = config.GetEnvInt("CHAT_HISTORY_PAGE_SIZE", 50)
+	}
+	if requested <= 0 {
+		requested = 50
+	}
+	if requested > maxChatHistoryPageSize {
+		requested = maxChatHistoryPageSize
+	}
+	return requested
+}
+
+// QueryChatHistory 按游标和时间范围查询一页聊天记录
+func QueryChatHistory(q ChatHistoryQuery) (ChatHistoryPage, error) {
+	limit := ChatHistoryPageSize(q.Limit)
+
+	query := database.DB.Where("room_id = ?", q.RoomID)
+	if q.Before > 0 {
+		query = query.Where("id < ?", q.Before)
+	}
+	if !q.From.IsZero() {
+		query = query.Where("created_at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		query = query.Where("created_at < ?", q.To)
+	}
+
+	// 多取一条用于判断是否还有更早的消息
+	var messages []models.Message
+	if err := query.Order("id desc").Limit(limit + 1).Find(&messages).Error; err != nil {
+		return ChatHistoryPage{}, err
+	}
+
+	page := ChatHistoryPage{}
+	if len(messages) > limit {
+		page.HasMore = true
+		messages = messages[:limit]
+	}
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	attachReactions(messages)
+	for i := range messages {
+		messages[i].Content = uploads.SignLinks(messages[i].Content, messages[i].RoomID, messages[i].Sender)
+	}
+
+	page.Messages = messages
+	if page.HasMore && len(messages) > 0 {
+		page.NextBefore = messages[0].ID
+	}
+	return page, nil
+}
+
+// sendChatHistoryPage 响应 chat_history_before 请求（在独立 goroutine 中调用）
+func (h *Hub) sendChatHistoryPage(client *Client, roomID string, before uint, limit int) {
+	page, err := QueryChatHistory(ChatHistoryQuery{RoomID: roomID, Before: before, Limit: limit})
+	if err != nil {
+		h.replyError(client, "加载聊天记录失败")
+		return
+	}
+
+	b, _ := json.Marshal(WSMessage{
+		Type:      "chat_history_page",
+		RoomID:    roomID,
+		History:   page.Messages,
+		HasMore:   page.HasMore,
+		MessageID: page.NextBefore,
+	})
+	h.clientMessages <- clientMessage{Client: client, Message: b}
+}
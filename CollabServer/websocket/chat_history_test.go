@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// seedMessages 在 roomID 中按顺序写入 n 条消息，返回它们的 ID
+func seedMessages(t *testing.T, roomID string, n int) []uint {
+	t.Helper()
+	ids := make([]uint, 0, n)
+	for i := 0; i < n; i++ {
+		msg := models.Message{RoomID: roomID, Sender: "alice", Content: fmt.Sprintf("msg-%d", i)}
+		if err := database.DB.Create(&msg).Error; err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, msg.ID)
+	}
+	return ids
+}
+
+func messageIDs(messages []models.Message) []uint {
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestQueryChatHistoryHasMoreEdge(t *testing.T) {
+	useTestDB(t)
+	ids := seedMessages(t, "room-1", 5)
+	seedMessages(t, "room-2", 3)
+
+	cases := []struct {
+		name       string
+		limit      int
+		wantCount  int
+		hasMore    bool
+		nextBefore uint
+	}{
+		{"fewer than limit", 10, 5, false, 0},
+		{"exactly limit", 5, 5, false, 0},
+		{"one more than limit", 4, 4, true, ids[1]},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := QueryChatHistory(ChatHistoryQuery{RoomID: "room-1", Limit: tc.limit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Messages) != tc.wantCount || page.HasMore != tc.hasMore || page.NextBefore != tc.nextBefore {
+				t.Fatalf("expected %d messages, has_more=%v, next_before=%d; got %d, %v, %d",
+					tc.wantCount, tc.hasMore, tc.nextBefore, len(page.Messages), page.HasMore, page.NextBefore)
+			}
+			// 页内按时间正序，且是最新的几条
+			got := messageIDs(page.Messages)
+			want := ids[len(ids)-tc.wantCount:]
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("expected ids %v, got %v", want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryChatHistoryBeforeCursor(t *testing.T) {
+	useTestDB(t)
+	ids := seedMessages(t, "room-1", 5)
+
+	cases := []struct {
+		name    string
+		before  uint
+		want    []uint
+		hasMore bool
+	}{
+		{"excludes the cursor itself", ids[3], ids[1:3], true},
+		{"reaches the oldest message", ids[2], ids[0:2], false},
+		{"cursor at oldest message", ids[0], nil, false},
+		{"cursor beyond newest", ids[4] + 100, ids[3:5], true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := QueryChatHistory(ChatHistoryQuery{RoomID: "room-1", Before: tc.before, Limit: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := messageIDs(page.Messages)
+			if len(got) != len(tc.want) || page.HasMore != tc.hasMore {
+				t.Fatalf("expected %v (has_more=%v), got %v (has_more=%v)", tc.want, tc.hasMore, got, page.HasMore)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Fatalf("expected %v, got %v", tc.want, got)
+				}
+			}
+		})
+	}
+
+	// 沿 next_before 一直翻页，每条消息恰好出现一次
+	seen := map[uint]int{}
+	var before uint
+	for {
+		page, err := QueryChatHistory(ChatHistoryQuery{RoomID: "room-1", Before: before, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range page.Messages {
+			seen[m.ID]++
+		}
+		if !page.HasMore {
+			break
+		}
+		before = page.NextBefore
+	}
+	if len(seen) != len(ids) {
+		t.Fatalf("expected to page through %d messages, saw %v", len(ids), seen)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Fatalf("message %d returned %d times", id, n)
+		}
+	}
+}
+
+func TestQueryChatHistoryTimeRange(t *testing.T) {
+	useTestDB(t)
+	ids := seedMessages(t, "room-1", 3)
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	for i, id := range ids {
+		database.DB.Model(&models.Message{}).Where("id = ?", id).Update("created_at", base.AddDate(0, 0, i))
+	}
+
+	page, err := QueryChatHistory(ChatHistoryQuery{RoomID: "room-1", From: base.AddDate(0, 0, 1), To: base.AddDate(0, 0, 2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := messageIDs(page.Messages); len(got) != 1 || got[0] != ids[1] {
+		t.Fatalf("expected only the middle message, got %v", got)
+	}
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestClientChatIsQueuedWithServerSideActor(t *testing.T) {
+	hub := NewHub()
+	host := testClient("room-chat", "111", "host-uuid")
+	guest := testClient("room-chat", "222", "guest-uuid")
+	hub.rooms["room-chat"] = &RoomData{
+		Clients:      map[*Client]bool{host: true, guest: true},
+		HostUUID:     host.UUID,
+		HostUsername: host.Username,
+	}
+
+	hub.handleBroadcast(BroadcastMessage{
+		RoomID:  "room-chat",
+		Message: []byte(`{"type":"chat_delete","messageId":7,"sender":"111"}`),
+		Sender:  guest,
+	})
+
+	select {
+	case op := <-hub.chatOps:
+		if op.Actor != "222" || op.IsHost {
+			t.Fatalf("expected guest actor without host rights, got %+v", op)
+		}
+		if op.Msg.MessageID != 7 {
+			t.Fatalf("expected messageId 7, got %d", op.Msg.MessageID)
+		}
+	default:
+		t.Fatal("expected chat operation to be queued")
+	}
+
+	if len(host.Send) != 0 {
+		t.Fatal("expected chat operation not to be broadcast before persistence")
+	}
+}
+
+func TestSummarizeReactions(t *testing.T) {
+	summaries := summarizeReactions([]models.MessageReaction{
+		{MessageID: 1, Username: "alice", Emoji: "👍"},
+		{MessageID: 1, Username: "bob", Emoji: "🎉"},
+		{MessageID: 1, Username: "bob", Emoji: "👍"},
+		{MessageID: 2, Username: "alice", Emoji: "👍"},
+	})
+
+	first := summaries[1]
+	if len(first) != 2 || first[0].Emoji != "👍" || first[0].Count != 2 || first[1].Count != 1 {
+		t.Fatalf("unexpected summary for message 1: %+v", first)
+	}
+	if len(summaries[2]) != 1 || summaries[2][0].Users[0] != "alice" {
+		t.Fatalf("unexpected summary for message 2: %+v", summaries[2])
+	}
+}
+
+func TestChatSignsOnlyUploadsReadableInRoom(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("UPLOAD_SIGNING_SECRET", "test-secret")
+	database.DB.Create(&models.Upload{StorageKey: "own.png", RoomID: "room-1", Uploader: "bob"})
+	database.DB.Create(&models.Upload{StorageKey: "foreign.png", RoomID: "room-2", Uploader: "carol"})
+	database.DB.Create(&models.Upload{StorageKey: "mine.png", Uploader: "alice"})
+	database.DB.Create(&models.Upload{StorageKey: "private.png", Uploader: "carol"})
+	database.DB.Create(&models.Upload{StorageKey: "avatar.png", Uploader: "carol"})
+	database.DB.Create(&models.User{Username: "carol", Password: "x", Avatar: "/uploads/avatar.png"})
+
+	hub := NewHub()
+	alice := testClient("room-1", "alice", "alice-uuid")
+	hub.applyChatOp(chatOp{
+		Client: alice,
+		RoomID: "room-1",
+		Actor:  "alice",
+		Msg: WSMessage{Type: "chat", Message: `<img src="/uploads/own.png"><img src="/uploads/mine.png">` +
+			`<img src="/uploads/foreign.png?sig=1.abc"><img src="/uploads/private.png"><img src="/uploads/legacy.png"><img src="/uploads/avatar.png">`},
+	})
+
+	var out WSMessage
+	if err := json.Unmarshal((<-hub.broadcast).Message, &out); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"own.png", "mine.png", "avatar.png"} {
+		if !strings.Contains(out.Message, "/uploads/"+key+"?sig=") {
+			t.Fatalf("expected %s to be signed in %q", key, out.Message)
+		}
+	}
+	for _, key := range []string{"foreign.png", "private.png", "legacy.png"} {
+		if !strings.Contains(out.Message, `"/uploads/`+key+`"`) {
+			t.Fatalf("expected %s to stay unsigned in %q", key, out.Message)
+		}
+	}
+	if out.ChatMessage == nil || out.ChatMessage.Content != out.Message {
+		t.Fatalf("expected chat message content to be signed the same way, got %+v", out.ChatMessage)
+	}
+}
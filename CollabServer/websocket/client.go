@@ -2,6 +2,8 @@ package websocket
 
 import (
 	"collab-server/config"
+	"collab-server/middleware"
+	"collab-server/models"
 	"fmt"
 	"log"
 	"net"
@@ -122,6 +124,25 @@ type Client struct {
 	Username string
 	UserID   uint
 	UUID     string // 🟢 唯一客户端标识，用于防止消息反射
+
+	// SessionID 是握手令牌所属的登录会话，会话被吊销时据此断开连接
+	SessionID uint
+
+	// UserChannel 为 true 表示这是 /ws/user 用户频道连接，不属于任何房间（RoomID 为空）
+	UserChannel bool
+
+	// JoinedAt 是进入房间的时间，离开时用于累计访问时长
+	JoinedAt time.Time
+
+	// 显示名与头像（/uploads 规范地址），连接时读取，资料修改后由 UpdateProfile 同步
+	DisplayName string
+	Avatar      string
+	// avatarKey / avatarVersion 是头像签名所需的信息，在 Hub 循环外读取；avatarKey 为空时头像不签名
+	avatarKey     string
+	avatarVersion uint
+
+	// roomSettings 是注册前读取的房间设置，房间第一次加载到内存时使用
+	roomSettings models.Room
 }
 
 func extractTokenFromRequest(c *gin.Context) string {
@@ -142,15 +163,16 @@ func extractTokenFromRequest(c *gin.Context) string {
 	return strings.TrimSpace(parts[1])
 }
 
-func authenticateWS(c *gin.Context) (string, uint, error) {
+// authenticateWS 校验握手携带的访问令牌，返回用户名、用户 ID 与会话 ID
+func authenticateWS(c *gin.Context) (string, uint, uint, error) {
 	tokenString := extractTokenFromRequest(c)
 	if tokenString == "" {
-		return "", 0, fmt.Errorf("缺少 token")
+		return "", 0, 0, fmt.Errorf("缺少 token")
 	}
 
 	jwtSecret := config.GetEnv("JWT_SECRET", "")
 	if jwtSecret == "" {
-		return "", 0, fmt.Errorf("服务器密钥未配置")
+		return "", 0, 0, fmt.Errorf("服务器密钥未配置")
 	}
 
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
@@ -160,22 +182,27 @@ func authenticateWS(c *gin.Context) (string, uint, error) {
 		return []byte(jwtSecret), nil
 	})
 	if err != nil || !token.Valid {
-		return "", 0, fmt.Errorf("token 无效")
+		return "", 0, 0, fmt.Errorf("token 无效")
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", 0, fmt.Errorf("无法解析 token claims")
+		return "", 0, 0, fmt.Errorf("无法解析 token claims")
 	}
 
 	usernameVal, ok := claims["username"]
 	if !ok {
-		return "", 0, fmt.Errorf("缺少 username claims")
+		return "", 0, 0, fmt.Errorf("缺少 username claims")
 	}
 	username, ok := usernameVal.(string)
 	if !ok || strings.TrimSpace(username) == "" {
-		return "", 0, fmt.Errorf("username claims 非法")
+		return "", 0, 0, fmt.Errorf("username claims 非法")
+	}
+	sessionID, active := middleware.SessionActive(claims)
+	if !active {
+		return "", 0, 0, fmt.Errorf("会话已失效")
 	}
+	middleware.TouchSession(sessionID, c.ClientIP())
 
 	var userID uint
 	if userIDRaw, exists := claims["userId"]; exists {
@@ -195,7 +222,7 @@ func authenticateWS(c *gin.Context) (string, uint, error) {
 		}
 	}
 
-	return strings.TrimSpace(username), userID, nil
+	return strings.TrimSpace(username), userID, sessionID, nil
 }
 
 func (c *Client) readPump() {
@@ -258,7 +285,7 @@ func (c *Client) writePump() {
 }
 
 func ServeWs(hub *Hub, c *gin.Context) {
-	username, userID, err := authenticateWS(c)
+	username, userID, sessionID, err := authenticateWS(c)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "WebSocket 鉴权失败"})
 		return
@@ -266,13 +293,48 @@ func ServeWs(hub *Hub, c *gin.Context) {
 
 	roomID := c.Query("room")
 	if roomID == "" {
-		roomID = "lobby"
+		roomID = DefaultRoomID
 	}
 	roomID = strings.TrimSpace(roomID)
 	if roomID == "" {
-		roomID = "lobby"
+		roomID = DefaultRoomID
+	}
+	if roomTrashed(roomID) {
+		c.JSON(http.StatusGone, gin.H{"error": "房间已删除"})
+		return
+	}
+
+	startClient(hub, c, &Client{
+		RoomID:    roomID,
+		Username:  username,
+		UserID:    userID,
+		SessionID: sessionID,
+	})
+}
+
+// =============================================================================
+// ServeUserWs 用户频道：/ws/user
+// =============================================================================
+// 不绑定房间，同一用户可以同时保持多个连接（桌面端 + 浏览器）。
+// 用于私信、通知等按用户投递的消息。
+// =============================================================================
+func ServeUserWs(hub *Hub, c *gin.Context) {
+	username, userID, sessionID, err := authenticateWS(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "WebSocket 鉴权失败"})
+		return
 	}
 
+	startClient(hub, c, &Client{
+		Username:    username,
+		UserID:      userID,
+		SessionID:   sessionID,
+		UserChannel: true,
+	})
+}
+
+// startClient 升级连接、分配 UUID 并把客户端注册到 Hub
+func startClient(hub *Hub, c *gin.Context, client *Client) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Println(err)
@@ -282,15 +344,15 @@ func ServeWs(hub *Hub, c *gin.Context) {
 	// 🟢 生成唯一客户端 UUID
 	clientUUID := uuid.New().String()
 
-	client := &Client{
-		Hub:      hub,
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-		RoomID:   roomID,
-		Username: username,
-		UserID:   userID,
-		UUID:     clientUUID,
+	// 数据库查询都在注册前完成，不占用 Hub 的事件循环
+	loadProfile(client)
+	if !client.UserChannel {
+		client.roomSettings = loadRoomSettings(client.RoomID, client.Username)
 	}
+	client.Hub = hub
+	client.Conn = conn
+	client.Send = make(chan []byte, 256)
+	client.UUID = clientUUID
 
 	// 🟢 立即发送 client_id 给前端，用于消息隔离
 	welcomeMsg := []byte(`{"type":"client_id","uuid":"` + clientUUID + `"}`)
@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+)
+
+// =============================================================================
+// 私信（Direct Message）
+// =============================================================================
+// 私信不属于任何房间。客户端通过 /ws/user 建立"用户频道"连接（Client.UserChannel），
+// Hub 按用户名索引这些连接；投递时使用 SendToUsers，因此收件人的每一个会话
+// （用户频道以及正在打开的房间连接）都会收到 dm 消息。
+//
+// 用户频道上的客户端消息：
+//   - dm_send { conversationId, message }
+//   - dm_read { conversationId, messageId }
+// 同样的能力也通过 REST 暴露，离线消息落库后由未读数提醒。
+// =============================================================================
+
+var (
+	ErrConversationNotFound = errors.New("会话不存在或无权访问")
+	ErrEmptyDirectMessage   = errors.New("消息内容不能为空")
+)
+
+// conversationMembers 返回会话成员用户名；username 不是成员时返回 ErrConversationNotFound
+func conversationMembers(conversationID uint, username string) ([]string, error) {
+	var members []string
+	database.DB.Model(&models.ConversationMember{}).
+		Where("conversation_id = ?", conversationID).
+		Pluck("username", &members)
+	for _, m := range members {
+		if m == username {
+			return members, nil
+		}
+	}
+	return nil, ErrConversationNotFound
+}
+
+// SendDirectMessage 保存一条私信并推送给会话所有成员的在线会话
+func (h *Hub) SendDirectMessage(conversationID uint, sender, content string) (models.DirectMessage, error) {
+	msg := models.DirectMessage{ConversationID: conversationID, Sender: sender, Content: content}
+	if strings.TrimSpace(content) == "" {
+		return msg, ErrEmptyDirectMessage
+	}
+
+	members, err := conversationMembers(conversationID, sender)
+	if err != nil {
+		return msg, err
+	}
+
+	if err := database.DB.Create(&msg).Error; err != nil {
+		return msg, err
+	}
+	database.DB.Model(&models.Conversation{}).Where("id = ?", conversationID).Update("last_message_at", msg.CreatedAt)
+	// 自己发出的消息视为已读
+	database.DB.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND username = ?", conversationID, sender).
+		Update("last_read_message_id", msg.ID)
+
+	b, _ := json.Marshal(WSMessage{
+		Type:           "dm",
+		Sender:         sender,
+		ConversationID: conversationID,
+		DirectMessage:  &msg,
+	})
+	h.SendToUsers(members, b)
+	return msg, nil
+}
+
+// MarkConversationRead 把会话标记为已读到 messageID（0 表示最新一条），并同步到该用户的其他会话
+func (h *Hub) MarkConversationRead(conversationID uint, username string, messageID uint) error {
+	if _, err := conversationMembers(conversationID, username); err != nil {
+		return err
+	}
+
+	if messageID == 0 {
+		var latest models.DirectMessage
+		if err := database.DB.Where("conversation_id = ?", conversationID).Order("id desc").First(&latest).Error; err != nil {
+			return nil
+		}
+		messageID = latest.ID
+	}
+
+	// 已读位置只前进不后退
+	database.DB.Model(&models.ConversationMember{}).
+		Where("conversation_id = ? AND username = ? AND last_read_message_id < ?", conversationID, username, messageID).
+		Update("last_read_message_id", messageID)
+
+	b, _ := json.Marshal(WSMessage{Type: "dm_read", ConversationID: conversationID, MessageID: messageID})
+	h.SendToUsers([]string{username}, b)
+	return nil
+}
+
+// handleUserChannelMessage 处理用户频道上的客户端消息（在 Hub goroutine 中调用）
+func (h *Hub) handleUserChannelMessage(message BroadcastMessage) {
+	client := message.Sender
+	var msg WSMessage
+	if err := json.Unmarshal(message.Message, &msg); err != nil {
+		h.sendErrorToClient(client, "消息格式错误")
+		return
+	}
+
+	switch msg.Type {
+	case "dm_send":
+		go func() {
+			if _, err := h.SendDirectMessage(msg.ConversationID, client.Username, msg.Message); err != nil {
+				h.replyError(client, err.Error())
+			}
+		}()
+	case "dm_read":
+		go func() {
+			if err := h.MarkConversationRead(msg.ConversationID, client.Username, msg.MessageID); err != nil {
+				h.replyError(client, err.Error())
+			}
+		}()
+	case "lobby_subscribe":
+		h.subscribeLobby(client)
+	case "lobby_unsubscribe":
+		h.unsubscribeLobby(client)
+	default:
+		h.sendErrorToClient(client, "用户频道不支持该消息类型")
+	}
+}
+
+// registerUserChannel / unregisterUserChannel 维护按用户名索引的用户频道连接
+func (h *Hub) registerUserChannel(client *Client) {
+	sessions, ok := h.userClients[client.Username]
+	if !ok {
+		sessions = make(map[*Client]bool)
+		h.userClients[client.Username] = sessions
+	}
+	sessions[client] = true
+	log.Printf("User channel: %s (%d 个会话)", client.Username, len(sessions))
+}
+
+func (h *Hub) unregisterUserChannel(client *Client) {
+	sessions, ok := h.userClients[client.Username]
+	if !ok || !sessions[client] {
+		return
+	}
+	delete(sessions, client)
+	delete(h.lobby, client)
+	close(client.Send)
+	if len(sessions) == 0 {
+		delete(h.userClients, client.Username)
+	}
+}
@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentVisitsShareOneHistoryRow(t *testing.T) {
+	useTestDB(t)
+	hub := NewHub()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hub.saveVisitHistory("alice", "room-1")
+		}()
+	}
+	wg.Wait()
+
+	var rows []models.History
+	database.DB.Where("username = ? AND room_id = ?", "alice", "room-1").Find(&rows)
+	if len(rows) != 1 || rows[0].VisitCount != 5 {
+		t.Fatalf("expected one record with 5 visits, got %+v", rows)
+	}
+}
+
+func TestRecordVisitTimeAccumulates(t *testing.T) {
+	useTestDB(t)
+	hub := NewHub()
+	hub.saveVisitHistory("alice", "room-1")
+
+	leave := func(stayed time.Duration) {
+		client := testClient("room-1", "alice", "uuid")
+		client.JoinedAt = time.Now().Add(-stayed)
+		hub.recordVisitTime(client)
+		// 同一连接重复离开不会重复计时
+		hub.recordVisitTime(client)
+	}
+	leave(90 * time.Second)
+	leave(30 * time.Second)
+	leave(0)
+
+	// 累加在独立 goroutine 中执行
+	deadline := time.Now().Add(2 * time.Second)
+	var history models.History
+	for {
+		database.DB.Where("username = ? AND room_id = ?", "alice", "room-1").First(&history)
+		if history.TimeSpent >= 120 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	database.DB.First(&history, history.ID)
+	if history.TimeSpent != 120 {
+		t.Fatalf("expected 120 seconds in total, got %d", history.TimeSpent)
+	}
+}
@@ -3,10 +3,13 @@ package websocket
 import (
 	"collab-server/database"
 	"collab-server/models"
+	"collab-server/richtext"
+	"collab-server/uploads"
 	"encoding/json"
 	"log"
 	"time"
 
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -15,6 +18,15 @@ type RoomData struct {
 	Content      string
 	HostUUID     string
 	HostUsername string
+
+	// 文档提及扫描：MentionBase 是上次扫描时的内容，LastEditor 是最近一次编辑者
+	MentionBase string
+	LastEditor  string
+
+	// 活跃房间目录：Title、Public 来自 models.Room，LastActivity 为最近一次进出或消息的时间
+	Title        string
+	Public       bool
+	LastActivity time.Time
 }
 
 type BroadcastMessage struct {
@@ -23,6 +35,12 @@ type BroadcastMessage struct {
 	Sender  *Client
 }
 
+// UserMessage 是按用户名投递的消息，不区分用户所在房间
+type UserMessage struct {
+	Usernames []string
+	Message   []byte
+}
+
 type WSMessage struct {
 	Type       string           `json:"type"`
 	RoomID     string           `json:"roomId,omitempty"`
@@ -31,10 +49,32 @@ type WSMessage struct {
 	Sender     string           `json:"sender,omitempty"`
 	ClientUUID string           `json:"clientUUID,omitempty"` // 🟢 用于 UUID 过滤
 	Users      []string         `json:"users,omitempty"`
+	Members    []MemberInfo     `json:"members,omitempty"` // user_list：在线成员的显示名与头像
 	History    []models.Message `json:"history,omitempty"`
 	Cursor     int              `json:"cursor,omitempty"`
 	IsHost     bool             `json:"isHost,omitempty"`
 	Host       string           `json:"host,omitempty"`
+	Title      string           `json:"title,omitempty"` // room_meta：房间标题
+
+	Notification *models.Notification `json:"notification,omitempty"`
+
+	// 聊天线程、编辑、删除与表情回应
+	MessageID   uint            `json:"messageId,omitempty"`
+	ReplyTo     uint            `json:"replyTo,omitempty"`
+	Emoji       string          `json:"emoji,omitempty"`
+	ChatMessage *models.Message `json:"chatMessage,omitempty"`
+
+	// 聊天记录分页：请求时 limit 为页大小，响应时 hasMore 表示是否还有更早的消息
+	Limit   int  `json:"limit,omitempty"`
+	HasMore bool `json:"hasMore,omitempty"`
+
+	// 私信
+	ConversationID uint                  `json:"conversationId,omitempty"`
+	DirectMessage  *models.DirectMessage `json:"directMessage,omitempty"`
+
+	// 大厅：lobby_snapshot 带 rooms，lobby_update 带 room
+	Rooms []ActiveRoom `json:"rooms,omitempty"`
+	Room  *ActiveRoom  `json:"room,omitempty"`
 }
 
 type Hub struct {
@@ -43,6 +83,13 @@ type Hub struct {
 	unregister chan *Client
 	broadcast  chan BroadcastMessage
 	dirtyRooms map[string]bool
+
+	userClients    map[string]map[*Client]bool // 用户频道连接（/ws/user），不属于任何房间
+	userMessages   chan UserMessage
+	chatOps        chan chatOp
+	clientMessages chan clientMessage
+	requests       chan func()      // 需要在 Hub goroutine 中读写房间状态的外部调用，见 do
+	lobby          map[*Client]bool // 订阅了活跃房间目录的用户频道连接
 }
 
 func NewHub() *Hub {
@@ -52,7 +99,140 @@ func NewHub() *Hub {
 		unregister: make(chan *Client, 100),
 		rooms:      make(map[string]*RoomData),
 		dirtyRooms: make(map[string]bool),
+
+		userClients:    make(map[string]map[*Client]bool),
+		userMessages:   make(chan UserMessage, 256),
+		chatOps:        make(chan chatOp, 256),
+		clientMessages: make(chan clientMessage, 256),
+		requests:       make(chan func(), 64),
+		lobby:          make(map[*Client]bool),
+	}
+}
+
+// do 在 Hub goroutine 中执行 fn 并等待其完成，供 HTTP 处理器安全地访问 rooms
+func (h *Hub) do(fn func()) {
+	done := make(chan struct{})
+	h.requests <- func() {
+		defer close(done)
+		fn()
 	}
+	<-done
+}
+
+// RoomContent 返回房间在内存中的最新文档；房间未加载时 ok 为 false，应改读数据库
+// （内存内容每 5 秒才落盘一次）
+func (h *Hub) RoomContent(roomID string) (content string, ok bool) {
+	h.do(func() {
+		if room, exists := h.rooms[roomID]; exists {
+			content, ok = room.Content, true
+		}
+	})
+	return content, ok
+}
+
+// RoomUsers 返回房间当前在线成员的用户名
+func (h *Hub) RoomUsers(roomID string) (users []string) {
+	h.do(func() {
+		users = h.getUserList(roomID)
+	})
+	return users
+}
+
+// CloseRoom 保存文档后关闭房间并断开所有成员，返回房间是否在线
+func (h *Hub) CloseRoom(roomID, reason string) (closed bool) {
+	h.do(func() {
+		if _, ok := h.rooms[roomID]; ok {
+			h.dissolveRoom(roomID, nil, reason)
+			closed = true
+		}
+	})
+	return closed
+}
+
+// DisconnectUser 向该用户的所有连接（房间与用户频道）发送 force_logout 后断开，返回断开的连接数。
+// 该用户是房主时按房主离开处理，房间随之解散
+func (h *Hub) DisconnectUser(username, reason string) int {
+	return h.disconnectClients(func(c *Client) bool { return c.Username == username }, reason)
+}
+
+// DisconnectSession 断开由某个登录会话建立的全部连接，用于退出登录或吊销单个会话
+func (h *Hub) DisconnectSession(sessionID uint, reason string) int {
+	return h.disconnectClients(func(c *Client) bool { return c.SessionID == sessionID }, reason)
+}
+
+func (h *Hub) disconnectClients(match func(*Client) bool, reason string) (count int) {
+	b, _ := json.Marshal(WSMessage{Type: "force_logout", Message: reason})
+	h.do(func() {
+		var targets []*Client
+		for _, room := range h.rooms {
+			for c := range room.Clients {
+				if match(c) {
+					targets = append(targets, c)
+				}
+			}
+		}
+		for _, c := range targets {
+			// 前一个连接解散了房间时，同房间的其余连接已被关闭
+			if room, ok := h.rooms[c.RoomID]; !ok || !room.Clients[c] {
+				continue
+			}
+			select {
+			case c.Send <- b:
+			default:
+			}
+			h.handleUnregister(c)
+			count++
+		}
+		for _, sessions := range h.userClients {
+			for c := range sessions {
+				if !match(c) {
+					continue
+				}
+				select {
+				case c.Send <- b:
+				default:
+				}
+				h.unregisterUserChannel(c)
+				count++
+			}
+		}
+	})
+	return count
+}
+
+// ReplaceDocument 用 content 整体替换房间文档并立即落盘，返回替换前的内容。
+// 房间已加载时同时推送 doc_update，在线成员的编辑器会直接切换到新内容
+func (h *Hub) ReplaceDocument(roomID, content, actor string) (previous string) {
+	content = richtext.Sanitize(content)
+	h.do(func() {
+		room, ok := h.rooms[roomID]
+		if !ok {
+			previous = h.loadDocumentFromDB(roomID)
+			h.saveDocumentToDB(roomID, content)
+			return
+		}
+
+		previous = room.Content
+		room.Content = content
+		room.LastEditor = actor
+		h.saveDocumentToDB(roomID, content)
+		// 仍标记为脏，让定时器照常扫描新内容中的 @提及
+		h.dirtyRooms[roomID] = true
+
+		b, _ := json.Marshal(WSMessage{Type: "doc_update", RoomID: roomID, Content: uploads.SignLinks(content, roomID, ""), Sender: actor})
+		for client := range room.Clients {
+			select {
+			case client.Send <- b:
+			default:
+			}
+		}
+	})
+	return previous
+}
+
+// SendToUsers 把消息投递给指定用户的所有在线连接（可在任意 goroutine 中调用）
+func (h *Hub) SendToUsers(usernames []string, message []byte) {
+	h.userMessages <- UserMessage{Usernames: usernames, Message: message}
 }
 
 func (h *Hub) saveDocumentToDB(roomID string, content string) {
@@ -65,15 +245,32 @@ func (h *Hub) saveDocumentToDB(roomID string, content string) {
 	}).Create(&models.Document{RoomID: roomID, Content: content})
 }
 
+// saveVisitHistory 记录一次进入房间。多个标签页同时进入时由唯一索引合并为同一条记录
 func (h *Hub) saveVisitHistory(username, roomID string) {
-	var history models.History
-	result := database.DB.Where("username = ? AND room_id = ?", username, roomID).First(&history)
-	if result.Error == nil {
-		history.UpdatedAt = time.Now()
-		database.DB.Save(&history)
-	} else {
-		database.DB.Create(&models.History{Username: username, RoomID: roomID, UpdatedAt: time.Now()})
+	now := time.Now()
+	database.DB.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "username"}, {Name: "room_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"updated_at":  now,
+			"visit_count": gorm.Expr("visit_count + 1"),
+		}),
+	}).Create(&models.History{Username: username, RoomID: roomID, UpdatedAt: now, VisitCount: 1})
+}
+
+// recordVisitTime 在连接离开房间时累加停留时长，每个连接只记一次
+func (h *Hub) recordVisitTime(client *Client) {
+	if client.JoinedAt.IsZero() {
+		return
 	}
+	seconds := int64(time.Since(client.JoinedAt).Seconds())
+	client.JoinedAt = time.Time{}
+	if seconds <= 0 {
+		return
+	}
+	username, roomID := client.Username, client.RoomID
+	go database.DB.Model(&models.History{}).
+		Where("username = ? AND room_id = ?", username, roomID).
+		UpdateColumn("time_spent", gorm.Expr("time_spent + ?", seconds))
 }
 
 func (h *Hub) loadDocumentFromDB(roomID string) string {
@@ -81,34 +278,39 @@ func (h *Hub) loadDocumentFromDB(roomID string) string {
 	if err := database.DB.Where("room_id = ?", roomID).First(&doc).Error; err != nil {
 		return ""
 	}
-	return doc.Content
-}
-
-func (h *Hub) saveChatToDB(roomID, sender, message string) {
-	database.DB.Create(&models.Message{RoomID: roomID, Sender: sender, Content: message})
+	// 清洗上线前保存的旧内容
+	return richtext.Sanitize(doc.Content)
 }
 
-func (h *Hub) loadChatHistory(roomID string) []models.Message {
-	var messages []models.Message
-	database.DB.Where("room_id = ?", roomID).Order("id desc").Limit(50).Find(&messages)
-	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
-		messages[i], messages[j] = messages[j], messages[i]
+func (h *Hub) loadChatHistory(roomID string) ChatHistoryPage {
+	page, err := QueryChatHistory(ChatHistoryQuery{RoomID: roomID})
+	if err != nil {
+		log.Printf("⚠️ 加载聊天记录失败: %v", err)
 	}
-	return messages
+	return page
 }
 
 func (h *Hub) Run() {
 	saveTicker := time.NewTicker(5 * time.Second)
 	defer saveTicker.Stop()
 
+	go h.runChatWorker()
+
 	for {
 		select {
 		case client := <-h.register:
+			if client.UserChannel {
+				h.registerUserChannel(client)
+				break
+			}
 			roomID := client.RoomID
 			if _, ok := h.rooms[roomID]; !ok {
-				h.rooms[roomID] = &RoomData{Clients: make(map[*Client]bool), Content: h.loadDocumentFromDB(roomID)}
+				content := h.loadDocumentFromDB(roomID)
+				settings := client.roomSettings
+				h.rooms[roomID] = &RoomData{Clients: make(map[*Client]bool), Content: content, MentionBase: content, Title: settings.Title, Public: settings.Public}
 			}
 			room := h.rooms[roomID]
+			room.LastActivity = time.Now()
 
 			// 简单的踢人逻辑 (防止多开)
 			for existingClient := range room.Clients {
@@ -117,12 +319,14 @@ func (h *Hub) Run() {
 						room.HostUUID = ""
 						room.HostUsername = ""
 					}
+					h.recordVisitTime(existingClient)
 					close(existingClient.Send)
 					delete(room.Clients, existingClient)
 				}
 			}
 
 			room.Clients[client] = true
+			client.JoinedAt = time.Now()
 			if room.HostUUID == "" {
 				room.HostUUID = client.UUID
 				room.HostUsername = client.Username
@@ -130,16 +334,31 @@ func (h *Hub) Run() {
 			log.Printf("Join: %s (Room: %s)", client.Username, roomID)
 
 			// 初始数据发送 (尽力而为)
-			h.sendJSONToClient(client, "user_list", nil, h.getUserList(roomID))
+			select {
+			case client.Send <- h.userListMessage(roomID):
+			default:
+			}
 			go h.saveVisitHistory(client.Username, roomID)
 
 			if room.Content != "" {
-				h.sendJSONToClient(client, "doc_update", room.Content, "System")
+				h.sendJSONToClient(client, "doc_update", uploads.SignLinks(room.Content, roomID, ""), "System")
+			}
+			if room.Title != "" {
+				b, _ := json.Marshal(WSMessage{Type: "room_meta", RoomID: roomID, Title: room.Title})
+				select {
+				case client.Send <- b:
+				default:
+				}
 			}
 
 			history := h.loadChatHistory(roomID)
-			if len(history) > 0 {
-				b, _ := json.Marshal(WSMessage{Type: "chat_history", History: history})
+			if len(history.Messages) > 0 {
+				b, _ := json.Marshal(WSMessage{
+					Type:      "chat_history",
+					History:   history.Messages,
+					HasMore:   history.HasMore,
+					MessageID: history.NextBefore,
+				})
 				select {
 				case client.Send <- b:
 				default:
@@ -147,6 +366,7 @@ func (h *Hub) Run() {
 			}
 			h.broadcastUserList(roomID)
 			h.broadcastHostStatus(roomID)
+			h.notifyLobby(roomID)
 
 		case client := <-h.unregister:
 			h.handleUnregister(client)
@@ -154,10 +374,23 @@ func (h *Hub) Run() {
 		case message := <-h.broadcast:
 			h.handleBroadcast(message)
 
+		case message := <-h.userMessages:
+			h.deliverToUsers(message)
+
+		case message := <-h.clientMessages:
+			h.deliverToClient(message)
+
+		case fn := <-h.requests:
+			fn()
+
 		case <-saveTicker.C:
 			for rID := range h.dirtyRooms {
 				if room, ok := h.rooms[rID]; ok {
 					go h.saveDocumentToDB(rID, room.Content)
+					if room.Content != room.MentionBase {
+						go h.processDocumentMentions(rID, room.LastEditor, room.MentionBase, room.Content)
+						room.MentionBase = room.Content
+					}
 				}
 			}
 			h.dirtyRooms = make(map[string]bool)
@@ -166,6 +399,10 @@ func (h *Hub) Run() {
 }
 
 func (h *Hub) handleUnregister(client *Client) {
+	if client.UserChannel {
+		h.unregisterUserChannel(client)
+		return
+	}
 	roomID := client.RoomID
 	if room, ok := h.rooms[roomID]; ok {
 		if _, ok := room.Clients[client]; ok {
@@ -175,7 +412,9 @@ func (h *Hub) handleUnregister(client *Client) {
 			}
 
 			delete(room.Clients, client)
+			h.recordVisitTime(client)
 			close(client.Send)
+			room.LastActivity = time.Now()
 			h.broadcastUserList(roomID)
 
 			// 🧹 空房间自动清理：最后一人离开后保存文档并销毁内存房间
@@ -187,20 +426,35 @@ func (h *Hub) handleUnregister(client *Client) {
 				delete(h.dirtyRooms, roomID)
 				log.Printf("🧹 房间 %s 已空，内存已清理", roomID)
 			}
+			if listedInLobby(roomID, room) {
+				h.notifyLobby(roomID)
+			}
 		}
 	}
 }
 
 func (h *Hub) handleBroadcast(message BroadcastMessage) {
+	if message.Sender != nil && message.Sender.UserChannel {
+		h.handleUserChannelMessage(message)
+		return
+	}
 	if room, ok := h.rooms[message.RoomID]; ok {
+		room.LastActivity = time.Now()
+
 		// 🟢 先解析消息类型，用于智能过滤
 		var tmpMsg WSMessage
 		msgType := ""
 		if err := json.Unmarshal(message.Message, &tmpMsg); err == nil {
 			msgType = tmpMsg.Type
-			if message.Sender != nil {
+			if msgType == "doc_update" {
+				// 文档会原样渲染到所有成员的 WebView 中，广播和存储前都必须按白名单清洗
+				tmpMsg.Content = richtext.Sanitize(tmpMsg.Content)
+			}
+			if message.Sender != nil || msgType == "doc_update" {
 				// 服务端覆盖 sender，避免客户端伪造身份。
-				tmpMsg.Sender = message.Sender.Username
+				if message.Sender != nil {
+					tmpMsg.Sender = message.Sender.Username
+				}
 				rebuilt, marshalErr := json.Marshal(tmpMsg)
 				if marshalErr == nil {
 					message.Message = rebuilt
@@ -217,6 +471,26 @@ func (h *Hub) handleBroadcast(message BroadcastMessage) {
 			return
 		}
 
+		// 📜 向前翻页只回复请求者，不广播
+		if msgType == "chat_history_before" {
+			if message.Sender != nil {
+				go h.sendChatHistoryPage(message.Sender, message.RoomID, tmpMsg.MessageID, tmpMsg.Limit)
+			}
+			return
+		}
+
+		// 💬 聊天类消息先交给 chatWorker 落库，落库后再由服务端回灌广播
+		if message.Sender != nil && isChatOp(msgType) {
+			h.enqueueChatOp(chatOp{
+				Client: message.Sender,
+				RoomID: message.RoomID,
+				Actor:  message.Sender.Username,
+				IsHost: message.Sender.UUID == room.HostUUID,
+				Msg:    tmpMsg,
+			})
+			return
+		}
+
 		// 🟢 核心修复：分级广播 + UUID 双重过滤
 		// - doc_update: 只发给其他人（避免同步回环闪烁）
 		// - user_list/chat/cursor_update 等: 发给所有人（包括发送者）
@@ -245,14 +519,11 @@ func (h *Hub) handleBroadcast(message BroadcastMessage) {
 		// 处理数据持久化
 		switch msgType {
 		case "doc_update":
-			room.Content = tmpMsg.Content
-			h.dirtyRooms[message.RoomID] = true
-		case "chat":
-			sender := tmpMsg.Sender
+			room.Content = uploads.StripSignatures(tmpMsg.Content)
 			if message.Sender != nil {
-				sender = message.Sender.Username
+				room.LastEditor = message.Sender.Username
 			}
-			go h.saveChatToDB(message.RoomID, sender, tmpMsg.Message)
+			h.dirtyRooms[message.RoomID] = true
 		}
 	}
 }
@@ -283,11 +554,15 @@ func (h *Hub) dissolveRoom(roomID string, actor *Client, reason string) {
 		case c.Send <- b:
 		default:
 		}
+		h.recordVisitTime(c)
 		close(c.Send)
 	}
 
 	delete(h.rooms, roomID)
 	delete(h.dirtyRooms, roomID)
+	if listedInLobby(roomID, room) {
+		h.notifyLobbyClosed(roomID)
+	}
 	log.Printf("🧹 房间 %s 已解散: %s", roomID, reason)
 }
 
@@ -302,6 +577,64 @@ func (h *Hub) sendErrorToClient(client *Client, message string) {
 	}
 }
 
+// replyError 从非 Hub goroutine 向单个连接回复错误，由 Hub 确认连接仍然有效后发送
+func (h *Hub) replyError(client *Client, message string) {
+	b, _ := json.Marshal(WSMessage{Type: "error", Message: message})
+	h.clientMessages <- clientMessage{Client: client, Message: b}
+}
+
+// deliverToUsers 遍历所有房间，把消息发给目标用户的每一个连接
+func (h *Hub) deliverToUsers(message UserMessage) {
+	targets := make(map[string]bool, len(message.Usernames))
+	for _, name := range message.Usernames {
+		targets[name] = true
+	}
+	for _, room := range h.rooms {
+		for c := range room.Clients {
+			if !targets[c.Username] {
+				continue
+			}
+			select {
+			case c.Send <- message.Message:
+			default:
+			}
+		}
+	}
+	for name := range targets {
+		for c := range h.userClients[name] {
+			select {
+			case c.Send <- message.Message:
+			default:
+			}
+		}
+	}
+}
+
+// deliverToClient 只在连接仍在房间中时发送，避免向已关闭的 Send 通道写入
+func (h *Hub) deliverToClient(message clientMessage) {
+	if message.Client == nil {
+		return
+	}
+	if message.Client.UserChannel {
+		if !h.userClients[message.Client.Username][message.Client] {
+			return
+		}
+		select {
+		case message.Client.Send <- message.Message:
+		default:
+		}
+		return
+	}
+	room, ok := h.rooms[message.Client.RoomID]
+	if !ok || !room.Clients[message.Client] {
+		return
+	}
+	select {
+	case message.Client.Send <- message.Message:
+	default:
+	}
+}
+
 // 辅助：获取用户列表
 func (h *Hub) getUserList(roomID string) []string {
 	var list []string
@@ -331,8 +664,7 @@ func (h *Hub) sendJSONToClient(client *Client, msgType string, content interface
 }
 
 func (h *Hub) broadcastUserList(roomID string) {
-	list := h.getUserList(roomID)
-	b, _ := json.Marshal(WSMessage{Type: "user_list", Users: list})
+	b := h.userListMessage(roomID)
 	if room, ok := h.rooms[roomID]; ok {
 		for c := range room.Clients {
 			select {
@@ -1,8 +1,14 @@
 package websocket
 
 import (
+	"collab-server/database"
+	"collab-server/models"
 	"encoding/json"
 	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func TestHostUnregisterDissolvesRoom(t *testing.T) {
@@ -82,6 +88,33 @@ func TestNonHostCannotDissolveRoom(t *testing.T) {
 	}
 }
 
+func TestDeliverToUsersReachesRoomsAndUserChannel(t *testing.T) {
+	hub := NewHub()
+	inRoom := testClient("room-4", "alice", "room-uuid")
+	other := testClient("room-4", "bob", "bob-uuid")
+	hub.rooms["room-4"] = &RoomData{Clients: map[*Client]bool{inRoom: true, other: true}}
+
+	userChannel := testClient("", "alice", "user-uuid")
+	userChannel.UserChannel = true
+	hub.registerUserChannel(userChannel)
+
+	hub.deliverToUsers(UserMessage{Usernames: []string{"alice"}, Message: []byte(`{"type":"dm"}`)})
+
+	for _, c := range []*Client{inRoom, userChannel} {
+		if msg := readWSMessage(t, c.Send); msg.Type != "dm" {
+			t.Fatalf("expected dm for %s, got %q", c.UUID, msg.Type)
+		}
+	}
+	if len(other.Send) != 0 {
+		t.Fatal("expected other users not to receive the message")
+	}
+
+	hub.handleUnregister(userChannel)
+	if _, ok := hub.userClients["alice"]; ok {
+		t.Fatal("expected last user channel session to be removed")
+	}
+}
+
 func testClient(roomID, username, uuid string) *Client {
 	return &Client{
 		RoomID:   roomID,
@@ -105,3 +138,195 @@ func readWSMessage(t *testing.T, ch <-chan []byte) WSMessage {
 	}
 	return msg
 }
+
+func TestDocUpdateIsSanitizedBeforeBroadcastAndStore(t *testing.T) {
+	hub := NewHub()
+	author := testClient("room-4", "111", "author-uuid")
+	reader := testClient("room-4", "222", "reader-uuid")
+	hub.rooms["room-4"] = &RoomData{
+		Clients:      map[*Client]bool{author: true, reader: true},
+		HostUUID:     author.UUID,
+		HostUsername: author.Username,
+	}
+
+	hub.handleBroadcast(BroadcastMessage{
+		RoomID:  "room-4",
+		Message: []byte(`{"type":"doc_update","content":"<p onclick=\"x()\">hi<script>alert(1)</script><img src=x onerror=alert(1)></p>"}`),
+		Sender:  author,
+	})
+
+	const want = `<p>hi<img src="x"/></p>`
+	msg := readWSMessage(t, reader.Send)
+	if msg.Type != "doc_update" || msg.Content != want {
+		t.Fatalf("expected sanitized doc_update, got %q %q", msg.Type, msg.Content)
+	}
+	if got := hub.rooms["room-4"].Content; got != want {
+		t.Fatalf("expected sanitized room content, got %q", got)
+	}
+}
+
+func TestLobbyReceivesPublicRoomsOnly(t *testing.T) {
+	hub := NewHub()
+	host := testClient("room-5", "111", "host-uuid")
+	guest := testClient("room-5", "222", "guest-uuid")
+	hub.rooms["room-5"] = &RoomData{
+		Clients:      map[*Client]bool{host: true, guest: true},
+		HostUUID:     host.UUID,
+		HostUsername: host.Username,
+		Public:       true,
+	}
+	// 未公开的房间（默认）和默认的 lobby 房间都不推送
+	hub.rooms["secret"] = &RoomData{Clients: map[*Client]bool{}}
+	hub.rooms[DefaultRoomID] = &RoomData{Clients: map[*Client]bool{}, Public: true}
+
+	watcher := testClient("", "333", "watcher-uuid")
+	watcher.UserChannel = true
+	hub.handleUserChannelMessage(BroadcastMessage{Message: []byte(`{"type":"lobby_subscribe"}`), Sender: watcher})
+
+	snapshot := readWSMessage(t, watcher.Send)
+	if snapshot.Type != "lobby_snapshot" || len(snapshot.Rooms) != 1 {
+		t.Fatalf("expected snapshot with one public room, got %+v", snapshot)
+	}
+	if r := snapshot.Rooms[0]; r.RoomID != "room-5" || r.Members != 2 || r.Host != "111" {
+		t.Fatalf("unexpected room summary %+v", r)
+	}
+
+	hub.handleUnregister(guest)
+	update := readWSMessage(t, watcher.Send)
+	if update.Type != "lobby_update" || update.Room == nil || update.Room.Members != 1 {
+		t.Fatalf("expected lobby_update with one member, got %+v", update)
+	}
+
+	hub.handleUnregister(host)
+	closed := readWSMessage(t, watcher.Send)
+	if closed.Type != "lobby_room_closed" || closed.RoomID != "room-5" {
+		t.Fatalf("expected lobby_room_closed, got %+v", closed)
+	}
+}
+
+func TestActiveRoomsSkipsDefaultRoom(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	hub.do(func() {
+		hub.rooms["room-7"] = &RoomData{Clients: map[*Client]bool{}}
+		hub.rooms[DefaultRoomID] = &RoomData{Clients: map[*Client]bool{}}
+	})
+
+	rooms := hub.ActiveRooms()
+	if len(rooms) != 1 || rooms[0].RoomID != "room-7" || rooms[0].Public {
+		t.Fatalf("expected only room-7, not public by default, got %+v", rooms)
+	}
+}
+
+func TestSetRoomPublicUpdatesLobby(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	watcher := testClient("", "333", "watcher-uuid")
+	watcher.UserChannel = true
+	hub.do(func() {
+		hub.rooms["room-8"] = &RoomData{Clients: map[*Client]bool{}}
+		hub.subscribeLobby(watcher)
+	})
+	if snapshot := readWSMessage(t, watcher.Send); len(snapshot.Rooms) != 0 {
+		t.Fatalf("expected rooms to be unlisted by default, got %+v", snapshot.Rooms)
+	}
+
+	hub.SetRoomPublic("room-8", true)
+	if update := readWSMessage(t, watcher.Send); update.Type != "lobby_update" || update.Room == nil || update.Room.RoomID != "room-8" {
+		t.Fatalf("expected lobby_update after publishing, got %+v", update)
+	}
+	hub.SetRoomPublic("room-8", false)
+	if closed := readWSMessage(t, watcher.Send); closed.Type != "lobby_room_closed" || closed.RoomID != "room-8" {
+		t.Fatalf("expected lobby_room_closed after unpublishing, got %+v", closed)
+	}
+}
+
+func TestDisconnectUserClosesAllConnections(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	host := testClient("room-6", "bob", "host-uuid")
+	target := testClient("room-6", "alice", "alice-uuid")
+	hub.rooms["room-6"] = &RoomData{
+		Clients:      map[*Client]bool{host: true, target: true},
+		HostUUID:     host.UUID,
+		HostUsername: host.Username,
+	}
+	userChannel := testClient("", "alice", "user-uuid")
+	userChannel.UserChannel = true
+	hub.registerUserChannel(userChannel)
+
+	if n := hub.DisconnectUser("alice", "账号已被禁用"); n != 2 {
+		t.Fatalf("expected 2 connections closed, got %d", n)
+	}
+	for _, c := range []*Client{target, userChannel} {
+		if msg := readWSMessage(t, c.Send); msg.Type != "force_logout" {
+			t.Fatalf("expected force_logout for %s, got %q", c.UUID, msg.Type)
+		}
+		if _, ok := <-c.Send; ok {
+			t.Fatalf("expected send channel of %s to be closed", c.UUID)
+		}
+	}
+	if _, ok := hub.rooms["room-6"]; !ok {
+		t.Fatal("expected room to stay open when a guest is disconnected")
+	}
+	if _, ok := hub.userClients["alice"]; ok {
+		t.Fatal("expected user channel sessions to be removed")
+	}
+}
+
+// useTestDB 将 database.DB 替换为只在本测试内存在的内存数据库
+func useTestDB(t *testing.T) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	// 内存数据库每个连接各自独立，限制为单连接
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	if err := db.AutoMigrate(&models.User{}, &models.History{}, &models.Notification{}, &models.Room{}, &models.Upload{}, &models.Message{}, &models.MessageReaction{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+
+	prev := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = prev
+		sqlDB.Close()
+	})
+}
+
+func TestLoadRoomSettingsDoesNotGiveLegacyRoomsToJoiner(t *testing.T) {
+	useTestDB(t)
+	database.DB.Create(&models.History{Username: "alice", RoomID: "legacy"})
+
+	if room := loadRoomSettings("legacy", "bob"); room.CreatedBy != "alice" {
+		t.Fatalf("expected earliest visitor to own legacy room, got %q", room.CreatedBy)
+	}
+	if room := loadRoomSettings("fresh", "bob"); room.CreatedBy != "bob" {
+		t.Fatalf("expected joiner to own a brand-new room, got %q", room.CreatedBy)
+	}
+}
+
+func TestSetRoomTitlePushesRoomMeta(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	member := testClient("room-9", "alice", "alice-uuid")
+	outsider := testClient("room-10", "bob", "bob-uuid")
+	hub.do(func() {
+		hub.rooms["room-9"] = &RoomData{Clients: map[*Client]bool{member: true}, Title: "旧标题"}
+		hub.rooms["room-10"] = &RoomData{Clients: map[*Client]bool{outsider: true}}
+	})
+
+	hub.SetRoomTitle("room-9", "新标题")
+	if msg := readWSMessage(t, member.Send); msg.Type != "room_meta" || msg.RoomID != "room-9" || msg.Title != "新标题" {
+		t.Fatalf("expected room_meta with the new title, got %+v", msg)
+	}
+	// 标题没有变化时不重复推送，其他房间的成员收不到
+	hub.SetRoomTitle("room-9", "新标题")
+	hub.do(func() {})
+	if len(member.Send) != 0 || len(outsider.Send) != 0 {
+		t.Fatalf("expected no further pushes, got %d and %d", len(member.Send), len(outsider.Send))
+	}
+}
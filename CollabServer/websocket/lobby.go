@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// =============================================================================
+// 活跃房间目录
+// =============================================================================
+// 大厅需要知道"现在有哪些房间开着"：
+//   - ActiveRooms 返回内存中所有房间的快照，供 GET /api/rooms/active 使用
+//   - 用户频道（/ws/user）发送 lobby_subscribe 后先收到 lobby_snapshot，
+//     之后房间开启、成员或房主变化时收到 lobby_update，关闭时收到 lobby_room_closed
+//   - 房间默认不公开，只有创建者明确公开的房间才在大厅频道中推送；
+//     未公开的房间只通过 REST 接口向有权限的用户展示
+//   - 未指定房间时连接进入的默认房间 DefaultRoomID 不属于任何人，不出现在目录中
+// =============================================================================
+
+// DefaultRoomID 是 /ws 未带 room 参数时进入的房间
+const DefaultRoomID = "lobby"
+
+// ActiveRoom 是活跃房间目录中的一项
+type ActiveRoom struct {
+	RoomID       string    `json:"room_id"`
+	Title        string    `json:"title"`
+	Members      int       `json:"members"`
+	Host         string    `json:"host"`
+	LastActivity time.Time `json:"last_activity"`
+	Public       bool      `json:"public"`
+}
+
+// ActiveRooms 返回当前在内存中的房间快照，按最近活动时间倒序
+func (h *Hub) ActiveRooms() []ActiveRoom {
+	var rooms []ActiveRoom
+	h.do(func() {
+		rooms = make([]ActiveRoom, 0, len(h.rooms))
+		for roomID, room := range h.rooms {
+			if roomID != DefaultRoomID {
+				rooms = append(rooms, activeRoom(roomID, room))
+			}
+		}
+	})
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].LastActivity.After(rooms[j].LastActivity)
+	})
+	return rooms
+}
+
+// SetRoomPublic 更新在线房间的公开状态并通知大厅（设置本身由调用方落库）
+func (h *Hub) SetRoomPublic(roomID string, public bool) {
+	h.do(func() {
+		room, ok := h.rooms[roomID]
+		if !ok || room.Public == public {
+			return
+		}
+		room.Public = public
+		if !listedInLobby(roomID, room) {
+			h.notifyLobbyClosed(roomID)
+			return
+		}
+		h.notifyLobby(roomID)
+	})
+}
+
+// listedInLobby 判断房间是否在大厅频道中推送
+func listedInLobby(roomID string, room *RoomData) bool {
+	return room.Public && roomID != DefaultRoomID
+}
+
+// SetRoomTitle 更新在线房间的标题，推送 room_meta 给房间成员并通知大厅（标题本身由调用方落库）
+func (h *Hub) SetRoomTitle(roomID, title string) {
+	h.do(func() {
+		room, ok := h.rooms[roomID]
+		if !ok || room.Title == title {
+			return
+		}
+		room.Title = title
+		b, _ := json.Marshal(WSMessage{Type: "room_meta", RoomID: roomID, Title: title})
+		for client := range room.Clients {
+			select {
+			case client.Send <- b:
+			default:
+			}
+		}
+		h.notifyLobby(roomID)
+	})
+}
+
+func activeRoom(roomID string, room *RoomData) ActiveRoom {
+	return ActiveRoom{
+		RoomID:       roomID,
+		Title:        room.Title,
+		Members:      len(room.Clients),
+		Host:         room.HostUsername,
+		LastActivity: room.LastActivity,
+		Public:       room.Public,
+	}
+}
+
+// loadRoomSettings 读取房间设置（在客户端注册前调用）。还没有设置记录时建档：
+// 创建者取最早进入房间的用户，只有全新的房间（没有任何访问记录）才以 joiner 为创建者
+func loadRoomSettings(roomID, joiner string) models.Room {
+	room := models.Room{RoomID: roomID}
+	if database.DB.Where("room_id = ?", roomID).First(&room).Error == nil {
+		return room
+	}
+	var founder models.History
+	database.DB.Select("username").Where("room_id = ?", roomID).Order("id").Limit(1).Find(&founder)
+	if founder.Username == "" {
+		founder.Username = joiner
+	}
+	database.DB.Where(models.Room{RoomID: roomID}).Attrs(models.Room{CreatedBy: founder.Username}).FirstOrCreate(&room)
+	return room
+}
+
+// roomTrashed 判断房间是否在回收站中，回收站中的房间不能进入
+func roomTrashed(roomID string) bool {
+	var count int64
+	database.DB.Unscoped().Model(&models.Room{}).Where("room_id = ? AND deleted_at IS NOT NULL", roomID).Count(&count)
+	return count > 0
+}
+
+// subscribeLobby / unsubscribeLobby 处理用户频道的大厅订阅
+func (h *Hub) subscribeLobby(client *Client) {
+	h.lobby[client] = true
+	rooms := make([]ActiveRoom, 0, len(h.rooms))
+	for roomID, room := range h.rooms {
+		if listedInLobby(roomID, room) {
+			rooms = append(rooms, activeRoom(roomID, room))
+		}
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].LastActivity.After(rooms[j].LastActivity)
+	})
+	// 单独编码，空目录也返回 rooms: []
+	b, _ := json.Marshal(struct {
+		Type  string       `json:"type"`
+		Rooms []ActiveRoom `json:"rooms"`
+	}{"lobby_snapshot", rooms})
+	select {
+	case client.Send <- b:
+	default:
+	}
+}
+
+func (h *Hub) unsubscribeLobby(client *Client) {
+	delete(h.lobby, client)
+}
+
+// notifyLobby 向大厅推送房间的最新状态（房间开启、成员或房主变化）
+func (h *Hub) notifyLobby(roomID string) {
+	room, ok := h.rooms[roomID]
+	if !ok {
+		h.notifyLobbyClosed(roomID)
+		return
+	}
+	if !listedInLobby(roomID, room) || len(h.lobby) == 0 {
+		return
+	}
+	info := activeRoom(roomID, room)
+	b, _ := json.Marshal(WSMessage{Type: "lobby_update", Room: &info})
+	h.sendToLobby(b)
+}
+
+// notifyLobbyClosed 通知大厅房间已关闭（或取消公开）
+func (h *Hub) notifyLobbyClosed(roomID string) {
+	if len(h.lobby) == 0 {
+		return
+	}
+	b, _ := json.Marshal(WSMessage{Type: "lobby_room_closed", RoomID: roomID})
+	h.sendToLobby(b)
+}
+
+func (h *Hub) sendToLobby(b []byte) {
+	for c := range h.lobby {
+		select {
+		case c.Send <- b:
+		default:
+		}
+	}
+}
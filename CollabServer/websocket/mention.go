@@ -0,0 +1,154 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/richtext"
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// @提及解析与通知
+// =============================================================================
+// 聊天消息和文档正文中的 "@用户名" 会为被提及的用户生成一条 Notification，
+// 如果该用户当前在任意房间在线，还会实时推送一条 notification 消息。
+//
+// 文档是全量同步的，逐条 doc_update 解析会在输入 "@ali" 的过程中反复触发，
+// 因此文档提及只在定时保存时与上一次扫描的快照做差分，只通知新增的提及。
+// =============================================================================
+
+// mentionPattern 要求 @ 前面不是字母数字（排除邮箱地址）
+var mentionPattern = regexp.MustCompile(`(^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_\-.]{1,64})`)
+
+const mentionExcerptRunes = 40
+
+// countMentions 统计文本中每个用户名被提及的次数
+func countMentions(text string) map[string]int {
+	counts := map[string]int{}
+	if !strings.Contains(text, "@") {
+		return counts
+	}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[2], ".-")
+		if name != "" {
+			counts[name]++
+		}
+	}
+	return counts
+}
+
+// extractMentions 按出现顺序返回去重后的被提及用户名
+func extractMentions(text string) []string {
+	var names []string
+	seen := map[string]bool{}
+	if !strings.Contains(text, "@") {
+		return names
+	}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		name := strings.TrimRight(m[2], ".-")
+		if name != "" && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newMentions 返回 newText 相比 oldText 提及次数增加的用户名
+func newMentions(oldText, newText string) []string {
+	before := countMentions(oldText)
+	after := countMentions(newText)
+	var names []string
+	for _, name := range extractMentions(newText) {
+		if after[name] > before[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// mentionExcerpt 截取 @username 附近的一段文字作为通知摘要
+func mentionExcerpt(text, username string) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	flat := string(runes)
+	idx := strings.Index(flat, "@"+username)
+	if idx < 0 {
+		if len(runes) > mentionExcerptRunes*2 {
+			return string(runes[:mentionExcerptRunes*2]) + "…"
+		}
+		return flat
+	}
+
+	pos := len([]rune(flat[:idx]))
+	start := pos - mentionExcerptRunes
+	end := pos + len([]rune(username)) + 1 + mentionExcerptRunes
+	prefix, suffix := "", ""
+	if start < 0 {
+		start = 0
+	} else if start > 0 {
+		prefix = "…"
+	}
+	if end > len(runes) {
+		end = len(runes)
+	} else if end < len(runes) {
+		suffix = "…"
+	}
+	return prefix + string(runes[start:end]) + suffix
+}
+
+// notifyMentions 为存在的被提及用户写入通知并推送给在线会话（在独立 goroutine 中调用）
+func (h *Hub) notifyMentions(roomID, sender, source, text string, usernames []string) {
+	var candidates []string
+	for _, name := range usernames {
+		if name != sender {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return
+	}
+
+	var existing []string
+	if err := database.DB.Model(&models.User{}).Where("username IN ?", candidates).Pluck("username", &existing).Error; err != nil {
+		log.Printf("⚠️ 查询被提及用户失败: %v", err)
+		return
+	}
+
+	for _, name := range existing {
+		notification := models.Notification{
+			Username: name,
+			Type:     "mention",
+			Source:   source,
+			RoomID:   roomID,
+			Sender:   sender,
+			Content:  mentionExcerpt(text, name),
+		}
+		if err := database.DB.Create(&notification).Error; err != nil {
+			log.Printf("⚠️ 保存提及通知失败: %v", err)
+			continue
+		}
+
+		b, _ := json.Marshal(WSMessage{
+			Type:         "notification",
+			RoomID:       roomID,
+			Sender:       sender,
+			Notification: &notification,
+		})
+		h.SendToUsers([]string{name}, b)
+	}
+}
+
+// processDocumentMentions 对比文档前后两个版本，只通知新增的提及
+func (h *Hub) processDocumentMentions(roomID, editor, oldContent, newContent string) {
+	if editor == "" || !strings.Contains(newContent, "@") {
+		return
+	}
+	newText := richtext.PlainText(newContent)
+	names := newMentions(richtext.PlainText(oldContent), newText)
+	if len(names) > 0 {
+		h.notifyMentions(roomID, editor, "document", newText, names)
+	}
+}
@@ -0,0 +1,57 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/richtext"
+	"reflect"
+	"testing"
+)
+
+func TestExtractMentions(t *testing.T) {
+	got := extractMentions("@alice 看一下, cc @bob. 邮箱 carol@example.com 不算，@alice 重复")
+	want := []string{"alice", "bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestNewMentionsOnlyReportsAdded(t *testing.T) {
+	oldText := richtext.PlainText("<p>@alice 负责接口</p>")
+	newText := richtext.PlainText("<p>@alice 负责接口</p><p>@bob 和 @alice 负责测试</p>")
+
+	got := newMentions(oldText, newText)
+	want := []string{"alice", "bob"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	if got := newMentions(newText, oldText); len(got) != 0 {
+		t.Fatalf("expected removed mentions to be ignored, got %v", got)
+	}
+}
+
+func TestMentionExcerpt(t *testing.T) {
+	got := mentionExcerpt("请 @alice 今天看一下", "alice")
+	if got != "请 @alice 今天看一下" {
+		t.Fatalf("unexpected excerpt %q", got)
+	}
+}
+
+func TestNotifyMentionsOnlyExistingUsers(t *testing.T) {
+	useTestDB(t)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		database.DB.Create(&models.User{Username: name, Password: "x"})
+	}
+	database.DB.Create(&models.History{Username: "bob", RoomID: "room-1"})
+
+	hub := NewHub()
+	hub.notifyMentions("room-1", "alice", "chat", "@alice @bob @carol @ghost 看一下", []string{"alice", "bob", "carol", "ghost"})
+
+	// 自己和不存在的用户不通知；还没进入过房间的 carol 也会收到
+	var notified []string
+	database.DB.Model(&models.Notification{}).Order("username").Pluck("username", &notified)
+	if want := []string{"bob", "carol"}; !reflect.DeepEqual(notified, want) {
+		t.Fatalf("expected notifications for %v, got %v", want, notified)
+	}
+}
@@ -0,0 +1,86 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"collab-server/uploads"
+	"encoding/json"
+	"time"
+)
+
+// MemberInfo 是 user_list 中一个在线成员的资料，users 字段仍只有用户名以兼容旧客户端
+type MemberInfo struct {
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name,omitempty"`
+	Avatar      string `json:"avatar,omitempty"` // 已签名的头像地址
+}
+
+// loadProfile 在连接建立前读取用户的显示名与头像
+func loadProfile(client *Client) {
+	var user models.User
+	if err := database.DB.Select("display_name", "avatar").Where("username = ?", client.Username).First(&user).Error; err == nil {
+		client.DisplayName, client.Avatar = user.DisplayName, user.Avatar
+		client.avatarKey, client.avatarVersion = resolveAvatar(client.Username, user.Avatar)
+	}
+}
+
+// resolveAvatar 查出头像签名所需的 Key 与版本，不可签名时 Key 为空
+func resolveAvatar(username, avatar string) (string, uint) {
+	key, ok := uploads.KeyFromURL(avatar)
+	if !ok {
+		return "", 0
+	}
+	version, ok := uploads.SignableVersion(key, "", username)
+	if !ok {
+		return "", 0
+	}
+	return key, version
+}
+
+// UpdateProfile 更新该用户所有在线连接的资料，并向其所在房间重新广播 user_list
+func (h *Hub) UpdateProfile(username, displayName, avatar string) {
+	avatarKey, avatarVersion := resolveAvatar(username, avatar)
+	h.do(func() {
+		for roomID, room := range h.rooms {
+			changed := false
+			for c := range room.Clients {
+				if c.Username == username {
+					c.DisplayName, c.Avatar = displayName, avatar
+					c.avatarKey, c.avatarVersion = avatarKey, avatarVersion
+					changed = true
+				}
+			}
+			if changed {
+				h.broadcastUserList(roomID)
+			}
+		}
+		for c := range h.userClients[username] {
+			c.DisplayName, c.Avatar = displayName, avatar
+			c.avatarKey, c.avatarVersion = avatarKey, avatarVersion
+		}
+	})
+}
+
+// userListMessage 构造房间的 user_list 消息
+func (h *Hub) userListMessage(roomID string) []byte {
+	var members []MemberInfo
+	if room, ok := h.rooms[roomID]; ok {
+		for c := range room.Clients {
+			members = append(members, MemberInfo{
+				Username:    c.Username,
+				DisplayName: c.DisplayName,
+				Avatar:      signAvatar(c),
+			})
+		}
+	}
+	b, _ := json.Marshal(WSMessage{Type: "user_list", Users: h.getUserList(roomID), Members: members})
+	return b
+}
+
+// signAvatar 只用连接上已有的信息签名，不访问数据库，可在 Hub 循环内调用
+func signAvatar(c *Client) string {
+	if c.avatarKey == "" {
+		return c.Avatar
+	}
+	return uploads.SignedPath(c.avatarKey, c.avatarVersion, uploads.Expiry(time.Now()))
+}
@@ -0,0 +1,34 @@
+package websocket
+
+import (
+	"collab-server/database"
+	"collab-server/models"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUserListSignsAvatarsWithoutDatabase(t *testing.T) {
+	useTestDB(t)
+	t.Setenv("UPLOAD_SIGNING_SECRET", "test-secret")
+	database.DB.Create(&models.User{Username: "alice", Password: "x", DisplayName: "Alice", Avatar: "/uploads/a.png"})
+	database.DB.Create(&models.Upload{StorageKey: "a.png", Uploader: "alice", SignVersion: 2})
+
+	client := testClient("room-1", "alice", "alice-uuid")
+	loadProfile(client)
+	if client.avatarKey != "a.png" || client.avatarVersion != 2 {
+		t.Fatalf("expected avatar signing info to be loaded, got %q v%d", client.avatarKey, client.avatarVersion)
+	}
+
+	hub := NewHub()
+	hub.rooms["room-1"] = &RoomData{Clients: map[*Client]bool{client: true}}
+	// Hub 循环内构造 user_list 不应再访问数据库
+	database.DB = nil
+	var msg WSMessage
+	if err := json.Unmarshal(hub.userListMessage("room-1"), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if len(msg.Members) != 1 || !strings.HasPrefix(msg.Members[0].Avatar, "/uploads/a.png?sig=") {
+		t.Fatalf("expected signed avatar, got %+v", msg.Members)
+	}
+}